@@ -0,0 +1,131 @@
+package deltalake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// bufferManager accounts memory of rows buffered by all transactions of the
+// lake and limits the number of data objects flushed in the background
+type bufferManager struct {
+	budget  int64         // bytes, 0 is unlimited
+	workers chan struct{} // slots of background flushes, nil flushes in Put
+
+	mu       sync.Mutex
+	used     int64
+	released chan struct{} // closed and replaced when memory is released
+}
+
+func newBufferManager(budget int64, workers int) *bufferManager {
+	bm := &bufferManager{budget: budget, released: make(chan struct{})}
+	if workers > 0 {
+		bm.workers = make(chan struct{}, workers)
+	}
+	return bm
+}
+
+// reserve waits until n bytes fit into the budget. onFull is called once
+// before waiting so the caller can flush its own buffers, its error is
+// returned. Rows buffered by other transactions are released only when they
+// flush, so reserve gives up after timeout with ErrMemoryBudgetExceeded or
+// when ctx is done. Reservation larger than the whole budget is admitted
+// once nothing else is reserved.
+func (bm *bufferManager) reserve(ctx context.Context, n int64, timeout time.Duration, onFull func() error) error {
+	var expired <-chan time.Time
+	notified := false
+	bm.mu.Lock()
+	for bm.budget > 0 && bm.used > 0 && bm.used+n > bm.budget {
+		if !notified && onFull != nil {
+			notified = true
+			bm.mu.Unlock()
+			if err := onFull(); err != nil {
+				return err
+			}
+			bm.mu.Lock()
+			continue
+		}
+		if expired == nil && timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		released := bm.released
+		bm.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			return fmt.Errorf("%w: waited %s for %d bytes", ErrMemoryBudgetExceeded, timeout, n)
+		}
+		bm.mu.Lock()
+	}
+	bm.used += n
+	bm.mu.Unlock()
+	return nil
+}
+
+func (bm *bufferManager) release(n int64) {
+	if n == 0 {
+		return
+	}
+	bm.mu.Lock()
+	bm.used -= n
+	close(bm.released)
+	bm.released = make(chan struct{})
+	bm.mu.Unlock()
+}
+
+func (bm *bufferManager) reserved() int64 {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.used
+}
+
+// tableBuffer holds rows put to the table which were not flushed yet
+type tableBuffer struct {
+	rows      [][]any
+	bytes     int64 // reserved in the buffer manager
+	fileBytes int64 // estimated size of the data object
+}
+
+// pendingFlush is data object written in the background, its actions are
+// added to the transaction on commit in the order flushes were started
+type pendingFlush struct {
+	table   string
+	done    chan struct{}
+	actions []action
+	err     error
+}
+
+// rowSize estimates memory taken by the row
+func rowSize(row []any) int64 {
+	size := int64(24)
+	for _, v := range row {
+		size += valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v any) int64 {
+	switch v := v.(type) {
+	case string:
+		return 16 + int64(len(v))
+	case Decimal:
+		return 16 + int64(len(v))
+	case []byte:
+		return 24 + int64(len(v))
+	case []any:
+		return rowSize(v)
+	case map[string]any:
+		size := int64(48)
+		for k, fv := range v {
+			size += 16 + int64(len(k)) + valueSize(fv)
+		}
+		return size
+	default:
+		return 16
+	}
+}
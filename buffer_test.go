@@ -0,0 +1,182 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferManagerReserve(t *testing.T) {
+	ctx := context.Background()
+	bm := newBufferManager(100, 0)
+	require.NoError(t, bm.reserve(ctx, 60, 0, nil))
+
+	full := 0
+	reserved := make(chan error)
+	go func() {
+		reserved <- bm.reserve(ctx, 60, 0, func() error {
+			full++
+			return nil
+		})
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("reservation over the budget is not blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	bm.release(60)
+	require.NoError(t, <-reserved)
+	assert.Equal(t, 1, full)
+	assert.EqualValues(t, 60, bm.reserved())
+
+	// waiting gives up, error of the flush is returned without waiting
+	assert.ErrorIs(t, bm.reserve(ctx, 60, 10*time.Millisecond, nil), ErrMemoryBudgetExceeded)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, bm.reserve(canceled, 60, 0, nil), context.Canceled)
+	flushErr := errors.New("flush failed")
+	assert.ErrorIs(t, bm.reserve(ctx, 60, 0, func() error { return flushErr }), flushErr)
+	assert.EqualValues(t, 60, bm.reserved())
+
+	// reservation larger than the budget waits only for others to release
+	bm.release(60)
+	require.NoError(t, bm.reserve(ctx, 1000, 0, nil))
+	assert.EqualValues(t, 1000, bm.reserved())
+}
+
+func TestPutWaitsForIdleTransaction(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.MemoryBudget = 10 * rowSize([]any{int64(0)})
+	opts.MemoryWaitTimeout = 20 * time.Millisecond
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}}))
+	require.NoError(t, tx.Commit())
+
+	// idle transaction holds the whole budget
+	idle := d.NewTransaction()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, idle.Put("foo", []any{i}))
+	}
+	tx = d.NewTransaction()
+	assert.ErrorIs(t, tx.Put("foo", []any{2}), ErrMemoryBudgetExceeded)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, tx.PutContext(ctx, "foo", []any{2}), context.Canceled)
+
+	// rows are admitted once the idle transaction finishes
+	require.NoError(t, idle.Rollback())
+	require.NoError(t, tx.Put("foo", []any{2}))
+	require.NoError(t, tx.Commit())
+	assert.Zero(t, d.buffers.reserved())
+}
+
+func TestBackgroundFlush(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.MaxMemoryBufferSz = 10
+	opts.FlushWorkers = 2
+	// few rows fit into the budget so Put waits for background flushes
+	opts.MemoryBudget = 20 * rowSize([]any{int64(0), "row"})
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	require.NoError(t, tx.Create("foo", []string{"id", "name"}))
+	require.NoError(t, tx.Create("bar", []string{"id", "name"}))
+	require.NoError(t, tx.Commit())
+
+	tx = d.NewTransaction()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, tx.Put("foo", []any{int64(i), "row"}))
+		require.NoError(t, tx.Put("bar", []any{int64(i), "row"}))
+	}
+	require.NoError(t, tx.Commit())
+	assert.Zero(t, d.buffers.reserved())
+
+	tx = d.NewTransaction()
+	for _, table := range []string{"foo", "bar"} {
+		rows := collectRows(t, mustIter(t, tx, table))
+		require.Len(t, rows, 100)
+		// data objects are committed in the order rows were put
+		for i, row := range rows {
+			assert.Equal(t, float64(i), row[0])
+		}
+		// backpressure flushes buffers before they are full
+		assert.GreaterOrEqual(t, len(tx.tables[table].files), 10)
+	}
+	require.NoError(t, tx.Put("foo", []any{int64(100), "row"}))
+	assert.NotZero(t, d.buffers.reserved())
+	require.NoError(t, tx.Rollback())
+	assert.Zero(t, d.buffers.reserved())
+}
+
+func TestTargetFileSize(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.TargetFileSizeBytes = 2000
+	opts.FlushWorkers = 0
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}, {Name: "name", Type: StringType}}))
+	require.NoError(t, tx.Commit())
+	put := func(from, n int, name string) {
+		tx := d.NewTransaction()
+		for i := from; i < from+n; i++ {
+			require.NoError(t, tx.Put("foo", []any{i, name}))
+		}
+		require.NoError(t, tx.Commit())
+	}
+	files := func() []string {
+		tx := d.NewTransaction()
+		defer tx.Rollback()
+		return tx.tables["foo"].files
+	}
+
+	// object size follows row width instead of row count
+	put(0, 500, "x")
+	narrow := files()[1:]
+	put(500, 20, strings.Repeat("x", 400))
+	wide := files()[len(narrow)+1:]
+	assert.Len(t, narrow, 3)
+	assert.Len(t, wide, 5)
+	tx = d.NewTransaction()
+	for _, f := range append(narrow[:2], wide...) {
+		size := tx.tables["foo"].stats[f].Size
+		assert.Greater(t, size, int64(1000))
+		// estimate leaves out the envelope of the data object
+		assert.Less(t, size, int64(2200))
+	}
+	require.NoError(t, tx.Rollback())
+
+	for i := 0; i < 3; i++ {
+		put(520+i, 1, "small")
+	}
+	tx = d.NewTransaction()
+	require.NoError(t, tx.Optimize("foo"))
+	foo := tx.tables["foo"]
+	// empty object of create is dropped and small objects are packed with
+	// the last object of wide rows, objects which can't be merged are kept
+	assert.Subset(t, foo.files, narrow)
+	assert.Subset(t, foo.files, wide[:4])
+	assert.Len(t, foo.files, 8)
+	require.NoError(t, tx.Commit())
+
+	tx = d.NewTransaction()
+	defer tx.Rollback()
+	_, rows := queryRows(t, tx, "SELECT id FROM foo")
+	assert.Len(t, rows, 523)
+	// optimized table has nothing to compact
+	require.NoError(t, tx.Optimize("foo"))
+	assert.Empty(t, tx.actions)
+}
@@ -0,0 +1,181 @@
+package deltalake
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int64 // current size in cache units (bytes or rows)
+}
+
+type lruEntry[V any] struct {
+	key  string
+	val  V
+	size int64
+}
+
+// lru is a size-bounded least recently used cache safe for concurrent use
+type lru[V any] struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+
+	hits, misses, evictions atomic.Int64
+}
+
+func newLRU[V any](capacity int64) *lru[V] {
+	return &lru[V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lru[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.hits.Add(1)
+		return el.Value.(*lruEntry[V]).val, true
+	}
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+func (c *lru[V]) add(key string, val V, size int64) {
+	if size > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, val: val, size: size})
+	c.size += size
+	for c.size > c.capacity {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *lru[V]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lru[V]) removeElement(el *list.Element) {
+	entry := c.ll.Remove(el).(*lruEntry[V])
+	delete(c.items, entry.key)
+	c.size -= entry.size
+}
+
+func (c *lru[V]) stats() CacheStats {
+	c.mu.Lock()
+	size := c.size
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// CachedStorage is a read-through cache of raw file contents. Data objects and
+// logs are never modified after being written so entries are never stale.
+type CachedStorage struct {
+	inner ObjectStorage
+	cache *lru[[]byte]
+}
+
+var _ ObjectStorage = (*CachedStorage)(nil)
+
+func NewCachedStorage(inner ObjectStorage, bytes int) *CachedStorage {
+	return &CachedStorage{
+		inner: inner,
+		cache: newLRU[[]byte](int64(bytes)),
+	}
+}
+
+func (cs *CachedStorage) Write(file string, data []byte) error {
+	if err := cs.inner.Write(file, data); err != nil {
+		return err
+	}
+	// stores without put-if-absent may overwrite files
+	cs.cache.remove(file)
+	return nil
+}
+
+func (cs *CachedStorage) List(subdir, pre string) ([]string, error) {
+	return cs.inner.List(subdir, pre)
+}
+
+func (cs *CachedStorage) Read(file string) (io.ReadCloser, error) {
+	if raw, ok := cs.cache.get(file); ok {
+		return io.NopCloser(bytes.NewReader(raw)), nil
+	}
+	rd, err := cs.inner.Read(file)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	raw, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	cs.cache.add(file, raw, int64(len(raw)))
+	return io.NopCloser(bytes.NewReader(raw)), nil
+}
+
+func (cs *CachedStorage) Stats() CacheStats {
+	return cs.cache.stats()
+}
+
+// rowCache keeps decoded data objects keyed by file name, its size is
+// measured in rows.
+type rowCache struct {
+	cache *lru[[][]any]
+}
+
+func newRowCache(rows int) *rowCache {
+	if rows <= 0 {
+		return nil
+	}
+	return &rowCache{cache: newLRU[[][]any](int64(rows))}
+}
+
+func (rc *rowCache) get(file string) ([][]any, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	return rc.cache.get(file)
+}
+
+func (rc *rowCache) add(file string, rows [][]any) {
+	if rc == nil {
+		return
+	}
+	rc.cache.add(file, rows, int64(len(rows)))
+}
+
+func (rc *rowCache) stats() CacheStats {
+	if rc == nil {
+		return CacheStats{}
+	}
+	return rc.cache.stats()
+}
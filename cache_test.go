@@ -0,0 +1,82 @@
+package deltalake
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := newLRU[int](3)
+	c.add("a", 1, 1)
+	c.add("b", 2, 1)
+	c.add("c", 3, 1)
+	_, ok := c.get("a") // a becomes most recently used
+	assert.True(t, ok)
+	c.add("d", 4, 1)
+
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	for _, k := range []string{"a", "c", "d"} {
+		_, ok = c.get(k)
+		assert.True(t, ok)
+	}
+	c.add("e", 5, 10) // larger than capacity
+	_, ok = c.get("e")
+	assert.False(t, ok)
+
+	stats := c.stats()
+	assert.Equal(t, int64(4), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(3), stats.Size)
+}
+
+func TestCachedStorage(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cs := NewCachedStorage(NewFileStorage(testdir), 1024)
+	assert.NoError(t, cs.Write("foo", []byte("bar")))
+
+	for i := 0; i < 3; i++ {
+		rd, err := cs.Read("foo")
+		assert.NoError(t, err)
+		raw, err := io.ReadAll(rd)
+		assert.NoError(t, err)
+		assert.NoError(t, rd.Close())
+		assert.Equal(t, "bar", string(raw))
+	}
+	stats := cs.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(3), stats.Size)
+}
+
+func TestRowCacheSharedAcrossTransactions(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.RowCacheSize = 100
+	cl := New(NewFileStorage(testdir), opts)
+
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.Create("foo", []string{"a"}))
+	assert.NoError(t, tx.Put("foo", []any{"x"}))
+	assert.NoError(t, tx.Commit())
+
+	for i := 0; i < 2; i++ {
+		txRead := cl.NewTransaction()
+		it, err := txRead.Iter("foo")
+		assert.NoError(t, err)
+		val, err := it.First()
+		assert.NoError(t, err)
+		assert.Equal(t, []any{"x"}, val)
+		_, err = it.Next()
+		assert.ErrorIs(t, err, ErrIteratorExhausted)
+		assert.NoError(t, txRead.Commit())
+	}
+	stats := cl.RowCacheStats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+}
@@ -0,0 +1,211 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PropertyEnableChangeDataFeed set to "true" makes writes to the table record
+// changed rows read by TableChanges
+const PropertyEnableChangeDataFeed = "delta.enableChangeDataFeed"
+
+// change types of the rows returned by TableChanges
+const (
+	ChangeInsert          = "insert"
+	ChangeDelete          = "delete"
+	ChangeUpdatePreimage  = "update_preimage"
+	ChangeUpdatePostimage = "update_postimage"
+)
+
+// columns appended to the table columns in rows returned by TableChanges
+const (
+	ChangeTypeColumn      = "_change_type"
+	CommitVersionColumn   = "_commit_version"
+	CommitTimestampColumn = "_commit_timestamp"
+)
+
+// SetTableProperty sets property of the table, the new value is used by the
+// following writes of the transaction
+func (tx *Transaction) SetTableProperty(table, key, value string) error {
+	t, ok := tx.tables[table]
+	if !ok {
+		return tableError(table, ErrTableNotFound)
+	}
+	properties := maps.Clone(t.properties)
+	if properties == nil {
+		properties = make(map[string]string)
+	}
+	properties[key] = value
+	t.properties = properties
+
+	// metadata already changed by the transaction, like by creating the
+	// table, gets the property
+	for _, a := range tx.actions {
+		if cm, ok := a.(*changeMetadata); ok && cm.Table == table {
+			cm.Properties = properties
+			return nil
+		}
+	}
+	cm := newChangeMetadaAction(table, t.schema)
+	cm.Properties = properties
+	tx.actions = append(tx.actions, cm)
+	tx.setOperation("SET TBLPROPERTIES", map[string]string{key: value})
+	return nil
+}
+
+func (t *table) changeDataFeed() bool {
+	return t.properties[PropertyEnableChangeDataFeed] == "true"
+}
+
+func withChangeType(row []any, changeType string) []any {
+	res := make([]any, len(row), len(row)+1)
+	copy(res, row)
+	return append(res, changeType)
+}
+
+// writeChanges persists rows followed by their change type as change data
+// file of the table
+func (tx *Transaction) writeChanges(name string, changes [][]any) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	ca, err := tx.d.persistChanges(name, changes)
+	if err != nil {
+		return err
+	}
+	tx.actions = append(tx.actions, ca)
+	return nil
+}
+
+func (d *delta) persistChanges(name string, changes [][]any) (*changeDataAction, error) {
+	do := &dataObject{
+		Id:    uuid.NewString(),
+		Table: name,
+		Data:  changes,
+		Size:  len(changes),
+	}
+	do.fileName = fmt.Sprintf("_change_data_%s_%s", name, do.Id)
+	if _, err := do.persist(d.internalStorage); err != nil {
+		return nil, err
+	}
+	return newChangeDataAction(name, do.fileName), nil
+}
+
+// changeFile is change data file committed in the version
+type changeFile struct {
+	file      string
+	version   int64
+	timestamp time.Time
+}
+
+// TableChanges returns rows changed by the versions from fromVersion to
+// toVersion inclusive in the commit order. Rows are the table columns
+// followed by _change_type, _commit_version and _commit_timestamp. Versions
+// committed while the change data feed of the table was disabled have no
+// changes.
+func (tx *Transaction) TableChanges(table string, fromVersion, toVersion int64) (Iterator, error) {
+	t, ok := tx.tables[table]
+	if !ok {
+		return nil, tableError(table, ErrTableNotFound)
+	}
+	if !t.changeDataFeed() {
+		return nil, tableError(table, ErrChangeDataDisabled)
+	}
+	if fromVersion < 0 || fromVersion >= tx.id || toVersion < fromVersion {
+		return nil, tableError(table, fmt.Errorf("%w: changes from %d to %d", ErrVersionNotFound, fromVersion, toVersion))
+	}
+	versions, err := tx.d.log.Versions()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]changeFile, 0)
+	for _, v := range versions {
+		if v < fromVersion || v > toVersion || v >= tx.id {
+			continue
+		}
+		actions, err := tx.d.readActions(v)
+		if err != nil {
+			return nil, err
+		}
+		var ts time.Time
+		for _, a := range actions {
+			switch a := a.(type) {
+			case *commitInfo:
+				ts = a.Timestamp
+			case *changeDataAction:
+				if a.Table == table {
+					files = append(files, changeFile{file: a.File, version: v, timestamp: ts})
+				}
+			}
+		}
+	}
+	changes := newTable(table, append(slices.Clone(t.schema), Column{Name: ChangeTypeColumn, Type: StringType}),
+		t.externalStorage, t.rows)
+	return &changesIt{table: changes, files: files}, nil
+}
+
+// changesIt reads change data files one by one adding the commit of the file
+// to its rows
+type changesIt struct {
+	table *table
+	files []changeFile
+	pos   int
+
+	rd rowReader // reader of files[pos-1]
+}
+
+func (ci *changesIt) First() ([]any, error) {
+	ci.pos = 0
+	if err := ci.closeFile(); err != nil {
+		return nil, err
+	}
+	return ci.Next()
+}
+
+func (ci *changesIt) Next() ([]any, error) {
+	for {
+		if ci.rd == nil {
+			if ci.pos >= len(ci.files) {
+				return nil, ErrIteratorExhausted
+			}
+			rd, err := ci.table.openFile(ci.files[ci.pos].file)
+			if err != nil {
+				return nil, err
+			}
+			ci.rd = rd
+			ci.pos++
+		}
+		row, err := ci.rd.next()
+		if err == nil {
+			f := ci.files[ci.pos-1]
+			res := make([]any, len(row), len(row)+2)
+			copy(res, row)
+			return append(res, f.version, f.timestamp), nil
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if err := ci.closeFile(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (ci *changesIt) Close() error {
+	return ci.closeFile()
+}
+
+func (ci *changesIt) closeFile() error {
+	if ci.rd == nil {
+		return nil
+	}
+	err := ci.rd.close()
+	ci.rd = nil
+	return err
+}
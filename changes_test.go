@@ -0,0 +1,113 @@
+package deltalake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableChanges(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}, {Name: "name", Type: StringType}}))
+	require.NoError(t, tx.Create("bar", []string{"id"}))
+	require.NoError(t, tx.SetTableProperty("foo", PropertyEnableChangeDataFeed, "true"))
+	require.NoError(t, tx.Put("foo", []any{1, "a"}))
+	require.NoError(t, tx.Put("foo", []any{2, "b"}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	_, err := tx.Update("foo", map[string]string{"name": "'B'"}, "id = 2")
+	require.NoError(t, err)
+	_, err = tx.Delete("foo", "id = 1")
+	require.NoError(t, err)
+	_, err = tx.TableChanges("bar", 0, 1)
+	assert.ErrorIs(t, err, ErrChangeDataDisabled)
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	_, _, err = tx.Merge("foo", [][]any{{2, "b"}, {3, "c"}}, []string{"id"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	it, err := tx.TableChanges("foo", 0, 2)
+	require.NoError(t, err)
+	defer it.Close()
+	rows := collectRows(t, it)
+	changes := make([][]any, len(rows))
+	for i, row := range rows {
+		require.Len(t, row, 5)
+		assert.IsType(t, time.Time{}, row[4])
+		changes[i] = row[:4]
+	}
+	assert.Equal(t, [][]any{
+		{int64(1), "a", ChangeInsert, int64(0)},
+		{int64(2), "b", ChangeInsert, int64(0)},
+		{int64(2), "b", ChangeUpdatePreimage, int64(1)},
+		{int64(2), "B", ChangeUpdatePostimage, int64(1)},
+		{int64(1), "a", ChangeDelete, int64(1)},
+		{int64(2), "B", ChangeUpdatePreimage, int64(2)},
+		{int64(2), "b", ChangeUpdatePostimage, int64(2)},
+		{int64(3), "c", ChangeInsert, int64(2)},
+	}, changes)
+
+	it, err = tx.TableChanges("foo", 2, 100)
+	require.NoError(t, err)
+	assert.Len(t, collectRows(t, it), 3)
+	require.NoError(t, it.Close())
+	_, err = tx.TableChanges("foo", 3, 3)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	_, err = tx.TableChanges("foo", 2, 1)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+
+	// change data files are not part of the table
+	_, data := queryRows(t, tx, "SELECT id, name FROM foo ORDER BY id")
+	assert.Equal(t, [][]any{{int64(2), "b"}, {int64(3), "c"}}, data)
+}
+
+func TestSetTableProperty(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.Create("foo", []string{"id"}))
+	require.NoError(t, tx.Put("foo", []any{1}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.SetTableProperty("foo", PropertyEnableChangeDataFeed, "true"))
+	require.NoError(t, tx.Put("foo", []any{2}))
+	require.NoError(t, tx.Commit())
+
+	history, err := cl.History("foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "SET TBLPROPERTIES", history[0].Operation)
+
+	// only changes written with the feed enabled are returned
+	tx = cl.NewTransaction()
+	it, err := tx.TableChanges("foo", 0, 1)
+	require.NoError(t, err)
+	rows := collectRows(t, it)
+	require.Len(t, rows, 1)
+	assert.Equal(t, []any{2.0, ChangeInsert, int64(1)}, rows[0][:3])
+	require.NoError(t, it.Close())
+	require.NoError(t, tx.Rollback())
+
+	// restore brings back the properties of the version
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 0))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	_, err = tx.TableChanges("foo", 0, 1)
+	assert.ErrorIs(t, err, ErrChangeDataDisabled)
+	assert.ErrorIs(t, tx.SetTableProperty("missing", "key", "value"), ErrTableNotFound)
+}
@@ -1,56 +1,162 @@
+// deltactl is a command line client of the deltalake server. Commands can be
+// run one by one or from the interactive shell started when no command is
+// given, the shell keeps transaction open across commands.
 package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"time"
+
 	"github.com/deltalake/protos"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"io"
-	"log"
-	"time"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-const (
-	defaultName = "world"
-)
+const _envPrefix = "DELTALAKE_"
 
-var (
-	addr = flag.String("addr", "localhost:9000", "the address to connect to")
-	name = flag.String("name", defaultName, "Name to greet")
-)
+type options struct {
+	addr    string
+	token   string
+	tls     bool
+	tlsCA   string
+	tlsCert string
+	tlsKey  string
+	timeout time.Duration
+	txId    int64
+}
 
 func main() {
-	flag.Parse()
-	// Set up a connection to the server.
-	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	fs := flag.NewFlagSet("deltactl", flag.ContinueOnError)
+	opts := options{}
+	fs.StringVar(&opts.addr, "addr", envOr("ADDR", "localhost:9000"), "address of the server")
+	fs.StringVar(&opts.token, "token", os.Getenv(_envPrefix+"TOKEN"), "bearer token used for authentication")
+	fs.BoolVar(&opts.tls, "tls", false, "connect using TLS")
+	fs.StringVar(&opts.tlsCA, "tlsCA", "", "CA file used to verify the server, implies -tls")
+	fs.StringVar(&opts.tlsCert, "tlsCert", "", "client certificate file used for mTLS, implies -tls")
+	fs.StringVar(&opts.tlsKey, "tlsKey", "", "client key file used for mTLS")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of requests other than scans and inserts")
+	fs.Int64Var(&opts.txId, "tx", 0, "id of the open transaction used by commands")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: deltactl [flags] [command [args]]\n\nflags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\ncommands:\n")
+		printCommands(fs.Output())
+		fmt.Fprintf(fs.Output(), "\ninteractive shell is started when no command is given\n")
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	conn, err := dial(opts)
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		fmt.Fprintf(os.Stderr, "deltactl: %v\n", err)
+		os.Exit(1)
 	}
 	defer conn.Close()
-	c := protos.NewReaderServiceClient(conn)
-
-	// Contact the server and print out its response.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
 
-	r, err := c.Scan(ctx, &protos.GetRequest{Table: "test"})
+	ss := newSession(conn, opts, os.Stdout)
+	if fs.NArg() == 0 {
+		err = ss.repl(os.Stdin)
+	} else {
+		err = ss.run(fs.Args())
+	}
 	if err != nil {
-		log.Fatalf("could not greet: %v", err)
+		fmt.Fprintf(os.Stderr, "deltactl: %s\n", errorMessage(err))
+		os.Exit(1)
 	}
+}
 
-	for {
-		resp, err := r.Recv()
-		if err == io.EOF {
-			return
-		} else if err == nil {
-			valStr := fmt.Sprintf("Response: %v", resp.GetData())
-			log.Println(valStr)
-		}
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(_envPrefix + name); ok {
+		return v
+	}
+	return def
+}
 
-		if err != nil {
-			panic(err)
+func dial(opts options) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if opts.tls || opts.tlsCA != "" || opts.tlsCert != "" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.tlsCA != "" {
+			raw, err := os.ReadFile(opts.tlsCA)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(raw) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.tlsCA)
+			}
+		}
+		if opts.tlsCert != "" {
+			cert, err := tls.LoadX509KeyPair(opts.tlsCert, opts.tlsKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Certificates = []tls.Certificate{cert}
 		}
+		creds = credentials.NewTLS(cfg)
+	}
+	return grpc.NewClient(opts.addr, grpc.WithTransportCredentials(creds))
+}
+
+// session runs commands against the server, txId is the transaction used by
+// the commands
+type session struct {
+	reader protos.ReaderServiceClient
+	writer protos.WriterServiceClient
+	opts   options
+	out    io.Writer
+	in     io.Reader // read by insert when no rows are given
+
+	txId          *int64
+	stopKeepAlive func()
+	interactive   bool
+}
+
+func newSession(conn grpc.ClientConnInterface, opts options, out io.Writer) *session {
+	ss := &session{
+		reader: protos.NewReaderServiceClient(conn),
+		writer: protos.NewWriterServiceClient(conn),
+		opts:   opts,
+		out:    out,
+		in:     os.Stdin,
+	}
+	if opts.txId != 0 {
+		ss.txId = &opts.txId
+	}
+	return ss
+}
+
+// ctx returns context of a request carrying the bearer token, streaming
+// requests are not limited by the timeout
+func (ss *session) ctx(streaming bool) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if ss.opts.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+ss.opts.token)
+	}
+	if streaming || ss.opts.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ss.opts.timeout)
+}
+
+// errorMessage strips the grpc formatting from errors returned by the server
+func errorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return fmt.Sprintf("%s (%s)", st.Message(), st.Code())
 	}
+	return err.Error()
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deltalake/protos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeServer keeps tables in memory, rows inserted in a transaction are
+// visible after commit
+type fakeServer struct {
+	protos.UnimplementedReaderServiceServer
+	protos.UnimplementedWriterServiceServer
+
+	mu      sync.Mutex
+	schemas map[string][]*protos.ColumnSchema
+	rows    map[string][]*protos.Row
+	pending map[int64][]*protos.SetRequest
+	nextTx  int64
+	tokens  []string
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		schemas: make(map[string][]*protos.ColumnSchema),
+		rows:    make(map[string][]*protos.Row),
+		pending: make(map[int64][]*protos.SetRequest),
+	}
+}
+
+func (fs *fakeServer) token(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	fs.tokens = append(fs.tokens, md.Get("authorization")...)
+}
+
+func (fs *fakeServer) DescribeTable(ctx context.Context, in *protos.DescribeTableRequest) (*protos.TableSchema, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.token(ctx)
+	schema, ok := fs.schemas[in.Table]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s not found", in.Table)
+	}
+	return &protos.TableSchema{Table: in.Table, Columns: schema}, nil
+}
+
+func (fs *fakeServer) Scan(in *protos.GetRequest, stream grpc.ServerStreamingServer[protos.DataResponse]) error {
+	fs.mu.Lock()
+	rows := fs.rows[in.Table]
+	fs.mu.Unlock()
+	if in.Limit > 0 && int64(len(rows)) > in.Limit {
+		rows = rows[:in.Limit]
+	}
+	for _, row := range rows {
+		if err := stream.Send(&protos.DataResponse{Row: row}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns made up commits, newest first
+func (fs *fakeServer) History(_ context.Context, in *protos.HistoryRequest) (*protos.HistoryResponse, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.schemas[in.Table]; !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s not found", in.Table)
+	}
+	resp := &protos.HistoryResponse{}
+	for v := int64(2); v >= 0 && (in.Limit <= 0 || int64(len(resp.Commits)) < in.Limit); v-- {
+		resp.Commits = append(resp.Commits, &protos.CommitInfo{
+			Version:             v,
+			Timestamp:           timestamppb.New(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+			Operation:           "WRITE",
+			OperationParameters: map[string]string{"mode": "Append"},
+			ClientId:            "loader",
+			Metrics:             map[string]int64{"numOutputRows": 4, "numFiles": 1},
+		})
+	}
+	return resp, nil
+}
+
+func (fs *fakeServer) Create(ctx context.Context, in *protos.CreateRequest) (*protos.Error, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.token(ctx)
+	schema := in.Schema
+	if len(schema) == 0 {
+		for _, c := range in.Columns {
+			schema = append(schema, &protos.ColumnSchema{Name: c})
+		}
+	}
+	fs.schemas[in.Table] = schema
+	return &protos.Error{Status: 200}, nil
+}
+
+func (fs *fakeServer) BulkInsert(stream grpc.ClientStreamingServer[protos.SetRequest, protos.InsertSummary]) error {
+	summary := &protos.InsertSummary{TableRows: make(map[string]int64)}
+	var txId *int64
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fs.mu.Lock()
+		if txId = in.TxId; txId != nil {
+			fs.pending[*txId] = append(fs.pending[*txId], in)
+		} else {
+			fs.rows[in.Table] = append(fs.rows[in.Table], in.Row)
+		}
+		fs.mu.Unlock()
+		summary.Rows++
+		summary.TableRows[in.Table]++
+	}
+	summary.Committed = txId == nil
+	return stream.SendAndClose(summary)
+}
+
+func (fs *fakeServer) NewTransaction(context.Context, *protos.Empty) (*protos.Transaction, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.nextTx++
+	fs.pending[fs.nextTx] = nil
+	return &protos.Transaction{TxId: fs.nextTx}, nil
+}
+
+func (fs *fakeServer) finish(id int64, commit bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	pending, ok := fs.pending[id]
+	if !ok {
+		return status.Errorf(codes.NotFound, "transaction %d not found", id)
+	}
+	delete(fs.pending, id)
+	if commit {
+		for _, in := range pending {
+			fs.rows[in.Table] = append(fs.rows[in.Table], in.Row)
+		}
+	}
+	return nil
+}
+
+func (fs *fakeServer) Commit(_ context.Context, in *protos.Transaction) (*protos.Error, error) {
+	return &protos.Error{Status: 200}, fs.finish(in.TxId, true)
+}
+
+func (fs *fakeServer) Rollback(_ context.Context, in *protos.Transaction) (*protos.Error, error) {
+	return &protos.Error{Status: 200}, fs.finish(in.TxId, false)
+}
+
+func newTestSession(t *testing.T, opts options) (*session, *fakeServer, *bytes.Buffer) {
+	fs := newFakeServer()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	protos.RegisterReaderServiceServer(srv, fs)
+	protos.RegisterWriterServiceServer(srv, fs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	if opts.timeout == 0 {
+		opts.timeout = time.Second
+	}
+	out := &bytes.Buffer{}
+	return newSession(conn, opts, out), fs, out
+}
+
+func TestCommands(t *testing.T) {
+	ss, fs, out := newTestSession(t, options{token: "secret"})
+
+	require.NoError(t, ss.run([]string{"create", "foo", "id:int64", "name:string", "tags:list"}))
+	require.Equal(t, protos.ColumnType_INT64, fs.schemas["foo"][0].Type)
+	require.Equal(t, protos.ColumnType_LIST, fs.schemas["foo"][2].Type)
+	assert.Contains(t, fs.tokens, "Bearer secret")
+
+	require.NoError(t, ss.run([]string{"insert", "foo", `[1, "a", ["x", 2]]`, `{"name": "b", "id": 2}`}))
+	assert.Contains(t, out.String(), "inserted 2 rows")
+	ss.in = strings.NewReader("[3, \"c\"]\n\n[4, null]\n")
+	require.NoError(t, ss.run([]string{"insert", "foo"}))
+	assert.Len(t, fs.rows["foo"], 4)
+
+	out.Reset()
+	require.NoError(t, ss.run([]string{"scan", "-limit", "2", "foo"}))
+	assert.Equal(t, "id  name  tags\n--  ----  ----\n1   a     [\"x\",2]\n2   b     NULL\n(2 rows)\n", out.String())
+
+	out.Reset()
+	require.NoError(t, ss.run([]string{"scan", "-format", "json", "-limit", "1", "foo"}))
+	assert.Equal(t, `{"id":1,"name":"a","tags":["x",2]}`+"\n", out.String())
+
+	out.Reset()
+	require.NoError(t, ss.run([]string{"scan", "-format", "csv", "foo"}))
+	assert.Equal(t, "id,name,tags\n1,a,\"[\"\"x\"\",2]\"\n2,b,\n3,c,\n4,,\n", out.String())
+
+	out.Reset()
+	require.NoError(t, ss.run([]string{"describe", "foo"}))
+	assert.Contains(t, out.String(), "name    string")
+
+	assert.ErrorContains(t, ss.run([]string{"insert", "foo", `["x"]`}), "row 1: column id")
+	assert.ErrorContains(t, ss.run([]string{"scan", "-format", "xml", "foo"}), "unknown format")
+	assert.Equal(t, codes.NotFound, status.Code(ss.run([]string{"scan", "bar"})))
+	assert.ErrorContains(t, ss.run([]string{"drop", "foo"}), "unknown command")
+
+	out.Reset()
+	require.NoError(t, ss.run([]string{"history", "-limit", "1", "foo"}))
+	assert.Equal(t, "version  timestamp             operation  client  parameters   metrics\n"+
+		"-------  ---------             ---------  ------  ----------   -------\n"+
+		"2        2024-01-02T03:04:05Z  WRITE      loader  mode=Append  numFiles=1 numOutputRows=4\n"+
+		"(1 row)\n", out.String())
+	assert.Equal(t, codes.NotFound, status.Code(ss.run([]string{"history", "bar"})))
+
+	// transaction id is printed and passed to the following commands
+	out.Reset()
+	require.NoError(t, ss.run([]string{"begin"}))
+	assert.Equal(t, "1\n", out.String())
+	id := int64(1)
+	ss.txId = &id
+	require.NoError(t, ss.run([]string{"insert", "foo", `[5]`}))
+	assert.Len(t, fs.rows["foo"], 4)
+	require.NoError(t, ss.run([]string{"commit"}))
+	assert.Len(t, fs.rows["foo"], 5)
+	assert.Nil(t, ss.txId)
+}
+
+func TestREPL(t *testing.T) {
+	ss, fs, out := newTestSession(t, options{})
+	require.NoError(t, ss.run([]string{"create", "foo", "id"}))
+
+	in := strings.NewReader(strings.Join([]string{
+		"begin",
+		"begin",
+		`insert foo '[1]' "[2]"`,
+		"rollback",
+		"begin",
+		`insert foo [3]`,
+		"commit",
+		"scan foo",
+		`insert foo '[4]`,
+		"begin",
+		"exit",
+	}, "\n"))
+	require.NoError(t, ss.repl(in))
+
+	output := out.String()
+	assert.Contains(t, output, "started transaction 1")
+	assert.Contains(t, output, "error: transaction 1 is already open")
+	assert.Contains(t, output, "deltactl (tx 1)> inserted 2 rows")
+	assert.Contains(t, output, "rolled back transaction 1")
+	assert.Contains(t, output, "committed transaction 2")
+	assert.Contains(t, output, "error: unterminated quote")
+	// transaction left open is rolled back on exit
+	assert.Contains(t, output, "rolled back transaction 3")
+	assert.Empty(t, fs.pending)
+	assert.Len(t, fs.rows["foo"], 1)
+}
+
+func TestSplitArgs(t *testing.T) {
+	for line, expected := range map[string][]string{
+		"":                           {},
+		"scan  foo":                  {"scan", "foo"},
+		`scan -where "id = 'x y'" t`: {"scan", "-where", "id = 'x y'", "t"},
+		`insert t '["a b", 1]'`:      {"insert", "t", `["a b", 1]`},
+		`a\ b "c\"d"`:                {"a b", `c"d`},
+		`''`:                         {""},
+	} {
+		args, err := splitArgs(line)
+		require.NoError(t, err, line)
+		assert.Equal(t, expected, args, line)
+	}
+	_, err := splitArgs(`"abc`)
+	assert.Error(t, err)
+}
+
+func TestParseRow(t *testing.T) {
+	columns := []*protos.ColumnSchema{
+		{Name: "any", Type: protos.ColumnType_ANY},
+		{Name: "ts", Type: protos.ColumnType_TIMESTAMP},
+		{Name: "bytes", Type: protos.ColumnType_BYTES},
+		{Name: "price", Type: protos.ColumnType_DECIMAL},
+		{Name: "double", Type: protos.ColumnType_DOUBLE},
+	}
+	row, err := parseRow(`[1.5, "2024-01-02T03:04:05Z", "AQI=", 10.25, 3]`, columns)
+	require.NoError(t, err)
+	values, err := fromProtoRow(row)
+	require.NoError(t, err)
+	assert.Equal(t, []any{1.5, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []byte{1, 2}, "10.25", float64(3)},
+		[]any{values[0], values[1], values[2], formatValue(values[3]), values[4]})
+	assert.Equal(t, "AQI=", formatValue(values[2]))
+
+	for _, raw := range []string{`[1, 2]`, `[1, "x"]`, `[1, null, "%%"]`, `{"missing": 1}`, `1`, `[1] [2]`, `[1, null, null, null, null, null]`} {
+		_, err := parseRow(raw, columns)
+		assert.Error(t, err, raw)
+	}
+}
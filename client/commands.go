@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deltalake/protos"
+)
+
+type command struct {
+	name  string
+	args  string
+	help  string
+	run   func(ss *session, fs *flag.FlagSet, args []string) error
+	flags func(fs *flag.FlagSet)
+}
+
+var commands []command
+
+func init() {
+	// assigned in init since help refers to the commands
+	commands = []command{
+		{name: "create", args: "<table> <column[:type]>...", run: (*session).create,
+			help: "create table, types: any, bool, int64, double, string, bytes, timestamp, decimal, list, struct"},
+		{name: "describe", args: "<table>", run: (*session).describe,
+			help: "print columns of the table"},
+		{name: "insert", args: "[-file path] <table> [row]...", run: (*session).insert, flags: insertFlags,
+			help: "insert rows given as json arrays or objects, rows are read from the file or stdin when none are given"},
+		{name: "scan", args: "[-where filter] [-limit n] [-format table|json|csv] <table>", run: (*session).scan, flags: scanFlags,
+			help: "print rows of the table"},
+		{name: "begin", run: (*session).begin,
+			help: "start transaction used by the following commands"},
+		{name: "commit", args: "[tx]", run: (*session).commit,
+			help: "commit the transaction"},
+		{name: "rollback", args: "[tx]", run: (*session).rollback,
+			help: "roll back the transaction"},
+		{name: "history", args: "[-limit n] <table>", run: (*session).history, flags: historyFlags,
+			help: "print versions of the table, newest first"},
+		{name: "help", run: (*session).help,
+			help: "print commands"},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printCommands(w io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", c.name, c.args, c.help)
+	}
+}
+
+// run executes single command, args[0] is the command name
+func (ss *session) run(args []string) error {
+	c, ok := findCommand(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command %q, see help", args[0])
+	}
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(ss.out)
+	fs.Usage = func() {
+		fmt.Fprintf(ss.out, "usage: %s %s\n%s\n", c.name, c.args, c.help)
+		fs.PrintDefaults()
+	}
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	return c.run(ss, fs, fs.Args())
+}
+
+func (ss *session) help(_ *flag.FlagSet, _ []string) error {
+	printCommands(ss.out)
+	return nil
+}
+
+func (ss *session) create(_ *flag.FlagSet, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: create <table> <column[:type]>...")
+	}
+	req := &protos.CreateRequest{TxId: ss.txId, Table: args[0]}
+	typed := false
+	for _, arg := range args[1:] {
+		name, typ, ok := strings.Cut(arg, ":")
+		ct := protos.ColumnType_ANY
+		if ok {
+			v, known := protos.ColumnType_value[strings.ToUpper(typ)]
+			if !known {
+				return fmt.Errorf("unknown type %q of column %s", typ, name)
+			}
+			ct, typed = protos.ColumnType(v), true
+		}
+		req.Columns = append(req.Columns, name)
+		req.Schema = append(req.Schema, &protos.ColumnSchema{Name: name, Type: ct})
+	}
+	if !typed {
+		req.Schema = nil
+	}
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	if _, err := ss.writer.Create(ctx, req); err != nil {
+		return err
+	}
+	fmt.Fprintf(ss.out, "created table %s\n", req.Table)
+	return nil
+}
+
+func (ss *session) schema(table string) (*protos.TableSchema, error) {
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	return ss.reader.DescribeTable(ctx, &protos.DescribeTableRequest{TxId: ss.txId, Table: table})
+}
+
+func (ss *session) describe(_ *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: describe <table>")
+	}
+	schema, err := ss.schema(args[0])
+	if err != nil {
+		return err
+	}
+	rows := make([][]any, len(schema.Columns))
+	for i, c := range schema.Columns {
+		rows[i] = []any{c.Name, strings.ToLower(c.Type.String())}
+	}
+	return writeTable(ss.out, []string{"column", "type"}, rows)
+}
+
+func insertFlags(fs *flag.FlagSet) {
+	fs.String("file", "", "file with rows, one json array or object per line")
+}
+
+func (ss *session) insert(fs *flag.FlagSet, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: insert [-file path] <table> [row]...")
+	}
+	table := args[0]
+	schema, err := ss.schema(table)
+	if err != nil {
+		return err
+	}
+
+	next := func() (string, error) {
+		if len(args) < 2 {
+			return "", io.EOF
+		}
+		args = args[1:]
+		return args[0], nil
+	}
+	if len(args) == 1 {
+		in := ss.in
+		path := fs.Lookup("file").Value.String()
+		switch {
+		case path != "":
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		case ss.interactive:
+			// stdin is read by the shell
+			return errors.New("rows or -file have to be given in the shell")
+		}
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, 16<<20)
+		next = func() (string, error) {
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					return line, nil
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+	}
+
+	ctx, cancel := ss.ctx(true)
+	defer cancel()
+	stream, err := ss.writer.BulkInsert(ctx)
+	if err != nil {
+		return err
+	}
+	for n := 1; ; n++ {
+		raw, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		row, err := parseRow(raw, schema.Columns)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+		if err := stream.Send(&protos.SetRequest{TxId: ss.txId, Table: table, Row: row}); err != nil {
+			// the server closed the stream, error is returned by CloseAndRecv
+			break
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if summary.Committed {
+		fmt.Fprintf(ss.out, "inserted %d rows, version %d\n", summary.Rows, summary.Version)
+	} else {
+		fmt.Fprintf(ss.out, "inserted %d rows\n", summary.Rows)
+	}
+	return nil
+}
+
+func scanFlags(fs *flag.FlagSet) {
+	fs.String("where", "", `filter like "id >= 10 AND name = 'foo'"`)
+	fs.Int64("limit", 0, "maximum number of rows, 0 prints all rows")
+	fs.String("format", "table", "output format: table, json or csv")
+}
+
+func (ss *session) scan(fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: scan [-where filter] [-limit n] [-format table|json|csv] <table>")
+	}
+	limit, err := strconv.ParseInt(fs.Lookup("limit").Value.String(), 10, 64)
+	if err != nil {
+		return err
+	}
+	format := fs.Lookup("format").Value.String()
+	w, err := newRowWriter(format, ss.out)
+	if err != nil {
+		return err
+	}
+	schema, err := ss.schema(args[0])
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(schema.Columns))
+	for i, c := range schema.Columns {
+		columns[i] = c.Name
+	}
+
+	ctx, cancel := ss.ctx(true)
+	defer cancel()
+	stream, err := ss.reader.Scan(ctx, &protos.GetRequest{
+		TxId:  ss.txId,
+		Table: args[0],
+		Where: fs.Lookup("where").Value.String(),
+		Limit: limit,
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.header(columns); err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		row, err := fromProtoRow(resp.Row)
+		if err != nil {
+			return err
+		}
+		if err := w.row(row); err != nil {
+			return err
+		}
+	}
+	return w.close()
+}
+
+func (ss *session) begin(_ *flag.FlagSet, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: begin")
+	}
+	if ss.interactive && ss.txId != nil {
+		return fmt.Errorf("transaction %d is already open", *ss.txId)
+	}
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	tx, err := ss.writer.NewTransaction(ctx, &protos.Empty{})
+	if err != nil {
+		return err
+	}
+	if ss.interactive {
+		ss.txId = &tx.TxId
+		ss.startKeepAlive(tx.TxId)
+		fmt.Fprintf(ss.out, "started transaction %d\n", tx.TxId)
+		return nil
+	}
+	fmt.Fprintln(ss.out, tx.TxId)
+	return nil
+}
+
+// finishTx returns the transaction given as argument or the current one
+func (ss *session) finishTx(name string, args []string) (*protos.Transaction, error) {
+	switch {
+	case len(args) == 1:
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction id %q", args[0])
+		}
+		return &protos.Transaction{TxId: id}, nil
+	case len(args) > 1:
+		return nil, fmt.Errorf("usage: %s [tx]", name)
+	case ss.txId == nil:
+		return nil, errors.New("no open transaction")
+	default:
+		return &protos.Transaction{TxId: *ss.txId}, nil
+	}
+}
+
+// forgetTx stops using the transaction once it is finished
+func (ss *session) forgetTx(id int64) {
+	if ss.txId == nil || *ss.txId != id {
+		return
+	}
+	ss.txId = nil
+	if ss.stopKeepAlive != nil {
+		ss.stopKeepAlive()
+		ss.stopKeepAlive = nil
+	}
+}
+
+func (ss *session) commit(_ *flag.FlagSet, args []string) error {
+	tx, err := ss.finishTx("commit", args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	// failed commit rolls the transaction back
+	_, err = ss.writer.Commit(ctx, tx)
+	ss.forgetTx(tx.TxId)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ss.out, "committed transaction %d\n", tx.TxId)
+	return nil
+}
+
+func (ss *session) rollback(_ *flag.FlagSet, args []string) error {
+	tx, err := ss.finishTx("rollback", args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	_, err = ss.writer.Rollback(ctx, tx)
+	ss.forgetTx(tx.TxId)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ss.out, "rolled back transaction %d\n", tx.TxId)
+	return nil
+}
+
+func historyFlags(fs *flag.FlagSet) {
+	fs.Int64("limit", 0, "maximum number of versions, 0 prints all versions")
+}
+
+func (ss *session) history(fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: history [-limit n] <table>")
+	}
+	limit, err := strconv.ParseInt(fs.Lookup("limit").Value.String(), 10, 64)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	resp, err := ss.reader.History(ctx, &protos.HistoryRequest{Table: args[0], Limit: limit})
+	if err != nil {
+		return err
+	}
+	rows := make([][]any, len(resp.Commits))
+	for i, c := range resp.Commits {
+		var ts any
+		if c.Timestamp != nil {
+			ts = c.Timestamp.AsTime()
+		}
+		metrics := make(map[string]string, len(c.Metrics))
+		for k, v := range c.Metrics {
+			metrics[k] = strconv.FormatInt(v, 10)
+		}
+		rows[i] = []any{c.Version, ts, c.Operation, c.ClientId, formatPairs(c.OperationParameters), formatPairs(metrics)}
+	}
+	return writeTable(ss.out, []string{"version", "timestamp", "operation", "client", "parameters", "metrics"}, rows)
+}
+
+// formatPairs prints map as key=value pairs ordered by key
+func formatPairs(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, " ")
+}
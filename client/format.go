@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// rowWriter prints scanned rows in one of the output formats
+type rowWriter interface {
+	header(columns []string) error
+	row(values []any) error
+	close() error
+}
+
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch format {
+	case "table":
+		return &tableWriter{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), out: w}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, use table, json or csv", format)
+	}
+}
+
+// writeTable prints rows aligned in columns
+func writeTable(w io.Writer, columns []string, rows [][]any) error {
+	tw, _ := newRowWriter("table", w)
+	if err := tw.header(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := tw.row(row); err != nil {
+			return err
+		}
+	}
+	return tw.close()
+}
+
+// tableWriter aligns columns, rows are flushed at the end since width of the
+// columns is known only after all rows are seen
+type tableWriter struct {
+	w    *tabwriter.Writer
+	out  io.Writer
+	rows int
+}
+
+func (tw *tableWriter) header(columns []string) error {
+	line := make([]string, len(columns))
+	for i, c := range columns {
+		line[i] = strings.Repeat("-", max(len(c), 1))
+	}
+	if err := tw.line(columns); err != nil {
+		return err
+	}
+	return tw.line(line)
+}
+
+func (tw *tableWriter) row(values []any) error {
+	line := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			line[i] = "NULL"
+			continue
+		}
+		// tabs and newlines would break the alignment
+		line[i] = strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(formatValue(v))
+	}
+	tw.rows++
+	return tw.line(line)
+}
+
+func (tw *tableWriter) line(cells []string) error {
+	_, err := fmt.Fprintln(tw.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (tw *tableWriter) close() error {
+	if err := tw.w.Flush(); err != nil {
+		return err
+	}
+	if tw.rows == 1 {
+		_, err := fmt.Fprintln(tw.out, "(1 row)")
+		return err
+	}
+	_, err := fmt.Fprintf(tw.out, "(%d rows)\n", tw.rows)
+	return err
+}
+
+// jsonWriter prints rows as json objects keyed by column names, one per line,
+// keys keep order of the columns
+type jsonWriter struct {
+	w       io.Writer
+	columns []string
+}
+
+func (jw *jsonWriter) header(columns []string) error {
+	jw.columns = columns
+	return nil
+}
+
+func (jw *jsonWriter) row(values []any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i >= len(jw.columns) {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(jw.columns[i]); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteString("}\n")
+	_, err := jw.w.Write(buf.Bytes())
+	return err
+}
+
+func (jw *jsonWriter) close() error {
+	return nil
+}
+
+// csvWriter prints header followed by rows, nulls are empty fields
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvWriter) header(columns []string) error {
+	return cw.w.Write(columns)
+}
+
+func (cw *csvWriter) row(values []any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatValue(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
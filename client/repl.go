@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deltalake/protos"
+)
+
+// _keepAliveInterval is how often the lease of the shell transaction is
+// extended, it has to be shorter than the transaction timeout of the server
+const _keepAliveInterval = 30 * time.Second
+
+// repl reads commands line by line until exit or end of input. Transaction
+// started with begin is used by the following commands until it is finished,
+// it is rolled back when the shell exits.
+func (ss *session) repl(in io.Reader) error {
+	ss.interactive = true
+	if ss.txId != nil {
+		ss.startKeepAlive(*ss.txId)
+	}
+	defer ss.exit()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16<<20)
+	for {
+		ss.prompt()
+		if !scanner.Scan() {
+			fmt.Fprintln(ss.out)
+			return scanner.Err()
+		}
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(ss.out, "error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if err := ss.run(args); err != nil {
+			fmt.Fprintf(ss.out, "error: %s\n", errorMessage(err))
+		}
+	}
+}
+
+func (ss *session) prompt() {
+	if ss.txId != nil {
+		fmt.Fprintf(ss.out, "deltactl (tx %d)> ", *ss.txId)
+		return
+	}
+	fmt.Fprint(ss.out, "deltactl> ")
+}
+
+// exit rolls back transaction left open by the shell
+func (ss *session) exit() {
+	if ss.txId == nil {
+		return
+	}
+	id := *ss.txId
+	ctx, cancel := ss.ctx(false)
+	defer cancel()
+	_, err := ss.writer.Rollback(ctx, &protos.Transaction{TxId: id})
+	ss.forgetTx(id)
+	if err != nil {
+		fmt.Fprintf(ss.out, "failed to roll back transaction %d: %s\n", id, errorMessage(err))
+		return
+	}
+	fmt.Fprintf(ss.out, "rolled back transaction %d\n", id)
+}
+
+// startKeepAlive extends lease of the transaction until stopKeepAlive is
+// called, the shell can be idle for longer than the transaction timeout
+func (ss *session) startKeepAlive(id int64) {
+	stop := make(chan struct{})
+	ss.stopKeepAlive = func() { close(stop) }
+	go func() {
+		ticker := time.NewTicker(_keepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := ss.ctx(false)
+				_, err := ss.writer.KeepAlive(ctx, &protos.Transaction{TxId: id})
+				cancel()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// splitArgs splits the line on spaces, quoted parts are kept together.
+// Single quotes keep the text as it is, backslash escapes the next character
+// outside of single quotes.
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	var (
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deltalake/protos"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// parseRow converts json array of values or object keyed by column names to
+// a row of the table. Bytes are base64 encoded, timestamps use RFC 3339.
+func parseRow(raw string, columns []*protos.ColumnSchema) (*protos.Row, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after row %s", raw)
+	}
+
+	values := make([]any, len(columns))
+	switch v := v.(type) {
+	case []any:
+		if len(v) > len(columns) {
+			return nil, fmt.Errorf("row has %d values, table has %d columns", len(v), len(columns))
+		}
+		copy(values, v)
+	case map[string]any:
+		for name, value := range v {
+			i := columnIndex(columns, name)
+			if i < 0 {
+				return nil, fmt.Errorf("unknown column %s", name)
+			}
+			values[i] = value
+		}
+	default:
+		return nil, fmt.Errorf("row has to be json array or object, got %s", raw)
+	}
+
+	row := &protos.Row{Values: make([]*protos.Value, len(columns))}
+	for i, c := range columns {
+		pv, err := toProtoValue(values[i], c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
+		}
+		row.Values[i] = pv
+	}
+	return row, nil
+}
+
+func columnIndex(columns []*protos.ColumnSchema, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// toProtoValue converts decoded json value to the column type, values of
+// untyped columns keep their json type
+func toProtoValue(v any, ct protos.ColumnType) (*protos.Value, error) {
+	if v == nil {
+		return &protos.Value{Kind: &protos.Value_NullValue{}}, nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("cannot use %v as %s", v, strings.ToLower(ct.String()))
+	}
+	switch ct {
+	case protos.ColumnType_ANY:
+		switch v := v.(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return &protos.Value{Kind: &protos.Value_Int64Value{Int64Value: i}}, nil
+			}
+			return toProtoValue(v, protos.ColumnType_DOUBLE)
+		case bool:
+			return toProtoValue(v, protos.ColumnType_BOOL)
+		case string:
+			return toProtoValue(v, protos.ColumnType_STRING)
+		case []any:
+			return toProtoValue(v, protos.ColumnType_LIST)
+		case map[string]any:
+			return toProtoValue(v, protos.ColumnType_STRUCT)
+		}
+	case protos.ColumnType_BOOL:
+		if b, ok := v.(bool); ok {
+			return &protos.Value{Kind: &protos.Value_BoolValue{BoolValue: b}}, nil
+		}
+	case protos.ColumnType_INT64:
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				return nil, mismatch()
+			}
+			return &protos.Value{Kind: &protos.Value_Int64Value{Int64Value: i}}, nil
+		}
+	case protos.ColumnType_DOUBLE:
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			if err != nil {
+				return nil, mismatch()
+			}
+			return &protos.Value{Kind: &protos.Value_DoubleValue{DoubleValue: f}}, nil
+		}
+	case protos.ColumnType_STRING:
+		if s, ok := v.(string); ok {
+			return &protos.Value{Kind: &protos.Value_StringValue{StringValue: s}}, nil
+		}
+	case protos.ColumnType_BYTES:
+		if s, ok := v.(string); ok {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64: %w", err)
+			}
+			return &protos.Value{Kind: &protos.Value_BytesValue{BytesValue: b}}, nil
+		}
+	case protos.ColumnType_TIMESTAMP:
+		if s, ok := v.(string); ok {
+			ts, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, err
+			}
+			return &protos.Value{Kind: &protos.Value_TimestampValue{TimestampValue: timestamppb.New(ts)}}, nil
+		}
+	case protos.ColumnType_DECIMAL:
+		switch d := v.(type) {
+		case json.Number:
+			return &protos.Value{Kind: &protos.Value_DecimalValue{DecimalValue: &protos.Decimal{Value: d.String()}}}, nil
+		case string:
+			return &protos.Value{Kind: &protos.Value_DecimalValue{DecimalValue: &protos.Decimal{Value: d}}}, nil
+		}
+	case protos.ColumnType_LIST:
+		if l, ok := v.([]any); ok {
+			values := make([]*protos.Value, len(l))
+			for i, e := range l {
+				pv, err := toProtoValue(e, protos.ColumnType_ANY)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = pv
+			}
+			return &protos.Value{Kind: &protos.Value_ListValue{ListValue: &protos.ListValue{Values: values}}}, nil
+		}
+	case protos.ColumnType_STRUCT:
+		if m, ok := v.(map[string]any); ok {
+			fields := make(map[string]*protos.Value, len(m))
+			for k, e := range m {
+				pv, err := toProtoValue(e, protos.ColumnType_ANY)
+				if err != nil {
+					return nil, err
+				}
+				fields[k] = pv
+			}
+			return &protos.Value{Kind: &protos.Value_StructValue{StructValue: &protos.StructValue{Fields: fields}}}, nil
+		}
+	}
+	return nil, mismatch()
+}
+
+func fromProtoRow(row *protos.Row) ([]any, error) {
+	values := make([]any, len(row.GetValues()))
+	for i, v := range row.GetValues() {
+		value, err := fromProtoValue(v)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// fromProtoValue returns values which encode to json the way parseRow
+// expects them, decimals are kept as json numbers
+func fromProtoValue(v *protos.Value) (any, error) {
+	switch k := v.GetKind().(type) {
+	case nil, *protos.Value_NullValue:
+		return nil, nil
+	case *protos.Value_BoolValue:
+		return k.BoolValue, nil
+	case *protos.Value_Int64Value:
+		return k.Int64Value, nil
+	case *protos.Value_DoubleValue:
+		return k.DoubleValue, nil
+	case *protos.Value_StringValue:
+		return k.StringValue, nil
+	case *protos.Value_BytesValue:
+		return k.BytesValue, nil
+	case *protos.Value_TimestampValue:
+		if err := k.TimestampValue.CheckValid(); err != nil {
+			return nil, err
+		}
+		return k.TimestampValue.AsTime(), nil
+	case *protos.Value_DecimalValue:
+		return json.Number(k.DecimalValue.GetValue()), nil
+	case *protos.Value_ListValue:
+		values := make([]any, len(k.ListValue.GetValues()))
+		for i, e := range k.ListValue.GetValues() {
+			value, err := fromProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *protos.Value_StructValue:
+		fields := make(map[string]any, len(k.StructValue.GetFields()))
+		for name, e := range k.StructValue.GetFields() {
+			value, err := fromProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		}
+		return fields, nil
+	default:
+		return nil, fmt.Errorf("unsupported value kind %T", k)
+	}
+}
+
+// formatValue returns text of the value printed in table and csv output
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []any, map[string]any:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return fmt.Sprint(v)
+		}
+		return strings.TrimSuffix(buf.String(), "\n")
+	default:
+		return fmt.Sprint(v)
+	}
+}
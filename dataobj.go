@@ -1,12 +1,12 @@
 package deltalake
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-)
-
-const (
-	_dataObjectSize = 1024
+	"io"
+	"time"
 )
 
 type dataObject struct {
@@ -18,17 +18,18 @@ type dataObject struct {
 	fileName string
 }
 
-func (do *dataObject) persist(objStorage ObjectStorage) error {
+// persist writes the data object and returns its size in bytes
+func (do *dataObject) persist(objStorage ObjectStorage) (int64, error) {
 	raw, err := json.Marshal(do)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	err = objStorage.Write(do.generateFileName(), raw)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return int64(len(raw)), nil
 }
 
 func (do *dataObject) generateFileName() string {
@@ -38,3 +39,230 @@ func (do *dataObject) generateFileName() string {
 	do.fileName = fmt.Sprintf("_table_%s_%s", do.Table, do.Id)
 	return do.fileName
 }
+
+// encodedSize estimates bytes the row takes in the persisted data object, it
+// sizes data objects without encoding the rows
+func encodedSize(row []any) int64 {
+	size := int64(2 + len(row)) // brackets, separators and the row separator
+	for _, v := range row {
+		size += encodedValueSize(v)
+	}
+	return size
+}
+
+func encodedValueSize(v any) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 4
+	case bool:
+		return 5
+	case string:
+		return 2 + int64(len(v))
+	case Decimal:
+		return 2 + int64(len(v))
+	case []byte:
+		return 2 + int64(base64.StdEncoding.EncodedLen(len(v)))
+	case time.Time:
+		return 37 // quoted RFC 3339 with nanoseconds and offset
+	case int64:
+		return digits(v)
+	case int:
+		return digits(int64(v))
+	case []any:
+		return encodedSize(v)
+	case map[string]any:
+		size := int64(1 + len(v))
+		for k, fv := range v {
+			size += 3 + int64(len(k)) + encodedValueSize(fv)
+		}
+		return size
+	default:
+		return 20
+	}
+}
+
+func digits(n int64) int64 {
+	size := int64(1)
+	if n < 0 {
+		size++
+	}
+	for n /= 10; n != 0; n /= 10 {
+		size++
+	}
+	return size
+}
+
+// rowReader returns rows one by one, io.EOF is returned after the last row
+type rowReader interface {
+	next() ([]any, error)
+	close() error
+}
+
+type sliceRowReader struct {
+	rows [][]any
+	pos  int
+}
+
+func newSliceRowReader(rows [][]any) *sliceRowReader {
+	return &sliceRowReader{rows: rows}
+}
+
+func (sr *sliceRowReader) next() ([]any, error) {
+	if sr.pos >= len(sr.rows) {
+		return nil, io.EOF
+	}
+	row := sr.rows[sr.pos]
+	sr.pos++
+	return row, nil
+}
+
+func (sr *sliceRowReader) close() error {
+	return nil
+}
+
+// dataObjectReader decodes persisted data object incrementally so files
+// larger than available memory can be scanned.
+type dataObjectReader struct {
+	rc    io.ReadCloser
+	dec   *json.Decoder
+	table string
+
+	inData bool
+	done   bool
+}
+
+func newDataObjectReader(rc io.ReadCloser, table string) (*dataObjectReader, error) {
+	dr := &dataObjectReader{
+		rc:    rc,
+		dec:   json.NewDecoder(rc),
+		table: table,
+	}
+	// float64 can't keep all int64 values, numbers are converted by schema
+	dr.dec.UseNumber()
+	if err := dr.expectDelim('{'); err != nil {
+		return nil, err
+	}
+	if err := dr.seekData(); err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+// seekData moves decoder to the first row of the Data array validating
+// fields encountered on the way
+func (dr *dataObjectReader) seekData() error {
+	tableChecked := false
+	for dr.dec.More() {
+		tok, err := dr.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v in data object", tok)
+		}
+		switch key {
+		case "Table":
+			var table string
+			if err := dr.dec.Decode(&table); err != nil {
+				return err
+			}
+			if table != dr.table {
+				return errors.New("wrong data object read")
+			}
+			tableChecked = true
+		case "Data":
+			if !tableChecked {
+				return errors.New("data object table not set before data")
+			}
+			tok, err := dr.dec.Token()
+			if err != nil {
+				return err
+			}
+			if tok == nil { // no rows
+				continue
+			}
+			if tok != json.Delim('[') {
+				return fmt.Errorf("unexpected token %v in data object", tok)
+			}
+			dr.inData = true
+			return nil
+		default:
+			var skip json.RawMessage
+			if err := dr.dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	dr.done = true
+	return nil
+}
+
+func (dr *dataObjectReader) next() ([]any, error) {
+	if dr.done || !dr.inData {
+		return nil, io.EOF
+	}
+	if !dr.dec.More() {
+		dr.done = true
+		return nil, io.EOF
+	}
+	var row []any
+	if err := dr.dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (dr *dataObjectReader) expectDelim(d json.Delim) error {
+	tok, err := dr.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("unexpected token %v in data object, expected %v", tok, d)
+	}
+	return nil
+}
+
+func (dr *dataObjectReader) close() error {
+	return dr.rc.Close()
+}
+
+// cachingRowReader stores rows of the file in the row cache once it was read
+// completely, files not fitting into the cache are not collected.
+type cachingRowReader struct {
+	rowReader
+	cache *rowCache
+	file  string
+
+	rows     [][]any
+	overflow bool
+}
+
+func newCachingRowReader(rd rowReader, cache *rowCache, file string) *cachingRowReader {
+	return &cachingRowReader{
+		rowReader: rd,
+		cache:     cache,
+		file:      file,
+	}
+}
+
+func (cr *cachingRowReader) next() ([]any, error) {
+	row, err := cr.rowReader.next()
+	if errors.Is(err, io.EOF) && !cr.overflow {
+		cr.cache.add(cr.file, cr.rows)
+		cr.overflow = true // add only once
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !cr.overflow {
+		if int64(len(cr.rows)) >= cr.cache.cache.capacity {
+			cr.overflow = true
+			cr.rows = nil
+		} else {
+			cr.rows = append(cr.rows, row)
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,79 @@
+package deltalake
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllRows(t *testing.T, rd rowReader) [][]any {
+	rows := make([][]any, 0)
+	for {
+		row, err := rd.next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		assert.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestDataObjectReader(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  string
+		rows [][]any
+		err  bool
+	}{
+		{
+			name: "rows",
+			raw:  `{"Id":"1","Table":"foo","Data":[["a",1],["b",2]],"Size":2}`,
+			rows: [][]any{{"a", json.Number("1")}, {"b", json.Number("2")}},
+		},
+		{
+			name: "null data",
+			raw:  `{"Id":"1","Table":"foo","Data":null,"Size":0}`,
+			rows: [][]any{},
+		},
+		{
+			name: "wrong table",
+			raw:  `{"Id":"1","Table":"bar","Data":[["a"]],"Size":1}`,
+			err:  true,
+		},
+		{
+			name: "table after data",
+			raw:  `{"Data":[["a"]],"Table":"foo"}`,
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rd, err := newDataObjectReader(io.NopCloser(strings.NewReader(tc.raw)), "foo")
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.rows, readAllRows(t, rd))
+			assert.NoError(t, rd.close())
+		})
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	row := []any{
+		nil, true, int64(-1234), 42, 1.5, "foo", Decimal("12.50"), []byte("bytes"),
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		[]any{int64(1), "a"}, map[string]any{"k": int64(10)},
+	}
+	raw, err := json.Marshal(row)
+	require.NoError(t, err)
+	assert.InDelta(t, len(raw), encodedSize(row), 40)
+	assert.EqualValues(t, len("-1234"), digits(-1234))
+	assert.EqualValues(t, 1, digits(0))
+}
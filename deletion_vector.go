@@ -0,0 +1,176 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/google/uuid"
+)
+
+// PropertyEnableDeletionVectors set to "true" makes Delete mark deleted rows
+// in deletion vectors instead of rewriting data objects
+const PropertyEnableDeletionVectors = "delta.enableDeletionVectors"
+
+// deletionVector references bitmap of positions of deleted rows of a data
+// object, the bitmap is stored in the portable roaring serialization format
+type deletionVector struct {
+	File        string
+	Cardinality int64
+}
+
+func (t *table) deletionVectorsEnabled() bool {
+	return t.properties[PropertyEnableDeletionVectors] == "true"
+}
+
+func (t *table) loadDeletionVector(dv *deletionVector) (*roaring.Bitmap, error) {
+	rc, err := t.externalStorage.Read(dv.File)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	deleted := roaring.New()
+	if err := deleted.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("invalid deletion vector %s: %w", dv.File, err)
+	}
+	return deleted, nil
+}
+
+// removeAction removes the data object together with its deletion vector
+func (t *table) removeAction(file string) *dataObjectAction {
+	ao := newDataObjAction(t.name, file, _remove)
+	ao.DeletionVector = t.deletionVectors[file]
+	return ao
+}
+
+// maskedRowReader skips rows at positions of the deletion vector
+type maskedRowReader struct {
+	rowReader
+	deleted *roaring.Bitmap
+	pos     uint32
+}
+
+func (mr *maskedRowReader) next() ([]any, error) {
+	for {
+		row, err := mr.rowReader.next()
+		if err != nil {
+			return nil, err
+		}
+		pos := mr.pos
+		mr.pos++
+		if !mr.deleted.Contains(pos) {
+			return row, nil
+		}
+	}
+}
+
+// deleteWithVectors marks rows matching the condition as deleted in deletion
+// vectors of the files, files with all rows deleted are removed. It returns
+// the changes for the change data feed and the number of deleted rows.
+func (tx *Transaction) deleteWithVectors(t *table, files []string, cond evalFunc) ([][]any, int64, error) {
+	changes := make([][]any, 0)
+	var n int64
+	removed := make([]string, 0)
+	for _, f := range files {
+		deleted := roaring.New()
+		if dv, ok := t.deletionVectors[f]; ok {
+			var err error
+			if deleted, err = t.loadDeletionVector(dv); err != nil {
+				return nil, 0, err
+			}
+		}
+		marked, total, err := t.markRows(f, deleted, cond, func(row []any) {
+			changes = append(changes, withChangeType(row, ChangeDelete))
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		if marked == 0 {
+			continue
+		}
+		n += marked
+		// file already marked by the transaction is replaced by its add
+		pending := slices.IndexFunc(tx.actions, func(a action) bool {
+			ao, ok := a.(*dataObjectAction)
+			return ok && ao.Action == _add && ao.Table == t.name && ao.File == f
+		})
+		if pending >= 0 {
+			tx.actions = slices.Delete(tx.actions, pending, pending+1)
+		} else {
+			tx.actions = append(tx.actions, t.removeAction(f))
+		}
+		if int64(deleted.GetCardinality()) == total {
+			removed = append(removed, f)
+			continue
+		}
+
+		dv := &deletionVector{
+			File:        fmt.Sprintf("_dv_%s_%s", t.name, uuid.NewString()),
+			Cardinality: int64(deleted.GetCardinality()),
+		}
+		raw, err := deleted.ToBytes()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := tx.d.internalStorage.Write(dv.File, raw); err != nil {
+			return nil, 0, err
+		}
+		ao := newDataObjAction(t.name, f, _add)
+		ao.Stats = t.stats[f]
+		ao.DeletionVector = dv
+		tx.actions = append(tx.actions, ao)
+		if t.deletionVectors == nil {
+			t.deletionVectors = make(map[string]*deletionVector)
+		}
+		t.deletionVectors[f] = dv
+	}
+	for _, f := range removed {
+		delete(t.stats, f)
+		delete(t.deletionVectors, f)
+	}
+	t.files = slices.DeleteFunc(slices.Clone(t.files), func(f string) bool { return slices.Contains(removed, f) })
+	return changes, n, nil
+}
+
+// markRows adds positions of rows of the file matching the condition to the
+// bitmap of deleted rows, rows deleted before are skipped. It returns the
+// number of newly marked rows and the number of all rows of the file.
+func (t *table) markRows(file string, deleted *roaring.Bitmap, cond evalFunc, onMarked func(row []any)) (int64, int64, error) {
+	rd, err := t.openRawFile(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rd.close()
+	var marked, total int64
+	for ; ; total++ {
+		row, err := rd.next()
+		if errors.Is(err, io.EOF) {
+			return marked, total, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		pos := uint32(total)
+		if deleted.Contains(pos) {
+			continue
+		}
+		if row, err = t.schema.decode(row); err != nil {
+			return 0, 0, err
+		}
+		ok, err := isTrue(cond, row)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ok {
+			deleted.Add(pos)
+			marked++
+			onMarked(row)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package deltalake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeletionVectors(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}}))
+	require.NoError(t, tx.SetTableProperty("foo", PropertyEnableDeletionVectors, "true"))
+	require.NoError(t, tx.SetTableProperty("foo", PropertyEnableChangeDataFeed, "true"))
+	require.NoError(t, tx.Commit())
+	for _, ids := range [][]int{{1, 2, 3, 4}, {5, 6}} {
+		tx = cl.NewTransaction()
+		for _, id := range ids {
+			require.NoError(t, tx.Put("foo", []any{id}))
+		}
+		require.NoError(t, tx.Commit())
+	}
+	ids := func(tx *Transaction) [][]any {
+		_, rows := queryRows(t, tx, "SELECT id FROM foo ORDER BY id")
+		return rows
+	}
+
+	tx = cl.NewTransaction()
+	files := tx.tables["foo"].files
+	n, err := tx.Delete("foo", "id = 2 OR id = 5")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	n, err = tx.Delete("foo", "id = 3")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	foo := tx.tables["foo"]
+	// data objects are not rewritten
+	assert.ElementsMatch(t, files, foo.files)
+	require.Len(t, foo.deletionVectors, 2)
+	assert.EqualValues(t, 2, foo.deletionVectors[files[1]].Cardinality)
+	deleted, err := foo.loadDeletionVector(foo.deletionVectors[files[1]])
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2}, deleted.ToArray())
+	assert.Equal(t, [][]any{{int64(1)}, {int64(4)}, {int64(6)}}, ids(tx))
+	changes := collectRows(t, mustChanges(t, tx, 3))
+	require.Len(t, changes, 3)
+	assert.Equal(t, []any{int64(2), ChangeDelete}, changes[0][:2])
+
+	// data object with all rows deleted is removed
+	_, err = tx.Delete("foo", "id = 6")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	history, err := cl.History("foo", 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"numFiles": 0, "numOutputRows": 0, "numRemovedFiles": 1, "numDeletedRows": 1},
+		history[0].Metrics)
+	assert.Equal(t, map[string]int64{"numFiles": 2, "numOutputRows": 3, "numRemovedFiles": 2, "numDeletedRows": 3},
+		history[1].Metrics)
+
+	// restore brings back rows marked in deletion vectors
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 2))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	assert.Len(t, ids(tx), 6)
+	require.NoError(t, tx.Rollback())
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 3))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Optimize("foo"))
+	assert.Len(t, tx.tables["foo"].files, 1)
+	assert.Empty(t, tx.tables["foo"].deletionVectors)
+	require.NoError(t, tx.Commit())
+	history, err = cl.History("foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "OPTIMIZE", history[0].Operation)
+	assert.EqualValues(t, 3, history[0].Metrics["numPurgedRows"])
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	assert.Equal(t, [][]any{{int64(1)}, {int64(4)}, {int64(6)}}, ids(tx))
+	require.Len(t, tx.tables["foo"].files, 1)
+	assert.Empty(t, tx.tables["foo"].deletionVectors)
+	// optimized table has nothing to compact
+	require.NoError(t, tx.Optimize("foo"))
+	assert.Empty(t, tx.actions)
+	assert.ErrorIs(t, tx.Optimize("missing"), ErrTableNotFound)
+}
+
+func mustChanges(t *testing.T, tx *Transaction, version int64) Iterator {
+	it, err := tx.TableChanges("foo", version, version)
+	require.NoError(t, err)
+	t.Cleanup(func() { it.Close() })
+	return it
+}
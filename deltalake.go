@@ -1,25 +1,62 @@
 package deltalake
 
+import (
+	"context"
+	"iter"
+	"sync"
+	"time"
+)
+
 type DeltaStorage interface {
 	NewTransaction() *Transaction
+	RowCacheStats() CacheStats
+	// History returns commits which changed the table, newest first. At
+	// most limit commits are returned, limit <= 0 returns all of them.
+	History(table string, limit int) ([]CommitInfo, error)
+	// Watch returns versions which changed rows of the table starting from
+	// fromVersion, versions of Optimize are skipped. New versions are awaited
+	// by polling the log until ctx is done. ErrTableNotFound is returned when
+	// the table isn't in the log. Iteration stops after the first error.
+	Watch(ctx context.Context, table string, fromVersion int64) iter.Seq2[*TableVersion, error]
+	// Close waits for background compactions, commits afterwards don't start
+	// new ones.
+	Close()
 }
 
+// Iterator returns rows of the table, ErrIteratorExhausted is returned after
+// the last row. Close has to be called to release underlying files.
 type Iterator interface {
 	First() ([]any, error)
 	Next() ([]any, error)
+	Close() error
 }
 
 type delta struct {
 	internalStorage ObjectStorage
+	log             LogStore
+
+	opts    *Opts
+	rows    *rowCache      // decoded data objects shared across transactions
+	buffers *bufferManager // rows buffered by transactions
 
-	opts *Opts
-	// todo: table cache
+	compactMu   sync.Mutex
+	compacting  map[string]bool // tables compacted in the background
+	compactions sync.WaitGroup
+	closed      bool
 }
 
 func New(objstorage ObjectStorage, opt *Opts) DeltaStorage {
+	log := opt.LogStore
+	if log == nil {
+		log = NewObjectLogStore(objstorage)
+	}
 	return &delta{
 		internalStorage: objstorage,
+		log:             log,
 		opts:            opt,
+		rows:            newRowCache(opt.RowCacheSize),
+		buffers:         newBufferManager(opt.MemoryBudget, opt.FlushWorkers),
+		compacting:      make(map[string]bool),
 	}
 }
 
@@ -27,12 +64,66 @@ func (d *delta) NewTransaction() *Transaction {
 	return newTransaction(d)
 }
 
+func (d *delta) RowCacheStats() CacheStats {
+	return d.rows.stats()
+}
+
+func (d *delta) Close() {
+	d.compactMu.Lock()
+	d.closed = true
+	d.compactMu.Unlock()
+	d.compactions.Wait()
+}
+
 type Opts struct {
+	// MaxMemoryBufferSz limits rows of a data object, 0 is unlimited.
 	MaxMemoryBufferSz int
+	// TargetFileSizeBytes is the size data objects written by Put and
+	// Optimize approach, buffered rows are flushed before their estimated
+	// size exceeds it. 0 is unlimited.
+	TargetFileSizeBytes int64
+	// LogStore overrides where the transaction log is kept. By default the log
+	// is written to the object storage which has to support put-if-absent.
+	LogStore LogStore
+	// RowCacheSize is the number of decoded rows kept in memory across
+	// transactions, 0 disables the cache. Cached rows must not be modified.
+	RowCacheSize int
+	// ClientId is recorded in commit info of the transactions, it can be
+	// changed per transaction with SetClientId.
+	ClientId string
+	// MemoryBudget is the number of bytes of rows buffered by all
+	// transactions, Put blocks until buffers are flushed once it is
+	// exhausted. 0 disables the limit.
+	MemoryBudget int64
+	// MemoryWaitTimeout limits how long Put waits for buffers of other
+	// transactions to be flushed before it fails with
+	// ErrMemoryBudgetExceeded. 0 waits until the context is done.
+	MemoryWaitTimeout time.Duration
+	// FlushWorkers is the number of data objects written in the background
+	// while Put continues, 0 flushes buffers synchronously in Put.
+	FlushWorkers int
+	// AutoCompactMinFiles is the number of data objects smaller than
+	// TargetFileSizeBytes a table with auto optimization enabled has to
+	// exceed before commits compact it.
+	AutoCompactMinFiles int
 }
 
 func DefaultOpts() *Opts {
 	return &Opts{
-		MaxMemoryBufferSz: 10000,
+		MaxMemoryBufferSz:   10000,
+		TargetFileSizeBytes: 32 << 20,
+		MemoryWaitTimeout:   10 * time.Second,
+		AutoCompactMinFiles: 50,
+	}
+}
+
+// objectFull reports whether the next row doesn't fit into data object of
+// rows, size includes the next row. A single row always fits. Optimized
+// writes are split only by size.
+func (o *Opts) objectFull(rows int, size int64, optimizeWrite bool) bool {
+	if rows == 0 {
+		return false
 	}
+	return (!optimizeWrite && o.MaxMemoryBufferSz > 0 && rows >= o.MaxMemoryBufferSz) ||
+		(o.TargetFileSizeBytes > 0 && size > o.TargetFileSizeBytes)
 }
@@ -0,0 +1,316 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Delete removes rows of the table matching the SQL condition, empty where
+// deletes all rows. Data objects with matching rows are rewritten without
+// them or, with deletion vectors enabled for the table, the rows are marked
+// deleted. Objects which can't contain matching rows by their stats are not
+// read. Rows put in the transaction are not affected, later reads of the
+// transaction see the rows deleted.
+func (tx *Transaction) Delete(table, where string) (int64, error) {
+	t, ok := tx.tables[table]
+	if !ok {
+		return 0, tableError(table, ErrTableNotFound)
+	}
+	sc := tableScope(t)
+	cond, preds, err := compileCondition(where, sc)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		changes [][]any
+		n       int64
+	)
+	if t.deletionVectorsEnabled() {
+		changes, n, err = tx.deleteWithVectors(t, t.prune(preds).files, cond)
+	} else {
+		changes, n, err = tx.rewrite(t, t.prune(preds).files, func(row []any) ([]any, bool, error) {
+			ok, err := isTrue(cond, row)
+			return nil, ok, err
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.recordChanges(t, changes); err != nil {
+		return 0, err
+	}
+	tx.setOperation("DELETE", map[string]string{"predicate": where})
+	tx.addMetric("numDeletedRows", n)
+	return n, nil
+}
+
+// Update sets columns of rows matching the SQL condition to values of the SQL
+// expressions computed from the original row, empty where updates all rows.
+// Data objects are rewritten same as by Delete.
+func (tx *Transaction) Update(table string, set map[string]string, where string) (int64, error) {
+	t, ok := tx.tables[table]
+	if !ok {
+		return 0, tableError(table, ErrTableNotFound)
+	}
+	sc := tableScope(t)
+	cond, preds, err := compileCondition(where, sc)
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]int, 0, len(set))
+	values := make([]evalFunc, 0, len(set))
+	for name, text := range set {
+		idx := slices.IndexFunc(t.schema, func(c Column) bool { return c.Name == name })
+		if idx < 0 {
+			return 0, tableError(table, fmt.Errorf("%w %s", ErrUnknownColumn, name))
+		}
+		e, err := parseExpression(text)
+		if err != nil {
+			return 0, err
+		}
+		value, err := (&compiler{scope: sc}).compile(e)
+		if err != nil {
+			return 0, err
+		}
+		columns = append(columns, idx)
+		values = append(values, value)
+	}
+
+	changes, n, err := tx.rewrite(t, t.prune(preds).files, func(row []any) ([]any, bool, error) {
+		if ok, err := isTrue(cond, row); !ok || err != nil {
+			return row, false, err
+		}
+		updated := slices.Clone(row)
+		for i, idx := range columns {
+			v, err := values[i](row)
+			if err != nil {
+				return nil, false, err
+			}
+			if updated[idx], err = coerceValue(t.schema[idx].Type, v); err != nil {
+				return nil, false, tableError(table, fmt.Errorf("%w: column %s: %v", ErrSchemaMismatch, t.schema[idx].Name, err))
+			}
+		}
+		return updated, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.recordChanges(t, changes); err != nil {
+		return 0, err
+	}
+	tx.setOperation("UPDATE", map[string]string{"predicate": where})
+	tx.addMetric("numUpdatedRows", n)
+	return n, nil
+}
+
+// Merge upserts the rows into the table, rows of the table with the same
+// values of the key columns are replaced by them and the rest is inserted.
+// Rows with null keys match nothing. Same as for Update, later reads of the
+// transaction see the merged rows. It returns the number of updated and
+// inserted rows.
+func (tx *Transaction) Merge(table string, rows [][]any, keys []string) (int64, int64, error) {
+	t, ok := tx.tables[table]
+	if !ok {
+		return 0, 0, tableError(table, ErrTableNotFound)
+	}
+	if len(keys) == 0 {
+		return 0, 0, tableError(table, errors.New("merge requires key columns"))
+	}
+	keyIdx := make([]int, len(keys))
+	for i, k := range keys {
+		keyIdx[i] = slices.IndexFunc(t.schema, func(c Column) bool { return c.Name == k })
+		if keyIdx[i] < 0 {
+			return 0, 0, tableError(table, fmt.Errorf("%w %s", ErrUnknownColumn, k))
+		}
+	}
+	key := func(row []any) (string, bool) {
+		values := make([]any, len(keyIdx))
+		for i, idx := range keyIdx {
+			if row[idx] == nil {
+				return "", false
+			}
+			values[i] = row[idx]
+		}
+		return compositeKey(values), true
+	}
+
+	source := make([][]any, len(rows))
+	byKey := make(map[string]int, len(rows))
+	for i, row := range rows {
+		coerced, err := t.schema.coerce(row)
+		if err != nil {
+			return 0, 0, tableError(table, err)
+		}
+		source[i] = coerced
+		k, ok := key(coerced)
+		if !ok {
+			continue
+		}
+		if _, dup := byKey[k]; dup {
+			return 0, 0, tableError(table, fmt.Errorf("multiple merged rows with key %v", coerced[keyIdx[0]]))
+		}
+		byKey[k] = i
+	}
+
+	matched := make([]bool, len(source))
+	changes, updated, err := tx.rewrite(t, t.files, func(row []any) ([]any, bool, error) {
+		k, ok := key(row)
+		if !ok {
+			return row, false, nil
+		}
+		i, ok := byKey[k]
+		if !ok {
+			return row, false, nil
+		}
+		matched[i] = true
+		return source[i], true, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	inserted := make([][]any, 0)
+	for i, row := range source {
+		if !matched[i] {
+			inserted = append(inserted, row)
+			changes = append(changes, withChangeType(row, ChangeInsert))
+		}
+	}
+	if len(inserted) > 0 {
+		ao, err := tx.writeDataObject(table, inserted)
+		if err != nil {
+			return 0, 0, err
+		}
+		t.addFile(ao)
+	}
+	if err := tx.recordChanges(t, changes); err != nil {
+		return 0, 0, err
+	}
+	tx.setOperation("MERGE", map[string]string{"keys": strings.Join(keys, ",")})
+	tx.addMetric("numTargetRowsUpdated", updated)
+	tx.addMetric("numTargetRowsInserted", int64(len(inserted)))
+	return updated, int64(len(inserted)), nil
+}
+
+func tableScope(t *table) scope {
+	sc := make(scope, len(t.schema))
+	for i, c := range t.schema {
+		sc[i] = scopeColumn{table: t.name, name: c.Name}
+	}
+	return sc
+}
+
+// compileCondition compiles the condition of Delete or Update together with
+// the predicates skipping data objects, empty condition matches all rows
+func compileCondition(where string, sc scope) (evalFunc, []statsPredicate, error) {
+	if where == "" {
+		return func([]any) (any, error) { return true, nil }, nil, nil
+	}
+	e, err := parseExpression(where)
+	if err != nil {
+		return nil, nil, err
+	}
+	cond, err := (&compiler{scope: sc}).compile(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	preds := make([]statsPredicate, 0)
+	for _, c := range conjuncts(e) {
+		if _, p, ok := conjunctPredicate(c); ok {
+			preds = append(preds, p)
+		}
+	}
+	return cond, preds, nil
+}
+
+// rewrite replaces data objects with rows changed by fn with copies holding
+// the new rows, fn returns nil row for deleted rows. It returns the changes
+// for the change data feed and the number of changed rows.
+func (tx *Transaction) rewrite(t *table, files []string, fn func(row []any) ([]any, bool, error)) ([][]any, int64, error) {
+	changes := make([][]any, 0)
+	var n int64
+	removed := make([]string, 0)
+	added := make([]*dataObjectAction, 0)
+	for _, f := range files {
+		rd, err := t.openFile(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		rows := make([][]any, 0)
+		changed := false
+		for {
+			row, err := rd.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rd.close()
+				return nil, 0, err
+			}
+			res, ok, err := fn(row)
+			if err != nil {
+				rd.close()
+				return nil, 0, err
+			}
+			if !ok {
+				rows = append(rows, row)
+				continue
+			}
+			changed = true
+			n++
+			if res == nil {
+				changes = append(changes, withChangeType(row, ChangeDelete))
+				continue
+			}
+			rows = append(rows, res)
+			changes = append(changes,
+				withChangeType(row, ChangeUpdatePreimage), withChangeType(res, ChangeUpdatePostimage))
+		}
+		if err := rd.close(); err != nil {
+			return nil, 0, err
+		}
+		if !changed {
+			continue
+		}
+		removed = append(removed, f)
+		if len(rows) > 0 {
+			ao, err := tx.writeDataObject(t.name, rows)
+			if err != nil {
+				return nil, 0, err
+			}
+			added = append(added, ao)
+		}
+	}
+
+	// later operations of the transaction work on the rewritten files
+	for _, f := range removed {
+		tx.actions = append(tx.actions, t.removeAction(f))
+		delete(t.stats, f)
+		delete(t.deletionVectors, f)
+	}
+	t.files = slices.DeleteFunc(slices.Clone(t.files), func(f string) bool { return slices.Contains(removed, f) })
+	for _, ao := range added {
+		t.addFile(ao)
+	}
+	return changes, n, nil
+}
+
+// addFile makes data object added by the transaction part of the table
+func (t *table) addFile(ao *dataObjectAction) {
+	t.files = append(t.files, ao.File)
+	if t.stats == nil {
+		t.stats = make(map[string]*fileStats)
+	}
+	t.stats[ao.File] = ao.Stats
+}
+
+// recordChanges writes the changes when the table has change data feed
+// enabled
+func (tx *Transaction) recordChanges(t *table, changes [][]any) error {
+	if !t.changeDataFeed() {
+		return nil
+	}
+	return tx.writeChanges(t.name, changes)
+}
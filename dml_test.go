@@ -0,0 +1,88 @@
+package deltalake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUpdate(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 3, 4)
+
+	tx := cl.NewTransaction()
+	n, err := tx.Delete("foo", "file = 1 AND row >= 2")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+	n, err = tx.Update("foo", map[string]string{"row": "row * 10"}, "file = 2")
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, n)
+	// deleted rows are already gone for the following operations
+	n, err = tx.Delete("foo", "file = 1 AND row >= 2")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	_, rows := queryRows(t, tx, "SELECT file, row FROM foo ORDER BY file, row")
+	assert.Equal(t, [][]any{
+		{0.0, 0.0}, {0.0, 1.0}, {0.0, 2.0}, {0.0, 3.0},
+		{1.0, 0.0}, {1.0, 1.0},
+		{2.0, 0.0}, {2.0, 10.0}, {2.0, 20.0}, {2.0, 30.0},
+	}, rows)
+	require.NoError(t, tx.Rollback())
+
+	history, err := cl.History("foo", 1)
+	require.NoError(t, err)
+	// the last operation of the transaction is recorded
+	assert.Equal(t, "DELETE", history[0].Operation)
+	assert.Equal(t, map[string]int64{
+		"numFiles": 2, "numOutputRows": 6, "numRemovedFiles": 2, "numDeletedRows": 2, "numUpdatedRows": 4,
+	}, history[0].Metrics)
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	_, err = tx.Delete("missing", "")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	_, err = tx.Delete("foo", "missing = 1")
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = tx.Update("foo", map[string]string{"missing": "1"}, "")
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	n, err = tx.Delete("foo", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, n)
+	assert.Empty(t, collectRows(t, mustIter(t, tx, "foo")))
+}
+
+func TestMerge(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}, {Name: "name", Type: StringType}}))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Put("foo", []any{1, "a"}))
+	require.NoError(t, tx.Put("foo", []any{2, "b"}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	updated, inserted, err := tx.Merge("foo", [][]any{{2, "B"}, {3, "c"}, {nil, "d"}}, []string{"id"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, updated)
+	assert.EqualValues(t, 2, inserted)
+	_, _, err = tx.Merge("foo", [][]any{{1, "x"}, {1, "y"}}, []string{"id"})
+	assert.Error(t, err)
+	_, _, err = tx.Merge("foo", [][]any{{1, "x"}}, []string{"missing"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	_, rows := queryRows(t, tx, "SELECT id, name FROM foo ORDER BY name")
+	assert.Equal(t, [][]any{{int64(2), "B"}, {int64(1), "a"}, {int64(3), "c"}, {nil, "d"}}, rows)
+}
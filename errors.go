@@ -0,0 +1,65 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTableNotFound      = errors.New("table not found")
+	ErrTableExists        = errors.New("table already exists")
+	ErrSchemaMismatch     = errors.New("schema mismatch")
+	ErrConflict           = errors.New("conflicting commit")
+	ErrTransactionClosed  = errors.New("transaction already finished")
+	ErrInvalidQuery       = errors.New("invalid query")
+	ErrVersionNotFound    = errors.New("version not found")
+	ErrFileNotFound       = errors.New("data object not found")
+	ErrChangeDataDisabled = errors.New("change data feed not enabled")
+	// ErrMemoryBudgetExceeded is returned by Put which waited too long for
+	// buffers of other transactions to be flushed
+	ErrMemoryBudgetExceeded = errors.New("memory budget exceeded")
+	// ErrSyntax, ErrUnknownColumn and ErrUnsupportedStatement are kinds of
+	// ErrInvalidQuery
+	ErrSyntax               = fmt.Errorf("%w: syntax error", ErrInvalidQuery)
+	ErrUnknownColumn        = fmt.Errorf("%w: unknown column", ErrInvalidQuery)
+	ErrUnsupportedStatement = fmt.Errorf("%w: unsupported statement", ErrInvalidQuery)
+)
+
+// TableError is returned by operations failing for the given table
+type TableError struct {
+	Table string
+	Err   error
+}
+
+func (e *TableError) Error() string {
+	return fmt.Sprintf("table %s: %v", e.Table, e.Err)
+}
+
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
+
+func tableError(table string, err error) error {
+	return &TableError{Table: table, Err: err}
+}
+
+// ConflictError is returned by Commit when another transaction committed the
+// version first, the transaction has to be retried on a new snapshot. Versions
+// of auto compaction only conflict with transactions removing the compacted
+// data objects.
+type ConflictError struct {
+	Version int64
+	Err     error // error returned by the LogStore
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v: version %d: %v", ErrConflict, e.Version, e.Err)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
@@ -17,8 +17,6 @@ type ObjectStorage interface {
 
 type fileStorage struct {
 	dir string
-
-	// todo: add cache since files are immutable
 }
 
 func NewFileStorage(dir string) ObjectStorage {
@@ -0,0 +1,70 @@
+package deltalake
+
+import (
+	"io"
+	"time"
+)
+
+// CommitInfo describes committed version of the table. Versions written
+// before commit info was recorded have only the Version set.
+type CommitInfo struct {
+	Version             int64
+	Timestamp           time.Time
+	Operation           string // WRITE, CREATE TABLE, ...
+	OperationParameters map[string]string
+	ClientId            string
+	// Metrics of the whole commit, like numFiles and numOutputRows added
+	Metrics map[string]int64
+}
+
+// readActions returns actions of the log version
+func (d *delta) readActions(version int64) ([]action, error) {
+	reader, err := d.log.Read(version)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	l, err := newLogs().deserialize(raw)
+	if err != nil {
+		return nil, err
+	}
+	return l.actions()
+}
+
+func (d *delta) History(table string, limit int) ([]CommitInfo, error) {
+	versions, err := d.log.Versions()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]CommitInfo, 0)
+	for i := len(versions) - 1; i >= 0 && (limit <= 0 || len(res) < limit); i-- {
+		actions, err := d.readActions(versions[i])
+		if err != nil {
+			return nil, err
+		}
+		info := CommitInfo{Version: versions[i]}
+		changed := false
+		for _, a := range actions {
+			if ci, ok := a.(*commitInfo); ok {
+				info.Timestamp = ci.Timestamp
+				info.Operation = ci.Operation
+				info.OperationParameters = ci.OperationParameters
+				info.ClientId = ci.ClientId
+				info.Metrics = ci.Metrics
+				continue
+			}
+			changed = changed || a.getTable() == table
+		}
+		if changed {
+			res = append(res, info)
+		}
+	}
+	if len(res) == 0 {
+		return nil, tableError(table, ErrTableNotFound)
+	}
+	return res, nil
+}
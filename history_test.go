@@ -0,0 +1,71 @@
+package deltalake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.ClientId = "loader"
+	cl := New(NewFileStorage(testdir), opts)
+	start := time.Now().Add(-time.Second)
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.Create("foo", []string{"id"}))
+	require.NoError(t, tx.Create("bar", []string{"id"}))
+	require.NoError(t, tx.Commit())
+
+	for i := 0; i < 3; i++ {
+		tx = cl.NewTransaction()
+		if i == 2 {
+			tx.SetClientId("admin")
+		}
+		for j := 0; j <= i; j++ {
+			require.NoError(t, tx.Put("foo", []any{j}))
+		}
+		require.NoError(t, tx.Commit())
+	}
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Put("bar", []any{1}))
+	require.NoError(t, tx.Commit())
+
+	history, err := cl.History("foo", 0)
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	for i, expected := range []int64{3, 2, 1, 0} {
+		assert.Equal(t, expected, history[i].Version)
+		assert.True(t, history[i].Timestamp.After(start))
+	}
+	assert.Equal(t, "admin", history[0].ClientId)
+	assert.Equal(t, "WRITE", history[0].Operation)
+	assert.Equal(t, map[string]string{"mode": "Append"}, history[0].OperationParameters)
+	assert.Equal(t, map[string]int64{"numFiles": 1, "numOutputRows": 3}, history[0].Metrics)
+	assert.Equal(t, "loader", history[1].ClientId)
+	assert.Equal(t, "CREATE TABLE", history[3].Operation)
+
+	history, err = cl.History("bar", 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, int64(4), history[0].Version)
+
+	_, err = cl.History("missing", 0)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	// commit info is not an action of any table
+	tx = cl.NewTransaction()
+	rows := collectRows(t, mustIter(t, tx, "foo"))
+	assert.Len(t, rows, 6)
+	require.NoError(t, tx.Commit())
+}
+
+func mustIter(t *testing.T, tx *Transaction, table string) Iterator {
+	it, err := tx.Iter(table)
+	require.NoError(t, err)
+	return it
+}
@@ -1,9 +1,11 @@
 package deltalake
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 )
 
 /*
@@ -26,21 +28,66 @@ type action interface {
 }
 
 type changeMetadata struct {
-	Table   string
-	Columns []string
+	Table      string
+	Columns    []string
+	Types      []ColumnType      `json:",omitempty"` // missing for untyped tables
+	Properties map[string]string `json:",omitempty"`
 }
 
 type dataObjectAction struct {
 	Action int
 	Table  string
 	File   string
+	Stats  *fileStats `json:",omitempty"` // missing in logs written before stats
+	// rows of the file deleted without rewriting it
+	DeletionVector *deletionVector `json:",omitempty"`
 }
 
-func newChangeMetadaAction(table string, cols []string) *changeMetadata {
-	return &changeMetadata{
+// changeDataAction references file with rows changed by the version, it is
+// read only by TableChanges and is not part of the table data
+type changeDataAction struct {
+	Table string
+	File  string
+}
+
+// commitInfo records when, how and by whom the version was committed, it is
+// written as the first action of the version and belongs to no table
+type commitInfo struct {
+	Timestamp           time.Time
+	Operation           string
+	OperationParameters map[string]string `json:",omitempty"`
+	ClientId            string            `json:",omitempty"`
+	Tables              []string          `json:",omitempty"` // tables changed by the commit
+	Metrics             map[string]int64  `json:",omitempty"`
+}
+
+// txnAction records version of the application transaction committed by the
+// version, it belongs to no table
+type txnAction struct {
+	AppId       string
+	Version     int64
+	LastUpdated time.Time
+}
+
+func newChangeMetadaAction(table string, schema Schema) *changeMetadata {
+	cm := &changeMetadata{
 		Table:   table,
-		Columns: cols,
+		Columns: schema.names(),
+	}
+	if schema.typed() {
+		cm.Types = schema.types()
+	}
+	return cm
+}
+
+func (cm *changeMetadata) schema() Schema {
+	s := untypedSchema(cm.Columns)
+	for i, t := range cm.Types {
+		if i < len(s) {
+			s[i].Type = t
+		}
 	}
+	return s
 }
 
 func (cm *changeMetadata) write(w io.Writer) (int, error) {
@@ -91,11 +138,87 @@ func (da *dataObjectAction) getTable() string {
 	return da.Table
 }
 
+func newChangeDataAction(table, file string) *changeDataAction {
+	return &changeDataAction{
+		Table: table,
+		File:  file,
+	}
+}
+
+func (ca *changeDataAction) write(w io.Writer) (int, error) {
+	raw, err := json.Marshal(ca)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(raw)
+}
+
+func (ca *changeDataAction) serialize() ([]byte, error) {
+	return json.Marshal(ca)
+}
+
+func (ca *changeDataAction) getKind() LogKind {
+	return ChangeData
+}
+
+func (ca *changeDataAction) getTable() string {
+	return ca.Table
+}
+
+// dataChange reports whether the version changed rows, optimization only
+// rewrites data objects
+func (ci *commitInfo) dataChange() bool {
+	return ci.Operation != "OPTIMIZE"
+}
+
+func (ci *commitInfo) write(w io.Writer) (int, error) {
+	raw, err := json.Marshal(ci)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(raw)
+}
+
+func (ci *commitInfo) serialize() ([]byte, error) {
+	return json.Marshal(ci)
+}
+
+func (ci *commitInfo) getKind() LogKind {
+	return Commit
+}
+
+func (ci *commitInfo) getTable() string {
+	return ""
+}
+
+func (ta *txnAction) write(w io.Writer) (int, error) {
+	raw, err := json.Marshal(ta)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(raw)
+}
+
+func (ta *txnAction) serialize() ([]byte, error) {
+	return json.Marshal(ta)
+}
+
+func (ta *txnAction) getKind() LogKind {
+	return AppTransaction
+}
+
+func (ta *txnAction) getTable() string {
+	return ""
+}
+
 type LogKind int
 
 const (
 	ChangeMetadata LogKind = iota
 	DataObject
+	Commit
+	ChangeData
+	AppTransaction
 )
 
 type logEntry struct {
@@ -147,11 +270,34 @@ func (le *logEntry) action() (action, error) {
 		return &cm, nil
 	case DataObject:
 		do := dataObjectAction{}
-		err := json.Unmarshal(le.Raw, &do)
-		if err != nil {
+		// stats bounds of int64 columns don't fit into float64
+		dec := json.NewDecoder(bytes.NewReader(le.Raw))
+		dec.UseNumber()
+		if err := dec.Decode(&do); err != nil {
 			return nil, err
 		}
 		return &do, nil
+	case Commit:
+		ci := commitInfo{}
+		err := json.Unmarshal(le.Raw, &ci)
+		if err != nil {
+			return nil, err
+		}
+		return &ci, nil
+	case ChangeData:
+		ca := changeDataAction{}
+		err := json.Unmarshal(le.Raw, &ca)
+		if err != nil {
+			return nil, err
+		}
+		return &ca, nil
+	case AppTransaction:
+		ta := txnAction{}
+		err := json.Unmarshal(le.Raw, &ta)
+		if err != nil {
+			return nil, err
+		}
+		return &ta, nil
 	default:
 		return nil, fmt.Errorf("unknown log kind %d", le.Kind)
 	}
@@ -0,0 +1,436 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/multierr"
+)
+
+var (
+	ErrVersionExists = errors.New("log version already exists")
+	ErrLockTimeout   = errors.New("timeout while acquiring commit lock")
+	ErrLockLost      = errors.New("commit lock lease expired")
+)
+
+// LogStore persists the transaction log. Write must guarantee that only one
+// writer succeeds for a given version, otherwise the log is not linearizable.
+type LogStore interface {
+	Write(version int64, data []byte) error
+	Read(version int64) (io.ReadCloser, error)
+	// Versions returns committed versions in ascending order
+	Versions() ([]int64, error)
+}
+
+func logFileName(version int64) string {
+	return fmt.Sprintf("%s_%d", logPrefix, version)
+}
+
+func parseLogVersion(name string) (int64, bool) {
+	raw, found := strings.CutPrefix(name, logPrefix+"_")
+	if !found {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// objectLogStore keeps the log next to the data objects and relies on the
+// put-if-absent semantics of the underlying ObjectStorage.
+type objectLogStore struct {
+	storage ObjectStorage
+}
+
+func NewObjectLogStore(storage ObjectStorage) LogStore {
+	return &objectLogStore{storage: storage}
+}
+
+func (ls *objectLogStore) Write(version int64, data []byte) error {
+	err := ls.storage.Write(logFileName(version), data)
+	if errors.Is(err, fs.ErrExist) {
+		return ErrVersionExists
+	}
+	return err
+}
+
+func (ls *objectLogStore) Read(version int64) (io.ReadCloser, error) {
+	return ls.storage.Read(logFileName(version))
+}
+
+func (ls *objectLogStore) Versions() ([]int64, error) {
+	files, err := ls.storage.List("", logPrefix)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(files))
+	for _, f := range files {
+		if v, ok := parseLogVersion(f); ok {
+			versions = append(versions, v)
+		}
+	}
+	// file names are sorted lexically, _log_10 comes before _log_2
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// CommitCoordinator provides mutual exclusion for stores that cannot
+// guarantee put-if-absent on their own.
+type CommitCoordinator interface {
+	// Lock blocks until the lock identified by name is held
+	Lock(name string) (CommitLock, error)
+}
+
+// CommitLock is a lease on the lock. Check fails once the lease expired or
+// the lock was broken by another writer, writer which lost the lock must not
+// write the log.
+type CommitLock interface {
+	Check() error
+	Unlock() error
+}
+
+// coordinatedLogStore serializes commits with a CommitCoordinator and checks
+// for existing versions while holding the lock, so the underlying storage is
+// allowed to silently overwrite files.
+type coordinatedLogStore struct {
+	*objectLogStore
+	coordinator CommitCoordinator
+}
+
+func NewCoordinatedLogStore(storage ObjectStorage, coordinator CommitCoordinator) LogStore {
+	return &coordinatedLogStore{
+		objectLogStore: &objectLogStore{storage: storage},
+		coordinator:    coordinator,
+	}
+}
+
+func (ls *coordinatedLogStore) Write(version int64, data []byte) error {
+	lock, err := ls.coordinator.Lock(logPrefix)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the version is written even when the lock can't be released, the
+		// lock expires with its lease
+		if err := lock.Unlock(); err != nil {
+			slog.Warn("error while releasing commit lock", slog.Int64("version", version), slog.Any("error", err))
+		}
+	}()
+
+	versions, err := ls.Versions()
+	if err != nil {
+		return err
+	}
+	if _, found := slices.BinarySearch(versions, version); found {
+		return ErrVersionExists
+	}
+	if err := lock.Check(); err != nil {
+		return err
+	}
+	return ls.objectLogStore.Write(version, data)
+}
+
+const (
+	_defaultLease       = 10 * time.Second
+	_defaultLockTimeout = 30 * time.Second
+	_lockRetryInterval  = 10 * time.Millisecond
+)
+
+// lease is owner of the lock and its expiration time (unix nanos), it is
+// stored as "owner expires"
+type lease struct {
+	owner   string
+	expires int64
+}
+
+func newLease(duration time.Duration) lease {
+	return lease{owner: uuid.NewString(), expires: time.Now().Add(duration).UnixNano()}
+}
+
+func parseLease(raw []byte) (lease, error) {
+	owner, rawExpires, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return lease{}, errors.New("malformed lease")
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return lease{}, err
+	}
+	return lease{owner: owner, expires: expires}, nil
+}
+
+func (l lease) String() string {
+	return fmt.Sprintf("%s %d", l.owner, l.expires)
+}
+
+// expiredIn reports whether the lease expires within d
+func (l lease) expiredIn(d time.Duration) bool {
+	return time.Now().Add(d).UnixNano() >= l.expires
+}
+
+// validFor returns the error of held lock whose lease is current lease of
+// the lock. Half of the lease has to remain so the log is written before
+// another writer is allowed to break the lock.
+func (l lease) validFor(current lease, duration time.Duration) error {
+	if current.owner != l.owner || current.expiredIn(duration/2) {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// acquire calls tryLock until it succeeds or the timeout elapses
+func acquire(timeout time.Duration, tryLock func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		acquired, err := tryLock()
+		if err != nil || acquired {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(_lockRetryInterval)
+	}
+}
+
+// boltLockTable keeps leases in an embedded bbolt database. The database is
+// opened only while a lease is read or changed, bbolt locks the file so
+// writers of all processes sharing it exclude each other.
+type boltLockTable struct {
+	file    string
+	lease   time.Duration
+	timeout time.Duration
+}
+
+var _leasesBucket = []byte("leases")
+
+func NewBoltLockTable(file string, lease time.Duration) CommitCoordinator {
+	if lease <= 0 {
+		lease = _defaultLease
+	}
+	return &boltLockTable{
+		file:    file,
+		lease:   lease,
+		timeout: _defaultLockTimeout,
+	}
+}
+
+func (lt *boltLockTable) update(fn func(leases *bolt.Bucket) error) (err error) {
+	if err := os.MkdirAll(path.Dir(lt.file), os.ModePerm); err != nil {
+		return err
+	}
+	db, err := bolt.Open(lt.file, 0644, &bolt.Options{Timeout: lt.timeout})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = multierr.Append(err, db.Close())
+	}()
+	return db.Update(func(tx *bolt.Tx) error {
+		leases, err := tx.CreateBucketIfNotExists(_leasesBucket)
+		if err != nil {
+			return err
+		}
+		return fn(leases)
+	})
+}
+
+func (lt *boltLockTable) Lock(name string) (CommitLock, error) {
+	l := newLease(lt.lease)
+	err := acquire(lt.timeout, func() (bool, error) {
+		acquired := false
+		err := lt.update(func(leases *bolt.Bucket) error {
+			if raw := leases.Get([]byte(name)); raw != nil {
+				current, err := parseLease(raw)
+				if err == nil && !current.expiredIn(0) {
+					return nil
+				}
+			}
+			l = newLease(lt.lease)
+			acquired = true
+			return leases.Put([]byte(name), []byte(l.String()))
+		})
+		return acquired, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltLock{table: lt, name: []byte(name), lease: l}, nil
+}
+
+type boltLock struct {
+	table *boltLockTable
+	name  []byte
+	lease lease
+}
+
+// current calls fn with the lease of the lock, it fails when the lock is lost
+func (bl *boltLock) current(fn func(leases *bolt.Bucket) error) error {
+	return bl.table.update(func(leases *bolt.Bucket) error {
+		current, err := parseLease(leases.Get(bl.name))
+		if err != nil {
+			return ErrLockLost
+		}
+		if err := bl.lease.validFor(current, bl.table.lease); err != nil {
+			return err
+		}
+		return fn(leases)
+	})
+}
+
+func (bl *boltLock) Check() error {
+	return bl.current(func(*bolt.Bucket) error { return nil })
+}
+
+func (bl *boltLock) Unlock() error {
+	return bl.current(func(leases *bolt.Bucket) error {
+		return leases.Delete(bl.name)
+	})
+}
+
+// leaseLockCoordinator uses lock files on a filesystem supporting hard links
+// and atomic renames. Every lock is a lease, a lock left behind by a crashed
+// writer is broken once its lease expires.
+type leaseLockCoordinator struct {
+	dir     string
+	lease   time.Duration
+	timeout time.Duration
+}
+
+func NewLeaseLockCoordinator(dir string, lease time.Duration) CommitCoordinator {
+	if lease <= 0 {
+		lease = _defaultLease
+	}
+	return &leaseLockCoordinator{
+		dir:     dir,
+		lease:   lease,
+		timeout: _defaultLockTimeout,
+	}
+}
+
+func (lc *leaseLockCoordinator) Lock(name string) (CommitLock, error) {
+	if err := os.MkdirAll(lc.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	lock := &leaseLock{coordinator: lc, file: path.Join(lc.dir, name+".lock")}
+	err := acquire(lc.timeout, func() (bool, error) {
+		var err error
+		lock.lease, err = lc.tryLock(lock.file)
+		return lock.lease.owner != "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// tryLock links fully written lease as the lock file, so the lock file
+// always has complete content. Empty lease is returned when the lock is held.
+func (lc *leaseLockCoordinator) tryLock(file string) (lease, error) {
+	l := newLease(lc.lease)
+	tmp := file + "." + l.owner
+	if err := os.WriteFile(tmp, []byte(l.String()), 0644); err != nil {
+		return lease{}, err
+	}
+	defer os.Remove(tmp)
+	err := os.Link(tmp, file)
+	if err == nil {
+		return l, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return lease{}, err
+	}
+
+	current, err := readLease(file)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !current.expiredIn(0) {
+		return lease{}, nil
+	}
+	if err != nil {
+		return lease{}, err
+	}
+	// lease expired, break the lock
+	_, err = takeLock(file, func(moved lease) bool { return moved.expiredIn(0) })
+	return lease{}, err
+}
+
+// takeLock atomically moves the lock file away and removes it when its lease
+// satisfies cond, otherwise the lock file is put back. Only one writer moves
+// the file, so a lock taken after the caller read the lease is never removed.
+// If the lock was taken once more in the meantime, the owner of the moved
+// lease loses the lock.
+func takeLock(file string, cond func(lease) bool) (bool, error) {
+	moved := file + "." + uuid.NewString()
+	if err := os.Rename(file, moved); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer os.Remove(moved)
+	l, err := readLease(moved)
+	if err == nil && cond(l) {
+		return true, nil
+	}
+	if err := os.Link(moved, file); err != nil && !errors.Is(err, fs.ErrExist) {
+		return false, err
+	}
+	return false, nil
+}
+
+type leaseLock struct {
+	coordinator *leaseLockCoordinator
+	file        string
+	lease       lease
+}
+
+func (ll *leaseLock) Check() error {
+	current, err := readLease(ll.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	return ll.lease.validFor(current, ll.coordinator.lease)
+}
+
+func (ll *leaseLock) Unlock() error {
+	// lock of other writer is not moved even for a moment unless it was
+	// taken right after the read
+	current, err := readLease(ll.file)
+	if err == nil && current.owner != ll.lease.owner || errors.Is(err, fs.ErrNotExist) {
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	removed, err := takeLock(ll.file, func(current lease) bool { return current.owner == ll.lease.owner })
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func readLease(file string) (lease, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return lease{}, err
+	}
+	return parseLease(raw)
+}
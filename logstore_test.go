@@ -0,0 +1,173 @@
+package deltalake
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overwritingStorage emulates stores without put-if-absent
+type overwritingStorage struct {
+	ObjectStorage
+	dir string
+}
+
+func (s *overwritingStorage) Write(file string, data []byte) error {
+	return os.WriteFile(path.Join(s.dir, file), data, 0644)
+}
+
+func TestObjectLogStoreVersionsOrder(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	ls := NewObjectLogStore(NewFileStorage(testdir))
+	for _, v := range []int64{0, 1, 2, 10, 11, 3} {
+		assert.NoError(t, ls.Write(v, []byte("[]")))
+	}
+	assert.ErrorIs(t, ls.Write(10, []byte("[]")), ErrVersionExists)
+
+	versions, err := ls.Versions()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 1, 2, 3, 10, 11}, versions)
+}
+
+func testCoordinator(t *testing.T, coordinator CommitCoordinator, testdir string) {
+	storage := &overwritingStorage{ObjectStorage: NewFileStorage(testdir), dir: testdir}
+	ls := NewCoordinatedLogStore(storage, coordinator)
+
+	var (
+		wg      sync.WaitGroup
+		success atomic.Int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ls.Write(0, []byte("[]"))
+			if err == nil {
+				success.Add(1)
+				return
+			}
+			assert.ErrorIs(t, err, ErrVersionExists)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), success.Load())
+
+	rd, err := ls.Read(0)
+	assert.NoError(t, err)
+	raw, err := io.ReadAll(rd)
+	assert.NoError(t, err)
+	assert.NoError(t, rd.Close())
+	assert.Equal(t, "[]", string(raw))
+}
+
+func TestCoordinatedLogStoreBoltLockTable(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	testCoordinator(t, NewBoltLockTable(path.Join(testdir, "_locks.db"), time.Second), testdir)
+}
+
+func TestCoordinatedLogStoreLeaseLock(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	testCoordinator(t, NewLeaseLockCoordinator(path.Join(testdir, "_locks"), time.Second), testdir)
+}
+
+func TestLeaseLockExpired(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	for name, coordinator := range map[string]CommitCoordinator{
+		"lease": NewLeaseLockCoordinator(testdir, 100*time.Millisecond),
+		"bolt":  NewBoltLockTable(path.Join(testdir, "_locks.db"), 100*time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// simulate stalled writer which never released the lock
+			stalled, err := coordinator.Lock("foo")
+			require.NoError(t, err)
+			require.NoError(t, stalled.Check())
+
+			// writers racing to break the expired lock hold it one at a time
+			var (
+				wg      sync.WaitGroup
+				holders atomic.Int32
+			)
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					lock, err := coordinator.Lock("foo")
+					if !assert.NoError(t, err) {
+						return
+					}
+					assert.Equal(t, int32(1), holders.Add(1))
+					assert.NoError(t, lock.Check())
+					holders.Add(-1)
+					assert.NoError(t, lock.Unlock())
+				}()
+			}
+			wg.Wait()
+
+			// writer which lost the lock is fenced off
+			lock, err := coordinator.Lock("foo")
+			require.NoError(t, err)
+			assert.ErrorIs(t, stalled.Check(), ErrLockLost)
+			assert.ErrorIs(t, stalled.Unlock(), ErrLockLost)
+			assert.NoError(t, lock.Check())
+			assert.NoError(t, lock.Unlock())
+		})
+	}
+}
+
+// failingUnlock emulates coordinator whose lock can't be released
+type failingUnlock struct {
+	CommitCoordinator
+}
+
+func (c failingUnlock) Lock(name string) (CommitLock, error) {
+	lock, err := c.CommitCoordinator.Lock(name)
+	return failingUnlockLock{lock}, err
+}
+
+type failingUnlockLock struct {
+	CommitLock
+}
+
+func (failingUnlockLock) Unlock() error {
+	return errors.New("unlock failed")
+}
+
+func TestCoordinatedLogStoreUnlockError(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	storage := &overwritingStorage{ObjectStorage: NewFileStorage(testdir), dir: testdir}
+	coordinator := failingUnlock{NewLeaseLockCoordinator(path.Join(testdir, "_locks"), 50*time.Millisecond)}
+	ls := NewCoordinatedLogStore(storage, coordinator)
+
+	// the version is committed although the lock is left to expire
+	assert.NoError(t, ls.Write(0, []byte("[]")))
+	assert.ErrorIs(t, ls.Write(0, []byte("[]")), ErrVersionExists)
+}
+
+func TestTransactionWithCoordinatedLogStore(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	storage := &overwritingStorage{ObjectStorage: NewFileStorage(testdir), dir: testdir}
+	opts := DefaultOpts()
+	opts.LogStore = NewCoordinatedLogStore(storage, NewBoltLockTable(path.Join(testdir, "_locks.db"), 0))
+	cl := New(storage, opts)
+
+	tx1 := cl.NewTransaction()
+	tx2 := cl.NewTransaction()
+	assert.NoError(t, tx1.Create("foo", []string{"a"}))
+	assert.NoError(t, tx2.Create("bar", []string{"a"}))
+	assert.NoError(t, tx1.Commit())
+	assert.ErrorIs(t, tx2.Commit(), ErrVersionExists)
+}
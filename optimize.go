@@ -0,0 +1,250 @@
+package deltalake
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+// table properties avoiding small data objects of the table
+const (
+	// PropertyAutoCompact set to "true" compacts the table in the background
+	// after commits which added data objects to it once the table has more
+	// than AutoCompactMinFiles small data objects. Compaction is committed as
+	// a separate version, transactions appending to the table meanwhile are
+	// committed after it.
+	PropertyAutoCompact = "delta.autoOptimize.autoCompact"
+	// PropertyOptimizeWrite set to "true" buffers rows put to the table until
+	// they fill TargetFileSizeBytes, MaxMemoryBufferSz doesn't split them.
+	// Buffers flushed early to stay within MemoryBudget can still be smaller.
+	PropertyOptimizeWrite = "delta.autoOptimize.optimizeWrite"
+)
+
+// Optimize compacts data objects of the table smaller than
+// TargetFileSizeBytes into objects near the target size purging rows deleted
+// by deletion vectors. Objects with deletion vectors and empty objects are
+// always rewritten, other objects only when they can be merged.
+// MaxMemoryBufferSz doesn't split compacted objects. Rows are not changed, nothing is written to the change data feed. Later
+// reads of the transaction see the compacted objects.
+func (tx *Transaction) Optimize(table string) error {
+	t, ok := tx.tables[table]
+	if !ok {
+		return tableError(table, ErrTableNotFound)
+	}
+	files := t.compactionCandidates(tx.d.opts.TargetFileSizeBytes)
+	if len(files) == 0 {
+		return nil
+	}
+
+	var purged, batchBytes int64
+	batch := make([][]any, 0)
+	added := make([]*dataObjectAction, 0)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ao, err := tx.writeDataObject(table, batch)
+		if err != nil {
+			return err
+		}
+		added = append(added, ao)
+		batch = make([][]any, 0)
+		batchBytes = 0
+		return nil
+	}
+	for _, f := range files {
+		if dv, ok := t.deletionVectors[f]; ok {
+			purged += dv.Cardinality
+		}
+		rd, err := t.openFile(f)
+		if err != nil {
+			return err
+		}
+		for {
+			row, err := rd.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var size int64
+			if err == nil {
+				size = encodedSize(row)
+				if tx.d.opts.objectFull(len(batch), batchBytes+size, true) {
+					err = flush()
+				}
+			}
+			if err != nil {
+				rd.close()
+				return err
+			}
+			batch = append(batch, row)
+			batchBytes += size
+		}
+		if err := rd.close(); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		tx.actions = append(tx.actions, t.removeAction(f))
+		delete(t.stats, f)
+	}
+	t.files = slices.DeleteFunc(slices.Clone(t.files), func(f string) bool { return slices.Contains(files, f) })
+	t.deletionVectors = nil
+	for _, ao := range added {
+		t.addFile(ao)
+	}
+	tx.setOperation("OPTIMIZE", nil)
+	tx.addMetric("numPurgedRows", purged)
+	return nil
+}
+
+// compactionCandidates packs files smaller than the target size into bins
+// of at most the target size. Files of bins with more than one file, files
+// with deletion vectors and empty files are returned. Files without recorded size are
+// considered empty.
+func (t *table) compactionCandidates(target int64) []string {
+	var files, bin []string
+	var binSize int64
+	closeBin := func() {
+		if len(bin) > 1 {
+			files = append(files, bin...)
+		}
+		bin, binSize = nil, 0
+	}
+	for _, f := range t.files {
+		stats := t.stats[f]
+		if _, ok := t.deletionVectors[f]; ok || stats != nil && stats.NumRecords == 0 {
+			files = append(files, f)
+			continue
+		}
+		var size int64
+		if stats != nil {
+			size = stats.Size
+		}
+		if target > 0 && size >= target {
+			continue
+		}
+		if target > 0 && binSize+size > target {
+			closeBin()
+		}
+		bin = append(bin, f)
+		binSize += size
+	}
+	closeBin()
+	return files
+}
+
+func (t *table) optimizeWrite() bool {
+	return t.properties[PropertyOptimizeWrite] == "true"
+}
+
+// smallFiles counts data objects smaller than the target size, files without
+// recorded size are considered small
+func (t *table) smallFiles(target int64) int {
+	n := 0
+	for _, f := range t.files {
+		if stats := t.stats[f]; target == 0 || stats == nil || stats.Size < target {
+			n++
+		}
+	}
+	return n
+}
+
+// autoOptimize compacts tables with auto compaction the committed
+// transaction added data objects to. Compactions don't trigger further
+// compactions.
+func (tx *Transaction) autoOptimize() {
+	if tx.operation == "OPTIMIZE" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, a := range tx.actions {
+		ao, ok := a.(*dataObjectAction)
+		if !ok || ao.Action != _add || seen[ao.Table] {
+			continue
+		}
+		seen[ao.Table] = true
+		if t, ok := tx.tables[ao.Table]; ok && t.properties[PropertyAutoCompact] == "true" {
+			tx.d.compactInBackground(ao.Table)
+		}
+	}
+}
+
+// compact optimizes the table in a new transaction when it has more than
+// AutoCompactMinFiles small data objects. Errors are only logged, the commit
+// which triggered the compaction already succeeded.
+func (d *delta) compact(table string) {
+	tx := d.NewTransaction()
+	t, ok := tx.tables[table]
+	if !ok || t.smallFiles(d.opts.TargetFileSizeBytes) <= d.opts.AutoCompactMinFiles {
+		tx.Rollback()
+		return
+	}
+	err := tx.Optimize(table)
+	if err == nil {
+		tx.setOperation("OPTIMIZE", map[string]string{"auto": "true"})
+		err = tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		slog.Warn("auto compaction failed", slog.String("table", table), slog.Any("error", err))
+	}
+}
+
+// compactInBackground compacts the table unless its compaction is already
+// running or the storage is closed. Transactions which lose their version to
+// the compaction are committed after it, see followsCompaction.
+func (d *delta) compactInBackground(table string) {
+	d.compactMu.Lock()
+	defer d.compactMu.Unlock()
+	if d.closed || d.compacting[table] {
+		return
+	}
+	d.compacting[table] = true
+	d.compactions.Add(1)
+	go func() {
+		defer d.compactions.Done()
+		d.compact(table)
+		d.compactMu.Lock()
+		delete(d.compacting, table)
+		d.compactMu.Unlock()
+	}()
+}
+
+// followsCompaction reports whether the version committed concurrently with
+// the transaction is an auto compaction the transaction can be committed
+// after. Compaction doesn't change rows, so only data objects removed by both
+// conflict: rows deleted or updated by the transaction would be restored by
+// the compacted objects.
+func (tx *Transaction) followsCompaction(version int64) (bool, error) {
+	actions, err := tx.d.readActions(version)
+	if err != nil {
+		return false, err
+	}
+	type object struct{ table, file string }
+	compaction := false
+	removed := make(map[object]bool)
+	for _, a := range actions {
+		switch a := a.(type) {
+		case *commitInfo:
+			compaction = a.Operation == "OPTIMIZE" && a.OperationParameters["auto"] == "true"
+		case *dataObjectAction:
+			if a.Action == _remove {
+				removed[object{a.Table, a.File}] = true
+			}
+		}
+	}
+	if !compaction {
+		return false, nil
+	}
+	for _, a := range tx.actions {
+		if ao, ok := a.(*dataObjectAction); ok && ao.Action == _remove && removed[object{ao.Table, ao.File}] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
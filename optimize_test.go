@@ -0,0 +1,184 @@
+package deltalake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoOptimize(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.AutoCompactMinFiles = 3
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	for _, table := range []string{"foo", "bar", "baz"} {
+		require.NoError(t, tx.CreateWithSchema(table, Schema{{Name: "id", Type: Int64Type}}))
+	}
+	require.NoError(t, tx.SetTableProperty("foo", PropertyOptimizeWrite, "true"))
+	require.NoError(t, tx.SetTableProperty("bar", PropertyAutoCompact, "true"))
+	require.NoError(t, tx.Commit())
+	files := func(table string) int {
+		tx := d.NewTransaction()
+		defer tx.Rollback()
+		return len(tx.tables[table].files)
+	}
+
+	for i := 0; i < 3; i++ {
+		tx := d.NewTransaction()
+		for _, table := range []string{"foo", "bar", "baz"} {
+			require.NoError(t, tx.Put(table, []any{i}))
+		}
+		require.NoError(t, tx.Commit())
+		if i < 2 {
+			// tables don't have enough small files yet
+			d.compactions.Wait()
+			assert.Equal(t, i+2, files("bar"))
+		}
+	}
+	d.compactions.Wait()
+	assert.Equal(t, 1, files("bar"))
+	// optimized writes don't compact the table
+	assert.Equal(t, 4, files("foo"))
+	assert.Equal(t, 4, files("baz"))
+
+	history, err := d.History("bar", 2)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "OPTIMIZE", history[0].Operation)
+	assert.Equal(t, map[string]string{"auto": "true"}, history[0].OperationParameters)
+	history, err = d.History("foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "WRITE", history[0].Operation)
+
+	tx = d.NewTransaction()
+	defer tx.Rollback()
+	for _, table := range []string{"foo", "bar", "baz"} {
+		_, rows := queryRows(t, tx, "SELECT id FROM "+table+" ORDER BY id")
+		assert.Equal(t, [][]any{{int64(0)}, {int64(1)}, {int64(2)}}, rows, table)
+	}
+}
+
+func TestOptimizeWrite(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.MaxMemoryBufferSz = 2
+	// five single digit rows fill a data object
+	opts.TargetFileSizeBytes = 5 * encodedSize([]any{int64(0)})
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	for _, table := range []string{"foo", "bar"} {
+		require.NoError(t, tx.CreateWithSchema(table, Schema{{Name: "id", Type: Int64Type}}))
+	}
+	require.NoError(t, tx.SetTableProperty("foo", PropertyOptimizeWrite, "true"))
+	require.NoError(t, tx.Commit())
+
+	tx = d.NewTransaction()
+	for i := 0; i < 8; i++ {
+		for _, table := range []string{"foo", "bar"} {
+			require.NoError(t, tx.Put(table, []any{i}))
+		}
+	}
+	require.NoError(t, tx.Commit())
+
+	tx = d.NewTransaction()
+	defer tx.Rollback()
+	records := func(table string) []int64 {
+		res := make([]int64, 0)
+		for _, f := range tx.tables[table].files {
+			if n := tx.tables[table].stats[f].NumRecords; n > 0 {
+				res = append(res, n)
+			}
+		}
+		return res
+	}
+	// rows of optimized writes are split only by the target size
+	assert.Equal(t, []int64{5, 3}, records("foo"))
+	assert.Equal(t, []int64{2, 2, 2, 2}, records("bar"))
+	history, err := d.History("foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "WRITE", history[0].Operation)
+	for _, table := range []string{"foo", "bar"} {
+		_, rows := queryRows(t, tx, "SELECT count(*) FROM "+table)
+		assert.Equal(t, [][]any{{int64(8)}}, rows, table)
+	}
+}
+
+func TestOptimizeIgnoresRowLimit(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.MaxMemoryBufferSz = 2
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}}))
+	for i := 0; i < 6; i++ {
+		require.NoError(t, tx.Put("foo", []any{i}))
+	}
+	require.NoError(t, tx.Commit())
+
+	// compacted objects are split only by the target size, otherwise they
+	// stay small and get compacted again
+	tx = d.NewTransaction()
+	require.Len(t, tx.tables["foo"].files, 3)
+	require.NoError(t, tx.Optimize("foo"))
+	require.NoError(t, tx.Commit())
+	tx = d.NewTransaction()
+	defer tx.Rollback()
+	files := tx.tables["foo"].files
+	require.Len(t, files, 1)
+	assert.Equal(t, int64(6), tx.tables["foo"].stats[files[0]].NumRecords)
+}
+
+func TestAutoCompactionConflicts(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	opts := DefaultOpts()
+	opts.AutoCompactMinFiles = 1
+	d := New(NewFileStorage(testdir), opts).(*delta)
+
+	tx := d.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}}))
+	require.NoError(t, tx.Commit())
+	for i := 0; i < 2; i++ {
+		tx = d.NewTransaction()
+		require.NoError(t, tx.Put("foo", []any{i}))
+		require.NoError(t, tx.Commit())
+	}
+
+	// transactions started before the compaction was committed
+	appending, deleting := d.NewTransaction(), d.NewTransaction()
+	require.NoError(t, appending.Put("foo", []any{2}))
+	_, err := deleting.Delete("foo", "id = 0")
+	require.NoError(t, err)
+	d.compact("foo")
+
+	// version of the commit is past the compaction it lost its version to
+	id := appending.GetId()
+	version, err := appending.CommitVersion()
+	require.NoError(t, err)
+	assert.Equal(t, id+1, version)
+	err = deleting.Commit()
+	assert.ErrorIs(t, err, ErrConflict)
+	require.NoError(t, deleting.Rollback())
+	history, err := d.History("foo", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WRITE", "OPTIMIZE"}, []string{history[0].Operation, history[1].Operation})
+	assert.Equal(t, version, history[0].Version)
+
+	tx = d.NewTransaction()
+	_, rows := queryRows(t, tx, "SELECT id FROM foo ORDER BY id")
+	assert.Equal(t, [][]any{{int64(0)}, {int64(1)}, {int64(2)}}, rows)
+	require.NoError(t, tx.Rollback())
+
+	// closed storage doesn't start compactions
+	d.Close()
+	d.compactInBackground("foo")
+	assert.Empty(t, d.compacting)
+}
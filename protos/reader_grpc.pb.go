@@ -19,7 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ReaderService_Scan_FullMethodName = "/protos.ReaderService/Scan"
+	ReaderService_Scan_FullMethodName          = "/protos.ReaderService/Scan"
+	ReaderService_DescribeTable_FullMethodName = "/protos.ReaderService/DescribeTable"
+	ReaderService_History_FullMethodName       = "/protos.ReaderService/History"
+	ReaderService_Subscribe_FullMethodName     = "/protos.ReaderService/Subscribe"
 )
 
 // ReaderServiceClient is the client API for ReaderService service.
@@ -27,6 +30,10 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ReaderServiceClient interface {
 	Scan(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DataResponse], error)
+	DescribeTable(ctx context.Context, in *DescribeTableRequest, opts ...grpc.CallOption) (*TableSchema, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	// Subscribe streams versions of the table as they are committed
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TableVersion], error)
 }
 
 type readerServiceClient struct {
@@ -56,11 +63,54 @@ func (c *readerServiceClient) Scan(ctx context.Context, in *GetRequest, opts ...
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ReaderService_ScanClient = grpc.ServerStreamingClient[DataResponse]
 
+func (c *readerServiceClient) DescribeTable(ctx context.Context, in *DescribeTableRequest, opts ...grpc.CallOption) (*TableSchema, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TableSchema)
+	err := c.cc.Invoke(ctx, ReaderService_DescribeTable_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readerServiceClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, ReaderService_History_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readerServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TableVersion], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ReaderService_ServiceDesc.Streams[1], ReaderService_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, TableVersion]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReaderService_SubscribeClient = grpc.ServerStreamingClient[TableVersion]
+
 // ReaderServiceServer is the server API for ReaderService service.
 // All implementations must embed UnimplementedReaderServiceServer
 // for forward compatibility.
 type ReaderServiceServer interface {
 	Scan(*GetRequest, grpc.ServerStreamingServer[DataResponse]) error
+	DescribeTable(context.Context, *DescribeTableRequest) (*TableSchema, error)
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	// Subscribe streams versions of the table as they are committed
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[TableVersion]) error
 	mustEmbedUnimplementedReaderServiceServer()
 }
 
@@ -74,6 +124,15 @@ type UnimplementedReaderServiceServer struct{}
 func (UnimplementedReaderServiceServer) Scan(*GetRequest, grpc.ServerStreamingServer[DataResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
 }
+func (UnimplementedReaderServiceServer) DescribeTable(context.Context, *DescribeTableRequest) (*TableSchema, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeTable not implemented")
+}
+func (UnimplementedReaderServiceServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedReaderServiceServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[TableVersion]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
 func (UnimplementedReaderServiceServer) mustEmbedUnimplementedReaderServiceServer() {}
 func (UnimplementedReaderServiceServer) testEmbeddedByValue()                       {}
 
@@ -106,19 +165,80 @@ func _ReaderService_Scan_Handler(srv interface{}, stream grpc.ServerStream) erro
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ReaderService_ScanServer = grpc.ServerStreamingServer[DataResponse]
 
+func _ReaderService_DescribeTable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeTableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReaderServiceServer).DescribeTable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReaderService_DescribeTable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReaderServiceServer).DescribeTable(ctx, req.(*DescribeTableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReaderService_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReaderServiceServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReaderService_History_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReaderServiceServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReaderService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ReaderServiceServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, TableVersion]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReaderService_SubscribeServer = grpc.ServerStreamingServer[TableVersion]
+
 // ReaderService_ServiceDesc is the grpc.ServiceDesc for ReaderService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var ReaderService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.ReaderService",
 	HandlerType: (*ReaderServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DescribeTable",
+			Handler:    _ReaderService_DescribeTable_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _ReaderService_History_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Scan",
 			Handler:       _ReaderService_Scan_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ReaderService_Subscribe_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "protos/reader.proto",
 }
@@ -21,8 +21,11 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	WriterService_Create_FullMethodName         = "/protos.WriterService/Create"
 	WriterService_Set_FullMethodName            = "/protos.WriterService/Set"
+	WriterService_BulkInsert_FullMethodName     = "/protos.WriterService/BulkInsert"
 	WriterService_NewTransaction_FullMethodName = "/protos.WriterService/NewTransaction"
 	WriterService_Commit_FullMethodName         = "/protos.WriterService/Commit"
+	WriterService_Rollback_FullMethodName       = "/protos.WriterService/Rollback"
+	WriterService_KeepAlive_FullMethodName      = "/protos.WriterService/KeepAlive"
 )
 
 // WriterServiceClient is the client API for WriterService service.
@@ -31,8 +34,14 @@ const (
 type WriterServiceClient interface {
 	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Error, error)
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*Error, error)
+	// BulkInsert writes all streamed rows in a single transaction. Rows are
+	// committed once the stream is closed unless tx_id of an open transaction
+	// is given in the first message.
+	BulkInsert(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SetRequest, InsertSummary], error)
 	NewTransaction(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Transaction, error)
 	Commit(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Error, error)
+	Rollback(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Error, error)
+	KeepAlive(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Lease, error)
 }
 
 type writerServiceClient struct {
@@ -63,6 +72,19 @@ func (c *writerServiceClient) Set(ctx context.Context, in *SetRequest, opts ...g
 	return out, nil
 }
 
+func (c *writerServiceClient) BulkInsert(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SetRequest, InsertSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WriterService_ServiceDesc.Streams[0], WriterService_BulkInsert_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SetRequest, InsertSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WriterService_BulkInsertClient = grpc.ClientStreamingClient[SetRequest, InsertSummary]
+
 func (c *writerServiceClient) NewTransaction(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Transaction, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(Transaction)
@@ -83,14 +105,40 @@ func (c *writerServiceClient) Commit(ctx context.Context, in *Transaction, opts
 	return out, nil
 }
 
+func (c *writerServiceClient) Rollback(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Error, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Error)
+	err := c.cc.Invoke(ctx, WriterService_Rollback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *writerServiceClient) KeepAlive(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Lease, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lease)
+	err := c.cc.Invoke(ctx, WriterService_KeepAlive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WriterServiceServer is the server API for WriterService service.
 // All implementations must embed UnimplementedWriterServiceServer
 // for forward compatibility.
 type WriterServiceServer interface {
 	Create(context.Context, *CreateRequest) (*Error, error)
 	Set(context.Context, *SetRequest) (*Error, error)
+	// BulkInsert writes all streamed rows in a single transaction. Rows are
+	// committed once the stream is closed unless tx_id of an open transaction
+	// is given in the first message.
+	BulkInsert(grpc.ClientStreamingServer[SetRequest, InsertSummary]) error
 	NewTransaction(context.Context, *Empty) (*Transaction, error)
 	Commit(context.Context, *Transaction) (*Error, error)
+	Rollback(context.Context, *Transaction) (*Error, error)
+	KeepAlive(context.Context, *Transaction) (*Lease, error)
 	mustEmbedUnimplementedWriterServiceServer()
 }
 
@@ -107,12 +155,21 @@ func (UnimplementedWriterServiceServer) Create(context.Context, *CreateRequest)
 func (UnimplementedWriterServiceServer) Set(context.Context, *SetRequest) (*Error, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
 }
+func (UnimplementedWriterServiceServer) BulkInsert(grpc.ClientStreamingServer[SetRequest, InsertSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method BulkInsert not implemented")
+}
 func (UnimplementedWriterServiceServer) NewTransaction(context.Context, *Empty) (*Transaction, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method NewTransaction not implemented")
 }
 func (UnimplementedWriterServiceServer) Commit(context.Context, *Transaction) (*Error, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
 }
+func (UnimplementedWriterServiceServer) Rollback(context.Context, *Transaction) (*Error, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
+}
+func (UnimplementedWriterServiceServer) KeepAlive(context.Context, *Transaction) (*Lease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KeepAlive not implemented")
+}
 func (UnimplementedWriterServiceServer) mustEmbedUnimplementedWriterServiceServer() {}
 func (UnimplementedWriterServiceServer) testEmbeddedByValue()                       {}
 
@@ -170,6 +227,13 @@ func _WriterService_Set_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WriterService_BulkInsert_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WriterServiceServer).BulkInsert(&grpc.GenericServerStream[SetRequest, InsertSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WriterService_BulkInsertServer = grpc.ClientStreamingServer[SetRequest, InsertSummary]
+
 func _WriterService_NewTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Empty)
 	if err := dec(in); err != nil {
@@ -206,6 +270,42 @@ func _WriterService_Commit_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WriterService_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WriterServiceServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WriterService_Rollback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WriterServiceServer).Rollback(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WriterService_KeepAlive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WriterServiceServer).KeepAlive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WriterService_KeepAlive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WriterServiceServer).KeepAlive(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // WriterService_ServiceDesc is the grpc.ServiceDesc for WriterService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,7 +329,21 @@ var WriterService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Commit",
 			Handler:    _WriterService_Commit_Handler,
 		},
+		{
+			MethodName: "Rollback",
+			Handler:    _WriterService_Rollback_Handler,
+		},
+		{
+			MethodName: "KeepAlive",
+			Handler:    _WriterService_KeepAlive_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BulkInsert",
+			Handler:       _WriterService_BulkInsert_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "protos/writer.proto",
 }
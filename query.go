@@ -0,0 +1,869 @@
+package deltalake
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// QueryIterator returns rows of the query result, Columns are names of the
+// result columns in the order of row values. Schema types columns referring
+// to table columns and aggregates of them, other columns are AnyType.
+type QueryIterator interface {
+	Iterator
+	Columns() []string
+	Schema() Schema
+}
+
+type queryIt struct {
+	Iterator
+	columns []string
+	schema  Schema
+}
+
+func (qi *queryIt) Columns() []string {
+	return qi.columns
+}
+
+func (qi *queryIt) Schema() Schema {
+	return qi.schema
+}
+
+// Query runs SELECT statement over the tables of the transaction snapshot,
+// rows not committed yet are not visible same as for Iter. Supported are
+// projections, WHERE, GROUP BY with COUNT, SUM, AVG, MIN and MAX, HAVING,
+// ORDER BY, LIMIT with OFFSET and inner and left joins. Conditions on
+// columns compared with constants skip data objects using their stats.
+// Placeholders $1, $2... are replaced with args.
+func (tx *Transaction) Query(query string, args ...any) (QueryIterator, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext returns query iterator which fails with the context error once
+// ctx is done
+func (tx *Transaction) QueryContext(ctx context.Context, query string, args ...any) (QueryIterator, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.bind(args); err != nil {
+		return nil, err
+	}
+	return tx.plan(ctx, q)
+}
+
+// QueryWhere returns all columns of the table rows matching the condition
+// like the WHERE clause of Query, empty condition matches all rows
+func (tx *Transaction) QueryWhere(ctx context.Context, table, where string) (QueryIterator, error) {
+	q := &selectQuery{
+		items: []selectItem{{star: true}},
+		from:  &tableRef{name: table, alias: table},
+		limit: -1,
+	}
+	if where != "" {
+		var err error
+		if q.where, err = parseExpression(where); err != nil {
+			return nil, err
+		}
+	}
+	return tx.plan(ctx, q)
+}
+
+// QueryTables returns names of the tables the query reads, servers use it to
+// authorize queries before running them
+func QueryTables(query string) ([]string, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if q.from == nil {
+		return nil, nil
+	}
+	tables := []string{q.from.name}
+	for _, j := range q.joins {
+		if !slices.Contains(tables, j.table.name) {
+			tables = append(tables, j.table.name)
+		}
+	}
+	return tables, nil
+}
+
+type scopeColumn struct {
+	table string // alias of the table
+	name  string
+	typ   ColumnType
+}
+
+// scope are columns of the rows an expression is evaluated on
+type scope []scopeColumn
+
+func (s scope) resolve(c *columnExpr) (int, error) {
+	idx := -1
+	for i, sc := range s {
+		if sc.name != c.name || c.table != "" && sc.table != c.table {
+			continue
+		}
+		if idx >= 0 {
+			return 0, fmt.Errorf("%w: column %s is ambiguous", ErrInvalidQuery, c)
+		}
+		idx = i
+	}
+	if idx < 0 {
+		return 0, fmt.Errorf("%w %s", ErrUnknownColumn, c)
+	}
+	return idx, nil
+}
+
+func (tx *Transaction) plan(ctx context.Context, q *selectQuery) (QueryIterator, error) {
+	var (
+		root Iterator
+		sc   scope
+	)
+	if q.from == nil {
+		root = &rowsOp{rows: [][]any{{}}}
+	} else {
+		refs := append([]tableRef{*q.from}, make([]tableRef, 0, len(q.joins))...)
+		for _, j := range q.joins {
+			refs = append(refs, j.table)
+		}
+		tables := make([]*table, len(refs))
+		scopes := make([]scope, len(refs))
+		for i, ref := range refs {
+			t, ok := tx.tables[ref.name]
+			if !ok {
+				return nil, tableError(ref.name, ErrTableNotFound)
+			}
+			for _, prev := range refs[:i] {
+				if prev.alias == ref.alias {
+					return nil, fmt.Errorf("%w: table name %s specified more than once", ErrInvalidQuery, ref.alias)
+				}
+			}
+			tables[i] = t
+			for _, c := range t.schema {
+				scopes[i] = append(scopes[i], scopeColumn{table: ref.alias, name: c.Name, typ: c.Type})
+			}
+			sc = append(sc, scopes[i]...)
+		}
+
+		preds, err := pushdown(q, sc, scopes)
+		if err != nil {
+			return nil, err
+		}
+		root = &scanOp{ctx: ctx, table: tables[0].prune(preds[0])}
+		width := len(scopes[0])
+		for i, j := range q.joins {
+			right := &scanOp{ctx: ctx, table: tables[i+1].prune(preds[i+1])}
+			join, err := planJoin(root, right, j, sc[:width+len(scopes[i+1])], width)
+			if err != nil {
+				return nil, err
+			}
+			root = join
+			width += len(scopes[i+1])
+		}
+	}
+
+	if q.where != nil {
+		pred, err := (&compiler{scope: sc}).compile(q.where)
+		if err != nil {
+			return nil, err
+		}
+		root = &filterOp{child: root, pred: pred}
+	}
+
+	items, err := expandStars(q.items, sc)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{scope: sc}
+	grouped := len(q.groupBy) > 0 || hasAggregate(q.having)
+	for _, item := range items {
+		grouped = grouped || hasAggregate(item.expr)
+	}
+	for _, o := range q.orderBy {
+		grouped = grouped || hasAggregate(o.expr)
+	}
+	var agg *aggregateOp
+	if grouped {
+		agg = &aggregateOp{child: root}
+		for _, g := range q.groupBy {
+			key, err := c.compile(g)
+			if err != nil {
+				return nil, err
+			}
+			agg.keys = append(agg.keys, key)
+		}
+		c = &compiler{scope: sc, grouped: true, groups: q.groupBy}
+		root = agg
+	} else if q.having != nil {
+		return nil, fmt.Errorf("%w: HAVING requires GROUP BY or aggregate", ErrInvalidQuery)
+	}
+	if q.having != nil {
+		pred, err := c.compile(q.having)
+		if err != nil {
+			return nil, err
+		}
+		root = &filterOp{child: root, pred: pred}
+	}
+
+	columns := make([]string, len(items))
+	schema := make(Schema, len(items))
+	exprs := make([]evalFunc, len(items))
+	for i, item := range items {
+		if exprs[i], err = c.compile(item.expr); err != nil {
+			return nil, err
+		}
+		columns[i] = item.alias
+		if columns[i] == "" {
+			columns[i] = columnName(item.expr)
+		}
+		schema[i] = Column{Name: columns[i], Type: sc.typeOf(item.expr)}
+	}
+	keys := make([]sortKey, len(q.orderBy))
+	for i, o := range q.orderBy {
+		column, err := orderColumn(o.expr, items, columns)
+		if err != nil {
+			return nil, err
+		}
+		if column < 0 {
+			// ordered by expression missing in the result, computed as
+			// hidden column removed after sorting
+			e, err := c.compile(o.expr)
+			if err != nil {
+				return nil, err
+			}
+			column = len(exprs)
+			exprs = append(exprs, e)
+		}
+		keys[i] = sortKey{column: column, desc: o.desc}
+	}
+	if agg != nil {
+		agg.aggs = c.aggs
+	}
+
+	root = &projectOp{child: root, exprs: exprs}
+	if len(keys) > 0 {
+		root = &sortOp{child: root, keys: keys}
+	}
+	if q.limit >= 0 || q.offset > 0 {
+		root = &limitOp{child: root, offset: q.offset, limit: q.limit}
+	}
+	if len(exprs) > len(columns) {
+		root = &projectOp{child: root, exprs: columnRefs(len(columns))}
+	}
+	return &queryIt{Iterator: root, columns: columns, schema: schema}, nil
+}
+
+// typeOf returns type of the expression result, AnyType when it depends on
+// the values
+func (s scope) typeOf(e expr) ColumnType {
+	switch e := e.(type) {
+	case *columnExpr:
+		if i, err := s.resolve(e); err == nil {
+			return s[i].typ
+		}
+	case *funcExpr:
+		if e.name == "COUNT" {
+			return Int64Type
+		}
+		if len(e.args) != 1 {
+			return AnyType
+		}
+		arg := s.typeOf(e.args[0])
+		switch {
+		case e.name == "MIN" || e.name == "MAX":
+			return arg
+		case arg != Int64Type && arg != DoubleType && arg != DecimalType:
+		case e.name == "SUM":
+			return arg
+		case e.name == "AVG" && arg == DecimalType:
+			return DecimalType
+		case e.name == "AVG":
+			return DoubleType
+		}
+	}
+	return AnyType
+}
+
+// planJoin joins the right table on the condition, equalities between
+// expressions of the left and right side are used as hash keys
+func planJoin(left, right Iterator, j joinClause, sc scope, leftWidth int) (Iterator, error) {
+	op := &joinOp{left: left, right: right, kind: j.kind, rightWidth: len(sc) - leftWidth}
+	c := &compiler{scope: sc}
+	rightCompiler := &compiler{scope: sc[leftWidth:]}
+	var residual expr
+	for _, e := range conjuncts(j.on) {
+		if b, ok := e.(*binaryExpr); ok && b.op == "=" {
+			l, errL := side(b.left, sc, leftWidth)
+			r, errR := side(b.right, sc, leftWidth)
+			if errL != nil || errR != nil {
+				return nil, fmt.Errorf("%w: join condition %s: %w", ErrInvalidQuery, b, coalesceErr(errL, errR))
+			}
+			lk, rk := b.left, b.right
+			if l == _rightSide && r == _leftSide {
+				lk, rk, l, r = rk, lk, r, l
+			}
+			if l == _leftSide && r == _rightSide {
+				leftKey, err := c.compile(lk)
+				if err != nil {
+					return nil, err
+				}
+				rightKey, err := rightCompiler.compile(rk)
+				if err != nil {
+					return nil, err
+				}
+				op.leftKeys = append(op.leftKeys, leftKey)
+				op.rightKeys = append(op.rightKeys, rightKey)
+				continue
+			}
+		}
+		if residual == nil {
+			residual = e
+		} else {
+			residual = &binaryExpr{op: "AND", left: residual, right: e}
+		}
+	}
+	if residual != nil {
+		cond, err := c.compile(residual)
+		if err != nil {
+			return nil, err
+		}
+		op.cond = cond
+	}
+	return op, nil
+}
+
+const (
+	_noSide = iota
+	_leftSide
+	_rightSide
+	_bothSides
+)
+
+// side returns which side of the join columns of the expression come from
+func side(e expr, sc scope, leftWidth int) (int, error) {
+	res := _noSide
+	var err error
+	walk(e, func(e expr) {
+		c, ok := e.(*columnExpr)
+		if !ok || err != nil {
+			return
+		}
+		var idx int
+		if idx, err = sc.resolve(c); err != nil {
+			return
+		}
+		s := _leftSide
+		if idx >= leftWidth {
+			s = _rightSide
+		}
+		switch res {
+		case _noSide:
+			res = s
+		case s:
+		default:
+			res = _bothSides
+		}
+	})
+	return res, err
+}
+
+func coalesceErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushdown returns predicates of WHERE skipping data objects for each table.
+// Tables of left joins get only predicates which are false for nulls since
+// rows padded with nulls are filtered out by them anyway.
+func pushdown(q *selectQuery, sc scope, scopes []scope) ([][]statsPredicate, error) {
+	preds := make([][]statsPredicate, len(scopes))
+	for _, e := range conjuncts(q.where) {
+		col, p, ok := conjunctPredicate(e)
+		if !ok {
+			continue
+		}
+		idx, err := sc.resolve(col)
+		if err != nil {
+			return nil, err
+		}
+		for i, s := range scopes {
+			if idx >= len(s) {
+				idx -= len(s)
+				continue
+			}
+			if i == 0 || q.joins[i-1].kind == _innerJoin || p.op != "IS NULL" {
+				preds[i] = append(preds[i], p)
+			}
+			break
+		}
+	}
+	return preds, nil
+}
+
+// conjunctPredicate matches condition which can be checked against the stats
+// of the column
+func conjunctPredicate(e expr) (*columnExpr, statsPredicate, bool) {
+	switch e := e.(type) {
+	case *isNullExpr:
+		c, ok := e.x.(*columnExpr)
+		if !ok {
+			return nil, statsPredicate{}, false
+		}
+		p := statsPredicate{column: c.name, op: "IS NULL"}
+		if e.not {
+			p.op = "IS NOT NULL"
+		}
+		return c, p, true
+	case *binaryExpr:
+		c, l, op, ok := columnComparison(e)
+		if !ok {
+			return nil, statsPredicate{}, false
+		}
+		return c, statsPredicate{column: c.name, op: op, value: l.value}, true
+	default:
+		return nil, statsPredicate{}, false
+	}
+}
+
+// columnComparison matches column compared with a literal, comparison is
+// flipped when the literal is on the left
+func columnComparison(e *binaryExpr) (*columnExpr, *literalExpr, string, bool) {
+	flipped := map[string]string{"=": "=", "<>": "<>", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	if _, ok := flipped[e.op]; !ok {
+		return nil, nil, "", false
+	}
+	if c, ok := e.left.(*columnExpr); ok {
+		if l, ok := e.right.(*literalExpr); ok {
+			return c, l, e.op, true
+		}
+	}
+	if c, ok := e.right.(*columnExpr); ok {
+		if l, ok := e.left.(*literalExpr); ok {
+			return c, l, flipped[e.op], true
+		}
+	}
+	return nil, nil, "", false
+}
+
+// conjuncts splits the condition on AND
+func conjuncts(e expr) []expr {
+	if e == nil {
+		return nil
+	}
+	if b, ok := e.(*binaryExpr); ok && b.op == "AND" {
+		return append(conjuncts(b.left), conjuncts(b.right)...)
+	}
+	return []expr{e}
+}
+
+// bind replaces placeholders of the query with the arguments
+func (q *selectQuery) bind(args []any) error {
+	var err error
+	bind := func(e expr) expr {
+		if err == nil {
+			e, err = bindExpr(e, args)
+		}
+		return e
+	}
+	for i := range q.items {
+		q.items[i].expr = bind(q.items[i].expr)
+	}
+	for i := range q.joins {
+		q.joins[i].on = bind(q.joins[i].on)
+	}
+	q.where = bind(q.where)
+	for i := range q.groupBy {
+		q.groupBy[i] = bind(q.groupBy[i])
+	}
+	q.having = bind(q.having)
+	for i := range q.orderBy {
+		q.orderBy[i].expr = bind(q.orderBy[i].expr)
+	}
+	return err
+}
+
+// bindExpr returns copy of the expression with placeholders replaced by the
+// arguments, the expression itself is not modified
+func bindExpr(e expr, args []any) (expr, error) {
+	var err error
+	switch e := e.(type) {
+	case *paramExpr:
+		if e.n > len(args) {
+			return nil, fmt.Errorf("%w: no value for parameter %s", ErrInvalidQuery, e)
+		}
+		return &literalExpr{value: normalizeValue(args[e.n-1])}, nil
+	case *unaryExpr:
+		b := *e
+		b.x, err = bindExpr(e.x, args)
+		return &b, err
+	case *binaryExpr:
+		b := *e
+		if b.left, err = bindExpr(e.left, args); err != nil {
+			return nil, err
+		}
+		b.right, err = bindExpr(e.right, args)
+		return &b, err
+	case *isNullExpr:
+		b := *e
+		b.x, err = bindExpr(e.x, args)
+		return &b, err
+	case *funcExpr:
+		b := *e
+		b.args = make([]expr, len(e.args))
+		for i, a := range e.args {
+			if b.args[i], err = bindExpr(a, args); err != nil {
+				return nil, err
+			}
+		}
+		return &b, nil
+	default:
+		return e, nil
+	}
+}
+
+// walk calls fn for the expression and all its subexpressions
+func walk(e expr, fn func(expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch e := e.(type) {
+	case *unaryExpr:
+		walk(e.x, fn)
+	case *binaryExpr:
+		walk(e.left, fn)
+		walk(e.right, fn)
+	case *isNullExpr:
+		walk(e.x, fn)
+	case *funcExpr:
+		for _, a := range e.args {
+			walk(a, fn)
+		}
+	}
+}
+
+func hasAggregate(e expr) bool {
+	found := false
+	walk(e, func(e expr) {
+		if f, ok := e.(*funcExpr); ok && isAggregate(f.name) {
+			found = true
+		}
+	})
+	return found
+}
+
+// expandStars replaces * and table.* with the columns
+func expandStars(items []selectItem, sc scope) ([]selectItem, error) {
+	res := make([]selectItem, 0, len(items))
+	for _, item := range items {
+		if !item.star {
+			res = append(res, item)
+			continue
+		}
+		found := false
+		for _, c := range sc {
+			if item.table == "" || item.table == c.table {
+				res = append(res, selectItem{expr: &columnExpr{table: c.table, name: c.name}, alias: c.name})
+				found = true
+			}
+		}
+		if !found && item.table != "" {
+			return nil, fmt.Errorf("%w: unknown table %s", ErrInvalidQuery, item.table)
+		}
+	}
+	return res, nil
+}
+
+func columnName(e expr) string {
+	switch e := e.(type) {
+	case *columnExpr:
+		return e.name
+	case *binaryExpr:
+		s := e.String()
+		return s[1 : len(s)-1]
+	default:
+		return e.String()
+	}
+}
+
+// orderColumn returns result column the ORDER BY item refers to by position,
+// name or the same expression, -1 when there is none
+func orderColumn(e expr, items []selectItem, columns []string) (int, error) {
+	if l, ok := e.(*literalExpr); ok {
+		n, ok := l.value.(int64)
+		if !ok || n < 1 || n > int64(len(columns)) {
+			return 0, fmt.Errorf("%w: ORDER BY position %s is not in select list", ErrInvalidQuery, l)
+		}
+		return int(n - 1), nil
+	}
+	if c, ok := e.(*columnExpr); ok && c.table == "" {
+		idx := -1
+		for i, name := range columns {
+			if name == c.name && items[i].alias != "" {
+				if idx >= 0 {
+					return 0, fmt.Errorf("%w: ORDER BY %s is ambiguous", ErrInvalidQuery, c)
+				}
+				idx = i
+			}
+		}
+		if idx >= 0 {
+			return idx, nil
+		}
+	}
+	for i, item := range items {
+		if item.expr.String() == e.String() {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func columnRefs(n int) []evalFunc {
+	res := make([]evalFunc, n)
+	for i := range res {
+		res[i] = func(row []any) (any, error) {
+			return row[i], nil
+		}
+	}
+	return res
+}
+
+// compiler turns expressions into functions evaluated on rows of the scope.
+// In grouped query rows are values of GROUP BY expressions followed by
+// aggregate results, columns outside of aggregates have to be grouped by.
+type compiler struct {
+	scope   scope
+	grouped bool
+	groups  []expr
+	aggs    []*aggregate
+}
+
+func (c *compiler) compile(e expr) (evalFunc, error) {
+	if c.grouped {
+		idx, err := c.groupIndex(e)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= 0 {
+			return func(row []any) (any, error) {
+				return row[idx], nil
+			}, nil
+		}
+	}
+
+	switch e := e.(type) {
+	case *literalExpr:
+		v := e.value
+		return func([]any) (any, error) {
+			return v, nil
+		}, nil
+	case *columnExpr:
+		if c.grouped {
+			return nil, fmt.Errorf("%w: column %s must appear in GROUP BY or be used in aggregate", ErrInvalidQuery, e)
+		}
+		idx, err := c.scope.resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []any) (any, error) {
+			return row[idx], nil
+		}, nil
+	case *funcExpr:
+		return c.compileFunc(e)
+	case *isNullExpr:
+		x, err := c.compile(e.x)
+		if err != nil {
+			return nil, err
+		}
+		not := e.not
+		return func(row []any) (any, error) {
+			v, err := x(row)
+			if err != nil {
+				return nil, err
+			}
+			return (v == nil) != not, nil
+		}, nil
+	case *unaryExpr:
+		x, err := c.compile(e.x)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == "NOT" {
+			return func(row []any) (any, error) {
+				v, err := x(row)
+				if err != nil || v == nil {
+					return nil, err
+				}
+				b, ok := v.(bool)
+				if !ok {
+					return nil, errNotBool(v)
+				}
+				return !b, nil
+			}, nil
+		}
+		return func(row []any) (any, error) {
+			v, err := x(row)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic("-", int64(0), v)
+		}, nil
+	case *binaryExpr:
+		return c.compileBinary(e)
+	default:
+		return nil, fmt.Errorf("%w: unsupported expression %s", ErrInvalidQuery, e)
+	}
+}
+
+// groupIndex returns position of the GROUP BY expression matching e, columns
+// match by the column they resolve to
+func (c *compiler) groupIndex(e expr) (int, error) {
+	col, isCol := e.(*columnExpr)
+	for i, g := range c.groups {
+		if g.String() == e.String() {
+			return i, nil
+		}
+		gc, ok := g.(*columnExpr)
+		if !ok || !isCol {
+			continue
+		}
+		a, err := c.scope.resolve(col)
+		if err != nil {
+			return 0, err
+		}
+		b, err := c.scope.resolve(gc)
+		if err != nil {
+			return 0, err
+		}
+		if a == b {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (c *compiler) compileBinary(e *binaryExpr) (evalFunc, error) {
+	left, err := c.compile(e.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.compile(e.right)
+	if err != nil {
+		return nil, err
+	}
+	op := e.op
+	switch op {
+	case "AND", "OR":
+		// three-valued logic, null is unknown
+		return func(row []any) (any, error) {
+			l, err := boolValue(left, row)
+			if err != nil {
+				return nil, err
+			}
+			if l != nil && *l == (op == "OR") {
+				return *l, nil
+			}
+			r, err := boolValue(right, row)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case r != nil && *r == (op == "OR"):
+				return *r, nil
+			case l == nil || r == nil:
+				return nil, nil
+			default:
+				return *r, nil
+			}
+		}, nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		return func(row []any) (any, error) {
+			l, err := left(row)
+			if err != nil {
+				return nil, err
+			}
+			r, err := right(row)
+			if err != nil || l == nil || r == nil {
+				return nil, err
+			}
+			cmp, err := compareValues(l, r)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "=":
+				return cmp == 0, nil
+			case "<>":
+				return cmp != 0, nil
+			case "<":
+				return cmp < 0, nil
+			case "<=":
+				return cmp <= 0, nil
+			case ">":
+				return cmp > 0, nil
+			default:
+				return cmp >= 0, nil
+			}
+		}, nil
+	default:
+		return func(row []any) (any, error) {
+			l, err := left(row)
+			if err != nil {
+				return nil, err
+			}
+			r, err := right(row)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic(op, l, r)
+		}, nil
+	}
+}
+
+func boolValue(fn evalFunc, row []any) (*bool, error) {
+	v, err := fn(row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, errNotBool(v)
+	}
+	return &b, nil
+}
+
+func errNotBool(v any) error {
+	return fmt.Errorf("%w: expected bool, got %s", ErrInvalidQuery, typeName(normalizeValue(v)))
+}
+
+func (c *compiler) compileFunc(e *funcExpr) (evalFunc, error) {
+	if !isAggregate(e.name) {
+		return nil, fmt.Errorf("%w: unknown function %s", ErrInvalidQuery, strings.ToLower(e.name))
+	}
+	if !c.grouped {
+		return nil, fmt.Errorf("%w: aggregate %s is not allowed here", ErrInvalidQuery, e)
+	}
+	if e.star && e.name != "COUNT" || !e.star && len(e.args) != 1 {
+		return nil, fmt.Errorf("%w: %s takes single argument", ErrInvalidQuery, strings.ToLower(e.name))
+	}
+	agg := &aggregate{name: e.name}
+	if !e.star {
+		// arguments are evaluated on rows being grouped, nested aggregates
+		// are rejected there
+		arg, err := (&compiler{scope: c.scope}).compile(e.args[0])
+		if err != nil {
+			return nil, err
+		}
+		agg.arg = arg
+	}
+	idx := len(c.groups) + len(c.aggs)
+	c.aggs = append(c.aggs, agg)
+	return func(row []any) (any, error) {
+		return row[idx], nil
+	}, nil
+}
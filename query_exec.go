@@ -0,0 +1,633 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"go.uber.org/multierr"
+)
+
+// Operators of the query plan implement Iterator, First restarts the
+// operator and Next may be called without First. Operators return new rows
+// where they change them, rows of the table may be shared with the row cache.
+
+// evalFunc computes value of the expression for the row of the operator
+type evalFunc func(row []any) (any, error)
+
+type scanOp struct {
+	ctx   context.Context
+	table *table
+	it    Iterator
+}
+
+func (s *scanOp) First() ([]any, error) {
+	if s.it == nil {
+		s.it = s.table.scan(s.ctx)
+	}
+	return s.it.First()
+}
+
+func (s *scanOp) Next() ([]any, error) {
+	if s.it == nil {
+		return s.First()
+	}
+	return s.it.Next()
+}
+
+func (s *scanOp) Close() error {
+	if s.it == nil {
+		return nil
+	}
+	return s.it.Close()
+}
+
+// rowsOp returns rows kept in memory
+type rowsOp struct {
+	rows [][]any
+	pos  int
+}
+
+func (r *rowsOp) First() ([]any, error) {
+	r.pos = 0
+	return r.Next()
+}
+
+func (r *rowsOp) Next() ([]any, error) {
+	if r.pos >= len(r.rows) {
+		return nil, ErrIteratorExhausted
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	return row, nil
+}
+
+func (r *rowsOp) Close() error {
+	return nil
+}
+
+// isTrue reports whether the condition holds, null is not true
+func isTrue(pred evalFunc, row []any) (bool, error) {
+	v, err := pred(row)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, errNotBool(v)
+	}
+	return b, nil
+}
+
+type filterOp struct {
+	child Iterator
+	pred  evalFunc
+}
+
+func (f *filterOp) First() ([]any, error) {
+	return f.skip(f.child.First())
+}
+
+func (f *filterOp) Next() ([]any, error) {
+	return f.skip(f.child.Next())
+}
+
+func (f *filterOp) skip(row []any, err error) ([]any, error) {
+	for ; err == nil; row, err = f.child.Next() {
+		ok, err := isTrue(f.pred, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return row, nil
+		}
+	}
+	return nil, err
+}
+
+func (f *filterOp) Close() error {
+	return f.child.Close()
+}
+
+// joinOp joins rows of the left operator with the right one which is read
+// into memory once. Rows are matched through hash index when the condition
+// has equalities between both sides, remaining condition is checked for
+// each candidate pair. Left join pads unmatched rows with nulls.
+type joinOp struct {
+	left, right Iterator
+	kind        int
+	leftKeys    []evalFunc
+	rightKeys   []evalFunc
+	cond        evalFunc // nil when the keys cover the condition
+	rightWidth  int
+
+	loaded     bool
+	rightRows  [][]any
+	index      map[string][][]any
+	cur        []any // current left row
+	candidates [][]any
+	pos        int
+	matched    bool
+}
+
+func (j *joinOp) First() ([]any, error) {
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	j.cur = nil
+	row, err := j.left.First()
+	if err != nil {
+		return nil, err
+	}
+	if err := j.setLeft(row); err != nil {
+		return nil, err
+	}
+	return j.Next()
+}
+
+func (j *joinOp) Next() ([]any, error) {
+	if !j.loaded {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if j.cur == nil {
+			row, err := j.left.Next()
+			if err != nil {
+				return nil, err
+			}
+			if err := j.setLeft(row); err != nil {
+				return nil, err
+			}
+		}
+		for j.pos < len(j.candidates) {
+			row := slices.Concat(j.cur, j.candidates[j.pos])
+			j.pos++
+			if j.cond != nil {
+				ok, err := isTrue(j.cond, row)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			j.matched = true
+			return row, nil
+		}
+		left := j.cur
+		j.cur = nil
+		if j.kind == _leftJoin && !j.matched {
+			return slices.Concat(left, make([]any, j.rightWidth)), nil
+		}
+	}
+}
+
+func (j *joinOp) Close() error {
+	return multierr.Append(j.left.Close(), j.right.Close())
+}
+
+func (j *joinOp) load() error {
+	if j.loaded {
+		return nil
+	}
+	j.rightRows = make([][]any, 0)
+	for row, err := j.right.First(); ; row, err = j.right.Next() {
+		if errors.Is(err, ErrIteratorExhausted) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		j.rightRows = append(j.rightRows, row)
+	}
+	if len(j.rightKeys) > 0 {
+		j.index = make(map[string][][]any)
+		for _, row := range j.rightRows {
+			key, ok, err := joinKey(j.rightKeys, row)
+			if err != nil {
+				return err
+			}
+			if ok {
+				j.index[key] = append(j.index[key], row)
+			}
+		}
+	}
+	j.loaded = true
+	return nil
+}
+
+func (j *joinOp) setLeft(row []any) error {
+	j.cur, j.pos, j.matched = row, 0, false
+	if len(j.leftKeys) == 0 {
+		j.candidates = j.rightRows
+		return nil
+	}
+	key, ok, err := joinKey(j.leftKeys, row)
+	if err != nil {
+		return err
+	}
+	j.candidates = nil
+	if ok {
+		j.candidates = j.index[key]
+	}
+	return nil
+}
+
+// joinKey returns hash key of the values, false when any is null since null
+// is not equal to anything
+func joinKey(keys []evalFunc, row []any) (string, bool, error) {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		v, err := k(row)
+		if err != nil || v == nil {
+			return "", false, err
+		}
+		values[i] = v
+	}
+	return compositeKey(values), true, nil
+}
+
+func compositeKey(values []any) string {
+	key := make([]byte, 0, 16*len(values))
+	for _, v := range values {
+		k := hashKey(v)
+		key = append(key, byte(len(k)), byte(len(k)>>8), byte(len(k)>>16), byte(len(k)>>24))
+		key = append(key, k...)
+	}
+	return string(key)
+}
+
+// aggregateOp groups rows by the keys, its rows are the key values followed
+// by results of the aggregates. Without keys all rows form single group
+// which exists even when there are no rows.
+type aggregateOp struct {
+	child Iterator
+	keys  []evalFunc
+	aggs  []*aggregate
+
+	out *rowsOp
+}
+
+type group struct {
+	keys   []any
+	states []aggState
+}
+
+func (a *aggregateOp) First() ([]any, error) {
+	if err := a.compute(); err != nil {
+		return nil, err
+	}
+	return a.out.First()
+}
+
+func (a *aggregateOp) Next() ([]any, error) {
+	if a.out == nil {
+		return a.First()
+	}
+	return a.out.Next()
+}
+
+func (a *aggregateOp) newGroup(keys []any) *group {
+	g := &group{keys: keys, states: make([]aggState, len(a.aggs))}
+	for i, agg := range a.aggs {
+		g.states[i] = agg.newState()
+	}
+	return g
+}
+
+func (a *aggregateOp) compute() error {
+	index := make(map[string]*group)
+	groups := make([]*group, 0)
+	for row, err := a.child.First(); ; row, err = a.child.Next() {
+		if errors.Is(err, ErrIteratorExhausted) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		keys := make([]any, len(a.keys))
+		for i, k := range a.keys {
+			if keys[i], err = k(row); err != nil {
+				return err
+			}
+		}
+		hk := compositeKey(keys)
+		g, ok := index[hk]
+		if !ok {
+			g = a.newGroup(keys)
+			index[hk] = g
+			groups = append(groups, g)
+		}
+		for i, agg := range a.aggs {
+			var v any
+			if agg.arg != nil {
+				if v, err = agg.arg(row); err != nil {
+					return err
+				}
+			}
+			if err := g.states[i].add(v); err != nil {
+				return err
+			}
+		}
+	}
+	if len(a.keys) == 0 && len(groups) == 0 {
+		groups = append(groups, a.newGroup(nil))
+	}
+
+	rows := make([][]any, len(groups))
+	for i, g := range groups {
+		row := make([]any, 0, len(g.keys)+len(g.states))
+		row = append(row, g.keys...)
+		for _, s := range g.states {
+			row = append(row, s.result())
+		}
+		rows[i] = row
+	}
+	a.out = &rowsOp{rows: rows}
+	return nil
+}
+
+func (a *aggregateOp) Close() error {
+	return a.child.Close()
+}
+
+type projectOp struct {
+	child Iterator
+	exprs []evalFunc
+}
+
+func (p *projectOp) First() ([]any, error) {
+	return p.project(p.child.First())
+}
+
+func (p *projectOp) Next() ([]any, error) {
+	return p.project(p.child.Next())
+}
+
+func (p *projectOp) project(row []any, err error) ([]any, error) {
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(p.exprs))
+	for i, e := range p.exprs {
+		if res[i], err = e(row); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (p *projectOp) Close() error {
+	return p.child.Close()
+}
+
+type sortKey struct {
+	column int
+	desc   bool
+}
+
+// sortOp orders all rows of the child, nulls are ordered after other values
+// as if they were the largest
+type sortOp struct {
+	child Iterator
+	keys  []sortKey
+
+	out *rowsOp
+}
+
+func (s *sortOp) First() ([]any, error) {
+	rows := make([][]any, 0)
+	for row, err := s.child.First(); ; row, err = s.child.Next() {
+		if errors.Is(err, ErrIteratorExhausted) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	var cmpErr error
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range s.keys {
+			c, err := compareNullable(rows[i][k.column], rows[j][k.column])
+			if err != nil {
+				cmpErr = err
+				return false
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	if cmpErr != nil {
+		return nil, cmpErr
+	}
+	s.out = &rowsOp{rows: rows}
+	return s.out.First()
+}
+
+func (s *sortOp) Next() ([]any, error) {
+	if s.out == nil {
+		return s.First()
+	}
+	return s.out.Next()
+}
+
+func (s *sortOp) Close() error {
+	return s.child.Close()
+}
+
+func compareNullable(a, b any) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return 1, nil
+	case b == nil:
+		return -1, nil
+	default:
+		return compareValues(a, b)
+	}
+}
+
+// limitOp skips offset rows and returns at most limit rows, negative limit
+// returns all of them
+type limitOp struct {
+	child  Iterator
+	offset int64
+	limit  int64
+
+	started  bool
+	returned int64
+}
+
+func (l *limitOp) First() ([]any, error) {
+	l.started, l.returned = true, 0
+	if l.limit == 0 {
+		return nil, ErrIteratorExhausted
+	}
+	row, err := l.child.First()
+	for i := int64(0); i < l.offset && err == nil; i++ {
+		row, err = l.child.Next()
+	}
+	return l.emit(row, err)
+}
+
+func (l *limitOp) Next() ([]any, error) {
+	if !l.started {
+		return l.First()
+	}
+	if l.limit >= 0 && l.returned >= l.limit {
+		return nil, ErrIteratorExhausted
+	}
+	return l.emit(l.child.Next())
+}
+
+func (l *limitOp) emit(row []any, err error) ([]any, error) {
+	if err != nil {
+		return nil, err
+	}
+	l.returned++
+	return row, nil
+}
+
+func (l *limitOp) Close() error {
+	return l.child.Close()
+}
+
+func isAggregate(name string) bool {
+	switch name {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	}
+	return false
+}
+
+type aggregate struct {
+	name string
+	arg  evalFunc // nil for COUNT(*)
+}
+
+// aggState accumulates values of single group, nulls are ignored except for
+// COUNT(*) which gets nil for every row
+type aggState interface {
+	add(v any) error
+	result() any
+}
+
+func (a *aggregate) newState() aggState {
+	switch a.name {
+	case "COUNT":
+		return &countState{star: a.arg == nil}
+	case "SUM":
+		return &sumState{}
+	case "AVG":
+		return &avgState{}
+	case "MIN":
+		return &minMaxState{sign: -1}
+	default:
+		return &minMaxState{sign: 1}
+	}
+}
+
+type countState struct {
+	star bool
+	n    int64
+}
+
+func (s *countState) add(v any) error {
+	if s.star || v != nil {
+		s.n++
+	}
+	return nil
+}
+
+func (s *countState) result() any {
+	return s.n
+}
+
+// sumState keeps the type of the values, sum of decimals is exact
+type sumState struct {
+	sum any
+}
+
+func (s *sumState) add(v any) error {
+	if v == nil {
+		return nil
+	}
+	v = normalizeValue(v)
+	if !isNumeric(v) {
+		return fmt.Errorf("%w: cannot sum %s", ErrInvalidQuery, typeName(v))
+	}
+	if s.sum == nil {
+		s.sum = v
+		return nil
+	}
+	sum, err := arithmetic("+", s.sum, v)
+	s.sum = sum
+	return err
+}
+
+func (s *sumState) result() any {
+	return s.sum
+}
+
+// avgState returns decimal average of decimals and double otherwise
+type avgState struct {
+	sumState
+	n int64
+}
+
+func (s *avgState) add(v any) error {
+	if v == nil {
+		return nil
+	}
+	s.n++
+	return s.sumState.add(v)
+}
+
+func (s *avgState) result() any {
+	if s.n == 0 {
+		return nil
+	}
+	if _, ok := s.sum.(Decimal); ok {
+		avg, _ := arithmetic("/", s.sum, s.n)
+		return avg
+	}
+	return toFloat(s.sum) / float64(s.n)
+}
+
+type minMaxState struct {
+	sign int // -1 keeps the smallest value, 1 the largest
+	v    any
+}
+
+func (s *minMaxState) add(v any) error {
+	if v == nil {
+		return nil
+	}
+	if s.v == nil {
+		s.v = v
+		return nil
+	}
+	cmp, err := compareValues(v, s.v)
+	if err != nil {
+		return err
+	}
+	if cmp*s.sign > 0 {
+		s.v = v
+	}
+	return nil
+}
+
+func (s *minMaxState) result() any {
+	return s.v
+}
@@ -0,0 +1,735 @@
+package deltalake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type sqlTokenKind int
+
+const (
+	_sqlEOF sqlTokenKind = iota
+	_sqlIdent
+	_sqlQuotedIdent
+	_sqlNumber
+	_sqlString
+	_sqlSymbol
+	_sqlParam // $n placeholder
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is the keyword or symbol, keywords are case
+// insensitive
+func (t sqlToken) is(text string) bool {
+	switch t.kind {
+	case _sqlIdent:
+		return strings.EqualFold(t.text, text)
+	case _sqlSymbol:
+		return t.text == text
+	default:
+		return false
+	}
+}
+
+func (t sqlToken) String() string {
+	switch t.kind {
+	case _sqlEOF:
+		return "end of query"
+	case _sqlString:
+		return "'" + t.text + "'"
+	default:
+		return t.text
+	}
+}
+
+func syntaxError(pos int, format string, args ...any) error {
+	return fmt.Errorf("%w at position %d: %s", ErrSyntax, pos, fmt.Sprintf(format, args...))
+}
+
+func lexQuery(query string) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: _sqlIdent, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: _sqlNumber, text: string(runes[start:i]), pos: start})
+		case c == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			tokens = append(tokens, sqlToken{kind: _sqlParam, text: string(runes[start:i]), pos: start})
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, syntaxError(start, "unterminated quoted text")
+				}
+				if runes[i] == c {
+					// doubled quote is the quote itself
+					if i+1 < len(runes) && runes[i+1] == c {
+						sb.WriteRune(c)
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+			}
+			kind := _sqlString
+			if c == '"' {
+				kind = _sqlQuotedIdent
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: sb.String(), pos: start})
+		default:
+			start := i
+			text := string(c)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<=", ">=", "<>", "!=":
+					text = two
+				}
+			}
+			if !strings.Contains("(),.*=<>+-/%;", text) && len(text) == 1 {
+				return nil, syntaxError(start, "unexpected character %q", c)
+			}
+			i += len([]rune(text))
+			tokens = append(tokens, sqlToken{kind: _sqlSymbol, text: text, pos: start})
+		}
+	}
+	return append(tokens, sqlToken{kind: _sqlEOF, pos: len(runes)}), nil
+}
+
+// expr is a node of the parsed expression, String returns canonical text
+// used as name of the result column and to match GROUP BY expressions
+type expr interface {
+	String() string
+}
+
+type literalExpr struct {
+	value any // nil, bool, int64, float64, string or value bound to parameter
+}
+
+// paramExpr is $n placeholder replaced by the n-th argument of the query
+type paramExpr struct {
+	n int
+}
+
+type columnExpr struct {
+	table string // empty when the column is not qualified
+	name  string
+}
+
+type unaryExpr struct {
+	op string // NOT or -
+	x  expr
+}
+
+type binaryExpr struct {
+	op          string // AND, OR, comparison or arithmetic operator
+	left, right expr
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+type funcExpr struct {
+	name string // upper case
+	args []expr
+	star bool // COUNT(*)
+}
+
+func (e *literalExpr) String() string {
+	switch v := e.value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (e *paramExpr) String() string {
+	return "$" + strconv.Itoa(e.n)
+}
+
+func (e *columnExpr) String() string {
+	if e.table == "" {
+		return e.name
+	}
+	return e.table + "." + e.name
+}
+
+func (e *unaryExpr) String() string {
+	if e.op == "NOT" {
+		return "NOT " + e.x.String()
+	}
+	return e.op + e.x.String()
+}
+
+func (e *binaryExpr) String() string {
+	return "(" + e.left.String() + " " + e.op + " " + e.right.String() + ")"
+}
+
+func (e *isNullExpr) String() string {
+	if e.not {
+		return e.x.String() + " IS NOT NULL"
+	}
+	return e.x.String() + " IS NULL"
+}
+
+func (e *funcExpr) String() string {
+	if e.star {
+		return strings.ToLower(e.name) + "(*)"
+	}
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = a.String()
+	}
+	return strings.ToLower(e.name) + "(" + strings.Join(args, ", ") + ")"
+}
+
+type selectItem struct {
+	expr  expr
+	alias string
+	star  bool   // * or table.*
+	table string // qualifier of table.*
+}
+
+type tableRef struct {
+	name  string
+	alias string // name when not given
+}
+
+const (
+	_innerJoin = iota
+	_leftJoin
+)
+
+type joinClause struct {
+	kind  int
+	table tableRef
+	on    expr
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+type selectQuery struct {
+	items   []selectItem
+	from    *tableRef // nil for SELECT without FROM
+	joins   []joinClause
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+	limit   int64 // -1 when not limited
+	offset  int64
+}
+
+// _reservedWords can't be used as table aliases without AS
+var _reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "HAVING": true,
+	"ORDER": true, "LIMIT": true, "OFFSET": true, "JOIN": true, "INNER": true,
+	"LEFT": true, "OUTER": true, "ON": true, "AND": true, "OR": true, "NOT": true,
+	"AS": true, "BY": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true,
+}
+
+type queryParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// parseQuery parses single SELECT statement, trailing semicolon is allowed
+func parseQuery(query string) (*selectQuery, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	if t := p.peek(); t.kind != _sqlEOF {
+		return nil, syntaxError(t.pos, "unexpected %s", t)
+	}
+	return q, nil
+}
+
+// parseExpression parses standalone expression like the condition of
+// QueryWhere
+func parseExpression(text string) (expr, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != _sqlEOF {
+		return nil, syntaxError(t.pos, "unexpected %s", t)
+	}
+	return e, nil
+}
+
+func (p *queryParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) advance() sqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != _sqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the token if it is the keyword or symbol
+func (p *queryParser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return syntaxError(t.pos, "expected %s, got %s", text, t)
+	}
+	return nil
+}
+
+func (p *queryParser) parseIdent() (string, error) {
+	t := p.peek()
+	switch {
+	case t.kind == _sqlQuotedIdent:
+	case t.kind == _sqlIdent && !_reservedWords[strings.ToUpper(t.text)]:
+	default:
+		return "", syntaxError(t.pos, "expected name, got %s", t)
+	}
+	p.advance()
+	return t.text, nil
+}
+
+func (p *queryParser) parseSelect() (*selectQuery, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	q := &selectQuery{limit: -1}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, item)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if p.accept("FROM") {
+		from, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		q.from = &from
+		for {
+			kind := _innerJoin
+			switch {
+			case p.accept("JOIN"):
+			case p.accept("INNER"):
+				if err := p.expect("JOIN"); err != nil {
+					return nil, err
+				}
+			case p.accept("LEFT"):
+				p.accept("OUTER")
+				if err := p.expect("JOIN"); err != nil {
+					return nil, err
+				}
+				kind = _leftJoin
+			default:
+				goto joined
+			}
+			table, err := p.parseTableRef()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("ON"); err != nil {
+				return nil, err
+			}
+			on, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			q.joins = append(q.joins, joinClause{kind: kind, table: table, on: on})
+		}
+	}
+joined:
+
+	var err error
+	if p.accept("WHERE") {
+		if q.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			q.groupBy = append(q.groupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("HAVING") {
+		if q.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{expr: e}
+			if p.accept("DESC") {
+				item.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		if q.limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("OFFSET") {
+		if q.offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (p *queryParser) parseCount() (int64, error) {
+	t := p.advance()
+	n, err := strconv.ParseInt(t.text, 10, 64)
+	if t.kind != _sqlNumber || err != nil || n < 0 {
+		return 0, syntaxError(t.pos, "expected non-negative integer, got %s", t)
+	}
+	return n, nil
+}
+
+func (p *queryParser) parseSelectItem() (selectItem, error) {
+	if p.accept("*") {
+		return selectItem{star: true}, nil
+	}
+	// table.*
+	if t := p.peek(); (t.kind == _sqlIdent || t.kind == _sqlQuotedIdent) &&
+		p.tokens[p.pos+1].is(".") && p.tokens[p.pos+2].is("*") {
+		p.pos += 3
+		return selectItem{star: true, table: t.text}, nil
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{expr: e}
+	if p.accept("AS") {
+		item.alias, err = p.parseIdent()
+	} else if t := p.peek(); t.kind == _sqlQuotedIdent || t.kind == _sqlIdent && !_reservedWords[strings.ToUpper(t.text)] {
+		item.alias, err = p.parseIdent()
+	}
+	return item, err
+}
+
+func (p *queryParser) parseTableRef() (tableRef, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return tableRef{}, err
+	}
+	ref := tableRef{name: name, alias: name}
+	if p.accept("AS") {
+		ref.alias, err = p.parseIdent()
+	} else if t := p.peek(); t.kind == _sqlQuotedIdent || t.kind == _sqlIdent && !_reservedWords[strings.ToUpper(t.text)] {
+		ref.alias, err = p.parseIdent()
+	}
+	return ref, err
+}
+
+// parseExpr parses expression, operators from the lowest precedence are
+// OR, AND, NOT, comparisons and IS NULL, + -, * / %, unary minus
+func (p *queryParser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *queryParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (expr, error) {
+	if p.accept("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{x: left, not: not}, nil
+	}
+	for _, op := range []string{"=", "<>", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if op == "!=" {
+				op = "<>"
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !op.is("+") && !op.is("-") {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op.text, left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !op.is("*") && !op.is("/") && !op.is("%") {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op.text, left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// negative literals are kept as literals so they can be pushed down
+		if l, ok := x.(*literalExpr); ok {
+			switch v := l.value.(type) {
+			case int64:
+				return &literalExpr{value: -v}, nil
+			case float64:
+				return &literalExpr{value: -v}, nil
+			}
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	}
+	p.accept("+")
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (expr, error) {
+	t := p.advance()
+	switch t.kind {
+	case _sqlNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literalExpr{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, syntaxError(t.pos, "invalid number %s", t.text)
+		}
+		return &literalExpr{value: f}, nil
+	case _sqlString:
+		return &literalExpr{value: t.text}, nil
+	case _sqlParam:
+		n, err := strconv.Atoi(t.text[1:])
+		if err != nil || n < 1 {
+			return nil, syntaxError(t.pos, "invalid parameter %s", t.text)
+		}
+		return &paramExpr{n: n}, nil
+	case _sqlSymbol:
+		if t.text == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case _sqlIdent, _sqlQuotedIdent:
+		if t.kind == _sqlIdent {
+			switch strings.ToUpper(t.text) {
+			case "NULL":
+				return &literalExpr{}, nil
+			case "TRUE":
+				return &literalExpr{value: true}, nil
+			case "FALSE":
+				return &literalExpr{value: false}, nil
+			}
+			if p.peek().is("(") {
+				return p.parseCall(t)
+			}
+			if _reservedWords[strings.ToUpper(t.text)] {
+				break
+			}
+		}
+		if p.accept(".") {
+			name, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &columnExpr{table: t.text, name: name}, nil
+		}
+		return &columnExpr{name: t.text}, nil
+	}
+	return nil, syntaxError(t.pos, "unexpected %s", t)
+}
+
+func (p *queryParser) parseCall(name sqlToken) (expr, error) {
+	p.advance() // (
+	f := &funcExpr{name: strings.ToUpper(name.text)}
+	if p.accept("*") {
+		f.star = true
+		return f, p.expect(")")
+	}
+	if p.accept(")") {
+		return f, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		f.args = append(f.args, arg)
+		if p.accept(")") {
+			return f, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func prepareQueryTables(t *testing.T, cl DeltaStorage) {
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("users", Schema{
+		{Name: "id", Type: Int64Type},
+		{Name: "name", Type: StringType},
+		{Name: "city", Type: StringType},
+	}))
+	require.NoError(t, tx.CreateWithSchema("orders", Schema{
+		{Name: "id", Type: Int64Type},
+		{Name: "user_id", Type: Int64Type},
+		{Name: "amount", Type: DecimalType},
+		{Name: "created", Type: TimestampType},
+	}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	for _, u := range [][]any{{1, "ann", "oslo"}, {2, "bob", "rome"}, {3, "cid", "oslo"}, {4, "dan", nil}} {
+		require.NoError(t, tx.Put("users", u))
+	}
+	require.NoError(t, tx.Commit())
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, o := range [][]any{
+		{1, 1, "10.50"}, {2, 1, "4.25"}, {3, 2, "7"}, {4, 3, "1.25"}, {5, 9, "3"},
+	} {
+		// every order is in its own data object
+		tx = cl.NewTransaction()
+		require.NoError(t, tx.Put("orders", append(o, day.AddDate(0, 0, i))))
+		require.NoError(t, tx.Commit())
+	}
+}
+
+func queryRows(t *testing.T, tx *Transaction, query string) ([]string, [][]any) {
+	t.Helper()
+	it, err := tx.Query(query)
+	require.NoError(t, err, query)
+	defer it.Close()
+	return it.Columns(), collectRows(t, it)
+}
+
+func TestQuery(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareQueryTables(t, cl)
+	tx := cl.NewTransaction()
+
+	for _, tc := range []struct {
+		query   string
+		columns []string
+		rows    [][]any
+	}{
+		{
+			query:   "SELECT * FROM users WHERE id >= 3",
+			columns: []string{"id", "name", "city"},
+			rows:    [][]any{{int64(3), "cid", "oslo"}, {int64(4), "dan", nil}},
+		},
+		{
+			query:   "select name, id * 10 AS x FROM users WHERE city = 'oslo' OR city IS NULL ORDER BY x DESC LIMIT 2",
+			columns: []string{"name", "x"},
+			rows:    [][]any{{"dan", int64(40)}, {"cid", int64(30)}},
+		},
+		{
+			query:   "SELECT name FROM users ORDER BY city, id DESC LIMIT 2 OFFSET 1",
+			columns: []string{"name"},
+			rows:    [][]any{{"ann"}, {"bob"}},
+		},
+		{
+			query:   "SELECT city, count(*), count(city) AS n, min(name) FROM users GROUP BY city ORDER BY 2 DESC, city",
+			columns: []string{"city", "count(*)", "n", "min(name)"},
+			rows:    [][]any{{"oslo", int64(2), int64(2), "ann"}, {"rome", int64(1), int64(1), "bob"}, {nil, int64(1), int64(0), "dan"}},
+		},
+		{
+			query:   "SELECT sum(amount), avg(amount), max(created), count(*) FROM orders WHERE user_id <> 9",
+			columns: []string{"sum(amount)", "avg(amount)", "max(created)", "count(*)"},
+			rows:    [][]any{{Decimal("23"), Decimal("5.75"), time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC), int64(4)}},
+		},
+		{
+			query:   "SELECT count(*), sum(id) FROM users WHERE id > 100",
+			columns: []string{"count(*)", "sum(id)"},
+			rows:    [][]any{{int64(0), nil}},
+		},
+		{
+			query:   "SELECT u.name, o.amount FROM users u JOIN orders AS o ON o.user_id = u.id AND o.amount > 4 ORDER BY o.id",
+			columns: []string{"name", "amount"},
+			rows:    [][]any{{"ann", Decimal("10.50")}, {"ann", Decimal("4.25")}, {"bob", Decimal("7")}},
+		},
+		{
+			query:   "SELECT u.name, count(o.id) AS orders, sum(o.amount) FROM users u LEFT JOIN orders o ON u.id = o.user_id GROUP BY u.name HAVING count(o.id) < 2 ORDER BY u.name",
+			columns: []string{"name", "orders", "sum(o.amount)"},
+			rows:    [][]any{{"bob", int64(1), Decimal("7")}, {"cid", int64(1), Decimal("1.25")}, {"dan", int64(0), nil}},
+		},
+		{
+			query:   "SELECT o.id FROM orders o LEFT JOIN users u ON u.id = o.user_id WHERE u.id IS NULL",
+			columns: []string{"id"},
+			rows:    [][]any{{int64(5)}},
+		},
+		{
+			query:   "SELECT id FROM orders WHERE created >= '2024-01-04' AND amount < 5",
+			columns: []string{"id"},
+			rows:    [][]any{{int64(4)}, {int64(5)}},
+		},
+		{
+			query:   "SELECT 1 + 2 * 3, 7 / 2, 7.0 / 2, NULL IS NULL, NOT (1 = 1 OR NULL)",
+			columns: []string{"1 + (2 * 3)", "7 / 2", "7 / 2", "NULL IS NULL", "NOT ((1 = 1) OR NULL)"},
+			rows:    [][]any{{int64(7), int64(3), 3.5, true, false}},
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			columns, rows := queryRows(t, tx, tc.query)
+			assert.Equal(t, tc.columns, columns)
+			assert.Equal(t, tc.rows, rows)
+		})
+	}
+	require.NoError(t, tx.Commit())
+}
+
+func TestQueryIterator(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareQueryTables(t, cl)
+	tx := cl.NewTransaction()
+
+	// restarting returns the same rows, Next works without First
+	it, err := tx.Query("SELECT id FROM orders ORDER BY id DESC LIMIT 2")
+	require.NoError(t, err)
+	row, err := it.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(5)}, row)
+	assert.Equal(t, [][]any{{int64(5)}, {int64(4)}}, collectRows(t, it))
+	assert.Equal(t, [][]any{{int64(5)}, {int64(4)}}, collectRows(t, it))
+	assert.NoError(t, it.Close())
+
+	// rows put in the transaction are visible after commit
+	require.NoError(t, tx.Put("users", []any{5, "eve", "rome"}))
+	_, rows := queryRows(t, tx, "SELECT count(*) FROM users")
+	assert.Equal(t, [][]any{{int64(4)}}, rows)
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	_, rows = queryRows(t, tx, "SELECT count(*) FROM users")
+	assert.Equal(t, [][]any{{int64(5)}}, rows)
+
+	// result columns are typed by the columns and aggregates they come from
+	it, err = tx.Query("SELECT u.id, name AS n, count(*), sum(amount), avg(o.id), max(created), 1 FROM users u JOIN orders o ON u.id = user_id GROUP BY u.id, name")
+	require.NoError(t, err)
+	types := make([]ColumnType, 0)
+	for i, c := range it.Schema() {
+		assert.Equal(t, it.Columns()[i], c.Name)
+		types = append(types, c.Type)
+	}
+	assert.Equal(t, []ColumnType{Int64Type, StringType, Int64Type, DecimalType, DoubleType, TimestampType, AnyType}, types)
+	assert.NoError(t, it.Close())
+	tables, err := QueryTables("SELECT * FROM users u JOIN orders o ON u.id = o.user_id LEFT JOIN users x ON x.id = o.id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "orders"}, tables)
+	assert.Equal(t, []string{"orders", "users"}, tx.Tables())
+
+	_, err = tx.Query("SELECT * FROM missing")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	for _, query := range []string{
+		"SELECT",
+		"SELECT id FROM users WHERE",
+		"SELECT id FROM users LIMIT -1",
+		"SELECT 'abc",
+		"SELECT id FROM users extra tokens",
+		"SELECT missing FROM users",
+		"SELECT id FROM users u JOIN orders o ON id = user_id",
+		"SELECT name, count(*) FROM users",
+		"SELECT id FROM users WHERE count(*) > 1",
+		"SELECT sum(count(*)) FROM users",
+		"SELECT lower(name) FROM users",
+		"SELECT id FROM users ORDER BY 3",
+		"SELECT id FROM users u JOIN users u ON u.id = u.id",
+		"SELECT id FROM users HAVING id > 1",
+	} {
+		_, err := tx.Query(query)
+		assert.ErrorIs(t, err, ErrInvalidQuery, query)
+	}
+
+	for _, query := range []string{
+		"SELECT id / 0 FROM users",
+		"SELECT sum(name) FROM users",
+		"SELECT id FROM users WHERE name > 1",
+		"SELECT id FROM users WHERE id",
+	} {
+		it, err := tx.Query(query)
+		require.NoError(t, err, query)
+		_, err = it.First()
+		assert.True(t, errors.Is(err, ErrInvalidQuery), "%s: %v", query, err)
+		assert.NoError(t, it.Close())
+	}
+	require.NoError(t, tx.Commit())
+}
+
+func TestQueryParams(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareQueryTables(t, cl)
+	tx := cl.NewTransaction()
+	defer tx.Rollback()
+
+	it, err := tx.Query("SELECT id, $2 FROM orders WHERE user_id = $1 AND created < $3 ORDER BY id",
+		1, "x", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(1), "x"}}, collectRows(t, it))
+	assert.NoError(t, it.Close())
+	_, err = tx.Query("SELECT id FROM users WHERE id = $2", 1)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	it, err = tx.QueryWhere(context.Background(), "users", "city = 'oslo' AND id > 1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "city"}, it.Columns())
+	assert.Equal(t, [][]any{{int64(3), "cid", "oslo"}}, collectRows(t, it))
+	assert.NoError(t, it.Close())
+	it, err = tx.QueryWhere(context.Background(), "users", "")
+	require.NoError(t, err)
+	assert.Len(t, collectRows(t, it), 4)
+	assert.NoError(t, it.Close())
+	_, err = tx.QueryWhere(context.Background(), "users", "missing = 1")
+	assert.ErrorIs(t, err, ErrUnknownColumn)
+	_, err = tx.QueryWhere(context.Background(), "users", "id =")
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = tx.QueryWhere(context.Background(), "missing", "")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
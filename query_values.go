@@ -0,0 +1,329 @@
+package deltalake
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _decimalDivScale is the number of fractional digits kept when the decimal
+// result has no finite representation, like 1/3
+const _decimalDivScale = 18
+
+var errDivisionByZero = fmt.Errorf("%w: division by zero", ErrInvalidQuery)
+
+// normalizeValue converts Go numeric types to int64 and float64 which the
+// query engine works with
+func normalizeValue(v any) any {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint:
+		if n > math.MaxInt64 {
+			return float64(n)
+		}
+		return int64(n)
+	case uint64:
+		if n > math.MaxInt64 {
+			return float64(n)
+		}
+		return int64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
+
+func isNumeric(v any) bool {
+	switch v.(type) {
+	case int64, float64, Decimal:
+		return true
+	}
+	return false
+}
+
+// toRat returns exact value of the number, false for non-finite floats
+func toRat(v any) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case float64:
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(n), true
+	case Decimal:
+		return new(big.Rat).SetString(string(n))
+	}
+	return nil, false
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case Decimal:
+		f, _ := strconv.ParseFloat(string(n), 64)
+		return f
+	}
+	return math.NaN()
+}
+
+// ratDecimal formats the number with all fractional digits when it has
+// finite decimal representation
+func ratDecimal(r *big.Rat) Decimal {
+	if r.IsInt() {
+		return Decimal(r.Num().String())
+	}
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five, rem := big.NewInt(2), big.NewInt(5), new(big.Int)
+	for {
+		if q, m := new(big.Int).QuoRem(denom, two, rem); m.Sign() == 0 {
+			denom, twos = q, twos+1
+			continue
+		}
+		if q, m := new(big.Int).QuoRem(denom, five, rem); m.Sign() == 0 {
+			denom, fives = q, fives+1
+			continue
+		}
+		break
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return Decimal(r.FloatString(_decimalDivScale))
+	}
+	return Decimal(r.FloatString(max(twos, fives)))
+}
+
+// compareValues orders two non-null values. Numbers of any type are compared
+// by value, timestamps can be compared with timestamp text.
+func compareValues(a, b any) (int, error) {
+	a, b = normalizeValue(a), normalizeValue(b)
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmpOrdered(x, y), nil
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmpOrdered(x, y), nil
+		}
+	case string:
+		switch y := b.(type) {
+		case string:
+			return strings.Compare(x, y), nil
+		case time.Time:
+			ts, err := parseTimestamp(x)
+			if err != nil {
+				return 0, err
+			}
+			return ts.Compare(y), nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, nil
+			case !x:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	case time.Time:
+		switch y := b.(type) {
+		case time.Time:
+			return x.Compare(y), nil
+		case string:
+			ts, err := parseTimestamp(y)
+			if err != nil {
+				return 0, err
+			}
+			return x.Compare(ts), nil
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), nil
+		}
+	}
+	if isNumeric(a) && isNumeric(b) {
+		ra, okA := toRat(a)
+		rb, okB := toRat(b)
+		if okA && okB {
+			return ra.Cmp(rb), nil
+		}
+		return cmpOrdered(toFloat(a), toFloat(b)), nil
+	}
+	return 0, fmt.Errorf("%w: cannot compare %s with %s", ErrInvalidQuery, typeName(a), typeName(b))
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// _timestampLayouts are accepted in timestamp text, besides RFC 3339 the
+// space separated form used by SQL clients
+var _timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	time.DateOnly,
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range _timestampLayouts {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidQuery, s)
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case int64:
+		return "int64"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case Decimal:
+		return "decimal"
+	case time.Time:
+		return "timestamp"
+	case []byte:
+		return "bytes"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "struct"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// arithmetic applies + - * / % to numbers, result is decimal when any
+// operand is decimal, double when any is double and int64 otherwise
+func arithmetic(op string, a, b any) (any, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	a, b = normalizeValue(a), normalizeValue(b)
+	if !isNumeric(a) || !isNumeric(b) {
+		return nil, fmt.Errorf("%w: operator %s is not defined for %s and %s", ErrInvalidQuery, op, typeName(a), typeName(b))
+	}
+	x, okX := a.(int64)
+	y, okY := b.(int64)
+	if okX && okY {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/", "%":
+			if y == 0 {
+				return nil, errDivisionByZero
+			}
+			if op == "/" {
+				return x / y, nil
+			}
+			return x % y, nil
+		}
+	}
+	_, decA := a.(Decimal)
+	_, decB := b.(Decimal)
+	if decA || decB {
+		ra, okA := toRat(a)
+		rb, okB := toRat(b)
+		if okA && okB {
+			switch op {
+			case "+":
+				return ratDecimal(ra.Add(ra, rb)), nil
+			case "-":
+				return ratDecimal(ra.Sub(ra, rb)), nil
+			case "*":
+				return ratDecimal(ra.Mul(ra, rb)), nil
+			case "/":
+				if rb.Sign() == 0 {
+					return nil, errDivisionByZero
+				}
+				return ratDecimal(ra.Quo(ra, rb)), nil
+			}
+		}
+	}
+	fx, fy := toFloat(a), toFloat(b)
+	switch op {
+	case "+":
+		return fx + fy, nil
+	case "-":
+		return fx - fy, nil
+	case "*":
+		return fx * fy, nil
+	case "/":
+		if fy == 0 {
+			return nil, errDivisionByZero
+		}
+		return fx / fy, nil
+	case "%":
+		if fy == 0 {
+			return nil, errDivisionByZero
+		}
+		return math.Mod(fx, fy), nil
+	}
+	return nil, fmt.Errorf("%w: unknown operator %s", ErrInvalidQuery, op)
+}
+
+// hashKey returns key under which the value is grouped or joined, values
+// comparing as equal have the same key
+func hashKey(v any) string {
+	v = normalizeValue(v)
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case int64, float64, Decimal:
+		if r, ok := toRat(x); ok {
+			return "n" + r.RatString()
+		}
+		return "f" + strconv.FormatFloat(toFloat(x), 'g', -1, 64)
+	case string:
+		return "s" + x
+	case bool:
+		return "b" + strconv.FormatBool(x)
+	case time.Time:
+		return "t" + strconv.FormatInt(x.UnixNano(), 10)
+	case []byte:
+		return "x" + string(x)
+	default:
+		return fmt.Sprintf("%T%v", x, x)
+	}
+}
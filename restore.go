@@ -0,0 +1,120 @@
+package deltalake
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Restore brings the table back to its state at the version. Data objects are
+// not copied, the commit removes files added after the version and adds back
+// files removed since then. Restore fails with ErrFileNotFound when files of
+// the version were already deleted from the storage. The table can't be
+// changed in the transaction before Restore.
+func (tx *Transaction) Restore(table string, version int64) error {
+	current, ok := tx.tables[table]
+	if !ok {
+		return tableError(table, ErrTableNotFound)
+	}
+	if tx.buffered(table) || slices.ContainsFunc(tx.actions, func(a action) bool { return a.getTable() == table }) {
+		return tableError(table, errors.New("table was changed in the transaction before restore"))
+	}
+	if version < 0 || version >= tx.id {
+		return tableError(table, fmt.Errorf("%w: %d", ErrVersionNotFound, version))
+	}
+	target, err := tx.d.tableAt(table, version)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]action, 0)
+	if !slices.Equal(current.schema, target.schema) || !maps.Equal(current.properties, target.properties) {
+		cm := newChangeMetadaAction(table, target.schema)
+		cm.Properties = target.properties
+		actions = append(actions, cm)
+	}
+	// data objects with other deletion vector in the target are added back
+	// with it
+	for _, f := range current.files {
+		if !sameDataObject(current, target, f) {
+			actions = append(actions, current.removeAction(f))
+		}
+	}
+	restored := make([]string, 0)
+	for _, f := range target.files {
+		if !sameDataObject(target, current, f) {
+			restored = append(restored, f)
+		}
+	}
+	if len(restored) > 0 {
+		existing, err := tx.d.internalStorage.List("", fmt.Sprintf("_table_%s_", table))
+		if err != nil {
+			return err
+		}
+		vectors, err := tx.d.internalStorage.List("", fmt.Sprintf("_dv_%s_", table))
+		if err != nil {
+			return err
+		}
+		for _, f := range restored {
+			dv := target.deletionVectors[f]
+			if !slices.Contains(existing, f) || dv != nil && !slices.Contains(vectors, dv.File) {
+				return tableError(table, fmt.Errorf("%w: %s of version %d", ErrFileNotFound, f, version))
+			}
+			ao := newDataObjAction(table, f, _add)
+			ao.Stats = target.stats[f]
+			ao.DeletionVector = dv
+			actions = append(actions, ao)
+		}
+	}
+
+	tx.actions = append(tx.actions, actions...)
+	tx.setOperation("RESTORE", map[string]string{"version": strconv.FormatInt(version, 10)})
+	return nil
+}
+
+// sameDataObject reports whether the file of a is in b with the same deletion
+// vector
+func sameDataObject(a, b *table, f string) bool {
+	return slices.Contains(b.files, f) && dvFile(a.deletionVectors[f]) == dvFile(b.deletionVectors[f])
+}
+
+func dvFile(dv *deletionVector) string {
+	if dv == nil {
+		return ""
+	}
+	return dv.File
+}
+
+// tableAt builds the table from the log up to the version
+func (d *delta) tableAt(name string, version int64) (*table, error) {
+	versions, err := d.log.Versions()
+	if err != nil {
+		return nil, err
+	}
+	tb := newTableBuilder(name, d.internalStorage, d.rows)
+	exists := false
+	for _, v := range versions {
+		if v > version {
+			break
+		}
+		actions, err := d.readActions(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range actions {
+			if a.getTable() != name {
+				continue
+			}
+			if _, ok := a.(*changeMetadata); ok {
+				exists = true
+			}
+			tb.add(a)
+		}
+	}
+	if !exists {
+		return nil, tableError(name, fmt.Errorf("%w at version %d", ErrTableNotFound, version))
+	}
+	return tb.build(), nil
+}
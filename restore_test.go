@@ -0,0 +1,98 @@
+package deltalake
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestore(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.Create("foo", []string{"id"}))
+	require.NoError(t, tx.Create("bar", []string{"id"}))
+	require.NoError(t, tx.Commit())
+	for _, id := range []int{1, 2, 3} {
+		tx = cl.NewTransaction()
+		require.NoError(t, tx.Put("foo", []any{id}))
+		require.NoError(t, tx.Commit())
+	}
+	ids := func() []any {
+		tx := cl.NewTransaction()
+		defer tx.Rollback()
+		res := make([]any, 0)
+		for _, row := range collectRows(t, mustIter(t, tx, "foo")) {
+			res = append(res, row[0])
+		}
+		return res
+	}
+	require.Equal(t, []any{1.0, 2.0, 3.0}, ids())
+
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 1))
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []any{1.0}, ids())
+
+	history, err := cl.History("foo", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "RESTORE", history[0].Operation)
+	assert.Equal(t, map[string]string{"version": "1"}, history[0].OperationParameters)
+	assert.Equal(t, int64(2), history[0].Metrics["numRemovedFiles"])
+
+	// removed files are added back
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 3))
+	require.NoError(t, tx.Put("foo", []any{4}))
+	require.NoError(t, tx.Put("bar", []any{1}))
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []any{1.0, 2.0, 3.0, 4.0}, ids())
+
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Restore("foo", 0))
+	require.NoError(t, tx.Commit())
+	assert.Empty(t, ids())
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	assert.ErrorIs(t, tx.Restore("foo", 100), ErrVersionNotFound)
+	assert.ErrorIs(t, tx.Restore("foo", -1), ErrVersionNotFound)
+	assert.ErrorIs(t, tx.Restore("missing", 1), ErrTableNotFound)
+	require.NoError(t, tx.Put("bar", []any{2}))
+	assert.Error(t, tx.Restore("bar", 0))
+
+	// data objects deleted from the storage can't be restored, only the
+	// empty data object flushed on create is left in the table
+	require.Len(t, tx.tables["foo"].files, 1)
+	restored, err := tx.d.tableAt("foo", 2)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(path.Join(testdir, restored.files[1])))
+	assert.ErrorIs(t, tx.Restore("foo", 2), ErrFileNotFound)
+	assert.Empty(t, tx.actions)
+}
+
+func TestRestoreMissingTable(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.Create("foo", []string{"id"}))
+	require.NoError(t, tx.Commit())
+
+	// table can't be restored to version before it was created
+	tx = cl.NewTransaction()
+	_, err := tx.d.tableAt("bar", 0)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	require.NoError(t, tx.CreateWithSchema("bar", Schema{{Name: "id", Type: Int64Type}}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	assert.ErrorIs(t, tx.Restore("bar", 0), ErrTableNotFound)
+	require.NoError(t, tx.Rollback())
+}
@@ -0,0 +1,253 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"sync"
+)
+
+const (
+	_scanBatchSize = 256
+)
+
+type ScanOptions struct {
+	// Parallelism is the number of data objects fetched and decoded
+	// concurrently, values <= 1 scan files sequentially.
+	Parallelism int
+	// Prefetch is the number of row batches buffered ahead of the consumer
+	// per data object.
+	Prefetch int
+	// Unordered returns rows in the order files were decoded instead of the
+	// order of files in the table.
+	Unordered bool
+}
+
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Parallelism: 1,
+		Prefetch:    1,
+	}
+}
+
+func (t *table) scanWithOptions(ctx context.Context, opts ScanOptions) Iterator {
+	if opts.Parallelism <= 1 {
+		return t.scan(ctx)
+	}
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = 1
+	}
+	return &parallelTableIt{
+		ctx:   ctx,
+		table: t,
+		opts:  opts,
+	}
+}
+
+type rowBatch struct {
+	rows [][]any
+	err  error
+}
+
+// parallelTableIt reads data objects with a pool of goroutines. In ordered
+// mode each file has its own channel which are drained in order of files,
+// otherwise all files share a single channel.
+type parallelTableIt struct {
+	ctx   context.Context
+	table *table
+	opts  ScanOptions
+
+	done    chan struct{}
+	wg      sync.WaitGroup
+	files   []chan rowBatch // ordered mode
+	merged  chan rowBatch   // unordered mode
+	current int
+
+	batch    [][]any
+	batchPos int
+}
+
+func (pt *parallelTableIt) First() ([]any, error) {
+	if err := pt.Close(); err != nil {
+		return nil, err
+	}
+	pt.start()
+	return pt.Next()
+}
+
+func (pt *parallelTableIt) Next() ([]any, error) {
+	// receive could pick closed channel of the file over the done context
+	if err := pt.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if pt.done == nil {
+		pt.start()
+	}
+	for pt.batchPos >= len(pt.batch) {
+		batch, err := pt.nextBatch()
+		if err != nil {
+			return nil, err
+		}
+		pt.batch, pt.batchPos = batch, 0
+	}
+	row := pt.batch[pt.batchPos]
+	pt.batchPos++
+	return row, nil
+}
+
+func (pt *parallelTableIt) nextBatch() ([][]any, error) {
+	if pt.opts.Unordered {
+		return pt.receive(pt.merged)
+	}
+	for pt.current < len(pt.files) {
+		rows, err := pt.receive(pt.files[pt.current])
+		if errors.Is(err, ErrIteratorExhausted) {
+			pt.current++
+			continue
+		}
+		return rows, err
+	}
+	return nil, ErrIteratorExhausted
+}
+
+func (pt *parallelTableIt) receive(ch <-chan rowBatch) ([][]any, error) {
+	select {
+	case b, ok := <-ch:
+		if !ok {
+			return nil, ErrIteratorExhausted
+		}
+		return b.rows, b.err
+	case <-pt.ctx.Done():
+		return nil, pt.ctx.Err()
+	}
+}
+
+func (pt *parallelTableIt) start() {
+	pt.done = make(chan struct{})
+	pt.current = 0
+	pt.batch, pt.batchPos = nil, 0
+
+	files := pt.table.files
+	if pt.opts.Unordered {
+		pt.merged = make(chan rowBatch, pt.opts.Prefetch*pt.opts.Parallelism)
+	} else {
+		pt.files = make([]chan rowBatch, len(files))
+		for i := range pt.files {
+			pt.files[i] = make(chan rowBatch, pt.opts.Prefetch)
+		}
+	}
+
+	sem := make(chan struct{}, pt.opts.Parallelism)
+	done := pt.done
+	pt.wg.Add(1)
+	go func() {
+		defer pt.wg.Done()
+		var workers sync.WaitGroup
+		defer func() {
+			workers.Wait()
+			if pt.opts.Unordered {
+				close(pt.merged)
+			}
+		}()
+		// files are dispatched in order so the file consumed next always
+		// has a worker assigned
+		for i, file := range files {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			case <-pt.ctx.Done():
+				return
+			}
+			out := pt.merged
+			if !pt.opts.Unordered {
+				out = pt.files[i]
+			}
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				defer func() { <-sem }()
+				pt.readFile(file, out, done)
+				if !pt.opts.Unordered {
+					close(out)
+				}
+			}()
+		}
+	}()
+}
+
+// readFile streams rows of the file in batches to out until file is read or
+// the scan is stopped
+func (pt *parallelTableIt) readFile(file string, out chan<- rowBatch, done <-chan struct{}) {
+	send := func(b rowBatch) bool {
+		select {
+		case out <- b:
+			return true
+		case <-done:
+			return false
+		case <-pt.ctx.Done():
+			return false
+		}
+	}
+
+	rd, err := pt.table.openFile(file)
+	if err != nil {
+		send(rowBatch{err: err})
+		return
+	}
+	defer rd.close()
+
+	batch := make([][]any, 0, _scanBatchSize)
+	for {
+		row, err := rd.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			send(rowBatch{err: err})
+			return
+		}
+		batch = append(batch, row)
+		if len(batch) == _scanBatchSize {
+			if !send(rowBatch{rows: batch}) {
+				return
+			}
+			batch = make([][]any, 0, _scanBatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		send(rowBatch{rows: batch})
+	}
+}
+
+// Close stops background readers and releases open files
+func (pt *parallelTableIt) Close() error {
+	if pt.done == nil {
+		return nil
+	}
+	close(pt.done)
+	pt.wg.Wait()
+	pt.done = nil
+	return nil
+}
+
+// All adapts the iterator to range-over-func sequence. The iterator is
+// closed once the sequence ends, either exhausted, failed or stopped early.
+func All(it Iterator) iter.Seq2[[]any, error] {
+	return func(yield func([]any, error) bool) {
+		defer it.Close()
+		for v, err := it.First(); ; v, err = it.Next() {
+			if errors.Is(err, ErrIteratorExhausted) {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareScanTable(t *testing.T, cl DeltaStorage, files, rowsPerFile int) {
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.Create("foo", []string{"file", "row"}))
+	assert.NoError(t, tx.Commit())
+	for f := 0; f < files; f++ {
+		tx := cl.NewTransaction()
+		for r := 0; r < rowsPerFile; r++ {
+			assert.NoError(t, tx.Put("foo", []any{f, r}))
+		}
+		assert.NoError(t, tx.Commit())
+	}
+}
+
+func collectRows(t *testing.T, it Iterator) [][]any {
+	rows := make([][]any, 0)
+	for v, err := it.First(); ; v, err = it.Next() {
+		if errors.Is(err, ErrIteratorExhausted) {
+			return rows
+		}
+		if !assert.NoError(t, err) {
+			return rows
+		}
+		rows = append(rows, v)
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 10, 300)
+
+	tx := cl.NewTransaction()
+	seq, err := tx.Iter("foo")
+	assert.NoError(t, err)
+	expected := collectRows(t, seq)
+	assert.Len(t, expected, 3000)
+
+	for _, opts := range []ScanOptions{
+		{Parallelism: 4, Prefetch: 1},
+		{Parallelism: 3, Prefetch: 2, Unordered: true},
+	} {
+		t.Run(fmt.Sprintf("%+v", opts), func(t *testing.T) {
+			it, err := tx.IterWithOptions("foo", opts)
+			assert.NoError(t, err)
+			rows := collectRows(t, it)
+			if opts.Unordered {
+				assert.ElementsMatch(t, expected, rows)
+			} else {
+				assert.Equal(t, expected, rows)
+			}
+			// restart scan
+			assert.Len(t, collectRows(t, it), len(expected))
+			assert.NoError(t, it.Close())
+		})
+	}
+}
+
+func TestParallelScanStopEarly(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 5, 1000)
+
+	tx := cl.NewTransaction()
+	it, err := tx.IterWithOptions("foo", ScanOptions{Parallelism: 5})
+	assert.NoError(t, err)
+	_, err = it.First()
+	assert.NoError(t, err)
+	assert.NoError(t, it.Close())
+}
+
+func TestRowsSeq(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 3, 10)
+
+	tx := cl.NewTransaction()
+	n := 0
+	for row, err := range tx.Rows(context.Background(), "foo") {
+		assert.NoError(t, err)
+		assert.Len(t, row, 2)
+		n++
+	}
+	assert.Equal(t, 30, n)
+
+	// stop early
+	n = 0
+	for _, err := range tx.Rows(context.Background(), "foo") {
+		assert.NoError(t, err)
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	assert.Equal(t, 5, n)
+
+	for _, err := range tx.Rows(context.Background(), "bar") {
+		assert.Error(t, err)
+	}
+}
+
+func TestIterContextCancel(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 3, 10)
+
+	tx := cl.NewTransaction()
+	for _, opts := range []ScanOptions{DefaultScanOptions(), {Parallelism: 2}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		it, err := tx.IterContext(ctx, "foo", opts)
+		assert.NoError(t, err)
+		_, err = it.First()
+		assert.NoError(t, err)
+		cancel()
+		for err == nil {
+			_, err = it.Next()
+		}
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, it.Close())
+	}
+}
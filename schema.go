@@ -0,0 +1,278 @@
+package deltalake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+type ColumnType int
+
+const (
+	AnyType ColumnType = iota // values are stored as they are, without validation
+	BoolType
+	Int64Type
+	DoubleType
+	StringType
+	BytesType
+	TimestampType
+	DecimalType
+	ListType
+	StructType
+)
+
+func (ct ColumnType) String() string {
+	switch ct {
+	case AnyType:
+		return "any"
+	case BoolType:
+		return "bool"
+	case Int64Type:
+		return "int64"
+	case DoubleType:
+		return "double"
+	case StringType:
+		return "string"
+	case BytesType:
+		return "bytes"
+	case TimestampType:
+		return "timestamp"
+	case DecimalType:
+		return "decimal"
+	case ListType:
+		return "list"
+	case StructType:
+		return "struct"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(ct))
+	}
+}
+
+// Decimal is an arbitrary precision number kept in its textual form
+type Decimal string
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+type Schema []Column
+
+func untypedSchema(columns []string) Schema {
+	s := make(Schema, len(columns))
+	for i, c := range columns {
+		s[i] = Column{Name: c, Type: AnyType}
+	}
+	return s
+}
+
+func (s Schema) names() []string {
+	res := make([]string, len(s))
+	for i, c := range s {
+		res[i] = c.Name
+	}
+	return res
+}
+
+func (s Schema) types() []ColumnType {
+	res := make([]ColumnType, len(s))
+	for i, c := range s {
+		res[i] = c.Type
+	}
+	return res
+}
+
+func (s Schema) typed() bool {
+	for _, c := range s {
+		if c.Type != AnyType {
+			return true
+		}
+	}
+	return false
+}
+
+// coerce validates the row against the schema converting values into Go types
+// of the columns. It is used both for rows being written and rows decoded from
+// data objects, where json loses types (bytes and timestamps become strings).
+func (s Schema) coerce(row []any) ([]any, error) {
+	if len(s) == 0 {
+		return row, nil
+	}
+	if len(row) != len(s) {
+		return nil, fmt.Errorf("%w: expected %d values, got %d", ErrSchemaMismatch, len(s), len(row))
+	}
+	if !s.typed() {
+		return row, nil
+	}
+	res := make([]any, len(row))
+	for i, v := range row {
+		cv, err := coerceValue(s[i].Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: column %s: %v", ErrSchemaMismatch, s[i].Name, err)
+		}
+		res[i] = cv
+	}
+	return res, nil
+}
+
+// decode converts row decoded from json, where numbers are kept as
+// json.Number, into Go types of the columns
+func (s Schema) decode(row []any) ([]any, error) {
+	res := make([]any, len(row))
+	for i, v := range row {
+		t := AnyType
+		if i < len(s) {
+			t = s[i].Type
+		}
+		res[i] = decodeNumbers(t, v)
+	}
+	return s.coerce(res)
+}
+
+// decodeNumbers converts json numbers of the value, integers and decimals are
+// kept exactly, numbers of untyped columns and nested values become float64
+func decodeNumbers(t ColumnType, v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		switch t {
+		case Int64Type:
+			if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+				return n
+			}
+		case DecimalType:
+			return Decimal(v)
+		}
+		// out of range numbers are infinite
+		f, _ := v.Float64()
+		return f
+	case []any:
+		res := make([]any, len(v))
+		for i, e := range v {
+			res[i] = decodeNumbers(AnyType, e)
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, e := range v {
+			res[k] = decodeNumbers(AnyType, e)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+func coerceValue(t ColumnType, v any) (any, error) {
+	if v == nil || t == AnyType {
+		return v, nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("cannot use %T as %s", v, t)
+	}
+	switch t {
+	case BoolType:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case Int64Type:
+		switch n := v.(type) {
+		case int:
+			return int64(n), nil
+		case int8:
+			return int64(n), nil
+		case int16:
+			return int64(n), nil
+		case int32:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case uint8:
+			return int64(n), nil
+		case uint16:
+			return int64(n), nil
+		case uint32:
+			return int64(n), nil
+		case float64:
+			if n != math.Trunc(n) {
+				return nil, fmt.Errorf("value %v is not an integer", n)
+			}
+			// conversion of out of range floats is undefined
+			if n < math.MinInt64 || n >= math.MaxInt64 {
+				return nil, fmt.Errorf("value %v is out of int64 range", n)
+			}
+			return int64(n), nil
+		}
+	case DoubleType:
+		switch n := v.(type) {
+		case float32:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+	case StringType:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+	case BytesType:
+		switch b := v.(type) {
+		case []byte:
+			return b, nil
+		case string:
+			return base64.StdEncoding.DecodeString(b)
+		}
+	case TimestampType:
+		switch ts := v.(type) {
+		case time.Time:
+			return ts, nil
+		case string:
+			return time.Parse(time.RFC3339Nano, ts)
+		}
+	case DecimalType:
+		var raw string
+		switch d := v.(type) {
+		case Decimal:
+			raw = string(d)
+		case string:
+			raw = d
+		default:
+			return nil, mismatch()
+		}
+		if _, ok := new(big.Rat).SetString(raw); !ok {
+			return nil, fmt.Errorf("invalid decimal %q", raw)
+		}
+		return Decimal(raw), nil
+	case ListType:
+		if l, ok := v.([]any); ok {
+			return l, nil
+		}
+	case StructType:
+		if m, ok := v.(map[string]any); ok {
+			return m, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown column type %s", t)
+	}
+	return nil, mismatch()
+}
+
+// typedRowReader converts rows decoded from json back to the column types
+type typedRowReader struct {
+	rowReader
+	schema Schema
+}
+
+func (tr *typedRowReader) next() ([]any, error) {
+	row, err := tr.rowReader.next()
+	if err != nil {
+		return nil, err
+	}
+	return tr.schema.decode(row)
+}
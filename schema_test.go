@@ -0,0 +1,95 @@
+package deltalake
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedTableRoundTrip(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	schema := Schema{
+		{Name: "b", Type: BoolType},
+		{Name: "i", Type: Int64Type},
+		{Name: "d", Type: DoubleType},
+		{Name: "s", Type: StringType},
+		{Name: "raw", Type: BytesType},
+		{Name: "ts", Type: TimestampType},
+		{Name: "dec", Type: DecimalType},
+		{Name: "l", Type: ListType},
+		{Name: "st", Type: StructType},
+		{Name: "a", Type: AnyType},
+	}
+	ts := time.Date(2024, 10, 1, 12, 30, 0, 123, time.UTC)
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.CreateWithSchema("foo", schema))
+	assert.NoError(t, tx.Put("foo", []any{true, 42, 1, "x", []byte{1, 2}, ts, Decimal("1.10"), []any{"a"}, map[string]any{"k": "v"}, 7}))
+	assert.NoError(t, tx.Put("foo", []any{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}))
+	assert.NoError(t, tx.Commit())
+
+	txRead := cl.NewTransaction()
+	got, err := txRead.Schema("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, schema, got)
+
+	rows := make([][]any, 0)
+	for row, err := range txRead.Rows(context.Background(), "foo") {
+		assert.NoError(t, err)
+		rows = append(rows, row)
+	}
+	assert.Equal(t, [][]any{
+		{true, int64(42), float64(1), "x", []byte{1, 2}, ts, Decimal("1.10"), []any{"a"}, map[string]any{"k": "v"}, float64(7)},
+		{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}, rows)
+}
+
+func TestPutSchemaMismatch(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "i", Type: Int64Type}, {Name: "dec", Type: DecimalType}}))
+	assert.Error(t, tx.Put("foo", []any{1}))
+	assert.Error(t, tx.Put("foo", []any{"1", Decimal("1")}))
+	assert.Error(t, tx.Put("foo", []any{1.5, Decimal("1")}))
+	assert.Error(t, tx.Put("foo", []any{1, Decimal("abc")}))
+	assert.NoError(t, tx.Put("foo", []any{1, "2.5"}))
+}
+
+func TestInt64Precision(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "i", Type: Int64Type}, {Name: "l", Type: ListType}}))
+	require.NoError(t, tx.Put("foo", []any{int64(1<<53 + 1), []any{1}}))
+	require.NoError(t, tx.Put("foo", []any{int64(math.MinInt64), nil}))
+	// float64 out of the int64 range can't be converted
+	assert.Error(t, tx.Put("foo", []any{1e19, nil}))
+	assert.Error(t, tx.Put("foo", []any{float64(math.MaxInt64), nil}))
+	require.NoError(t, tx.Commit())
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	assert.Equal(t, [][]any{{int64(1<<53 + 1), []any{float64(1)}}, {int64(math.MinInt64), nil}},
+		collectRows(t, mustIter(t, tx, "foo")))
+	// stats keep the bounds exactly
+	foo := tx.tables["foo"]
+	stats := foo.stats[foo.files[len(foo.files)-1]]
+	require.Contains(t, stats.Columns, "i")
+	assert.False(t, stats.mayMatch(foo.schema, statsPredicate{column: "i", op: "=", value: int64(1<<53 + 2)}))
+	assert.True(t, stats.mayMatch(foo.schema, statsPredicate{column: "i", op: "=", value: int64(1<<53 + 1)}))
+	_, rows := queryRows(t, tx, "SELECT i FROM foo WHERE i = 9007199254740993")
+	assert.Equal(t, [][]any{{int64(1<<53 + 1)}}, rows)
+	_, rows = queryRows(t, tx, "SELECT i FROM foo WHERE i = 9007199254740992")
+	assert.Empty(t, rows)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/extensions"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/deltalake"
+)
+
+// Conversion of rows to Arrow record batches and back used by the Flight
+// service. Columns are typed by the table schema: decimals are sent as text,
+// list and struct columns as canonical arrow.json extension since types of
+// their elements are not known, any columns as dense union of value types.
+
+// _flightBatchRows is the number of rows sent in a single record batch
+const _flightBatchRows = 4096
+
+var errArrowUnsupported = errors.New("unsupported arrow data")
+
+// type codes of the children of _anyType
+const (
+	_anyNull arrow.UnionTypeCode = iota
+	_anyBool
+	_anyInt64
+	_anyDouble
+	_anyString
+	_anyBytes
+	_anyTimestamp
+	_anyDecimal
+	_anyJSON
+)
+
+var (
+	_timestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	_jsonType      = mustJSONType()
+	// _anyType keeps values of any columns with their type, nulls are
+	// values of the null child
+	_anyType = arrow.DenseUnionOf([]arrow.Field{
+		{Name: "null", Type: arrow.Null, Nullable: true},
+		{Name: "bool", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "int64", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "double", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "string", Type: arrow.BinaryTypes.String},
+		{Name: "bytes", Type: arrow.BinaryTypes.Binary},
+		{Name: "timestamp", Type: _timestampType},
+		{Name: "decimal", Type: arrow.BinaryTypes.String},
+		{Name: "json", Type: _jsonType},
+	}, []arrow.UnionTypeCode{
+		_anyNull, _anyBool, _anyInt64, _anyDouble, _anyString, _anyBytes, _anyTimestamp, _anyDecimal, _anyJSON,
+	})
+)
+
+func mustJSONType() *extensions.JSONType {
+	typ, err := extensions.NewJSONType(arrow.BinaryTypes.String)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+func arrowType(ct deltalake.ColumnType) arrow.DataType {
+	switch ct {
+	case deltalake.BoolType:
+		return arrow.FixedWidthTypes.Boolean
+	case deltalake.Int64Type:
+		return arrow.PrimitiveTypes.Int64
+	case deltalake.DoubleType:
+		return arrow.PrimitiveTypes.Float64
+	case deltalake.StringType, deltalake.DecimalType:
+		return arrow.BinaryTypes.String
+	case deltalake.BytesType:
+		return arrow.BinaryTypes.Binary
+	case deltalake.TimestampType:
+		return _timestampType
+	case deltalake.ListType, deltalake.StructType:
+		return _jsonType
+	default:
+		return _anyType
+	}
+}
+
+// arrowSchema maps table columns to nullable arrow fields
+func arrowSchema(schema deltalake.Schema) *arrow.Schema {
+	fields := make([]arrow.Field, len(schema))
+	for i, c := range schema {
+		fields[i] = arrow.Field{Name: c.Name, Type: arrowType(c.Type), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// fromArrowSchema maps arrow fields to table columns, types without a
+// matching column type become any columns
+func fromArrowSchema(schema *arrow.Schema) deltalake.Schema {
+	res := make(deltalake.Schema, schema.NumFields())
+	for i, f := range schema.Fields() {
+		c := deltalake.Column{Name: f.Name}
+		switch f.Type.(type) {
+		case *arrow.BooleanType:
+			c.Type = deltalake.BoolType
+		case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type,
+			*arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type:
+			c.Type = deltalake.Int64Type
+		case *arrow.Float32Type, *arrow.Float64Type:
+			c.Type = deltalake.DoubleType
+		case *arrow.StringType, *arrow.LargeStringType:
+			c.Type = deltalake.StringType
+		case *arrow.BinaryType, *arrow.LargeBinaryType:
+			c.Type = deltalake.BytesType
+		case *arrow.TimestampType, *arrow.Date32Type, *arrow.Date64Type:
+			c.Type = deltalake.TimestampType
+		case *arrow.Decimal128Type:
+			c.Type = deltalake.DecimalType
+		case *arrow.ListType, *arrow.LargeListType:
+			c.Type = deltalake.ListType
+		case *arrow.StructType:
+			c.Type = deltalake.StructType
+		}
+		res[i] = c
+	}
+	return res
+}
+
+// recordBatcher collects rows into record batches of _flightBatchRows rows,
+// send takes ownership of the record
+type recordBatcher struct {
+	b    *array.RecordBuilder
+	rows int
+	send func(rec arrow.Record) error
+}
+
+func newRecordBatcher(schema *arrow.Schema, send func(rec arrow.Record) error) *recordBatcher {
+	return &recordBatcher{b: array.NewRecordBuilder(memory.DefaultAllocator, schema), send: send}
+}
+
+func (rb *recordBatcher) add(row []any) error {
+	for i, f := range rb.b.Fields() {
+		var v any
+		if i < len(row) {
+			v = row[i]
+		}
+		if err := appendArrowValue(f, v); err != nil {
+			return fmt.Errorf("column %s: %w", rb.b.Schema().Field(i).Name, err)
+		}
+	}
+	rb.rows++
+	if rb.rows == _flightBatchRows {
+		return rb.flush()
+	}
+	return nil
+}
+
+func (rb *recordBatcher) flush() error {
+	if rb.rows == 0 {
+		return nil
+	}
+	rb.rows = 0
+	return rb.send(rb.b.NewRecord())
+}
+
+func (rb *recordBatcher) release() {
+	rb.b.Release()
+}
+
+func appendArrowValue(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("%w: cannot encode %T as arrow %s", errArrowUnsupported, v, b.Type())
+	}
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		x, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		b.Append(x)
+	case *array.Int64Builder:
+		switch x := v.(type) {
+		case int64:
+			b.Append(x)
+		case int:
+			b.Append(int64(x))
+		default:
+			return mismatch()
+		}
+	case *array.Float64Builder:
+		x, ok := v.(float64)
+		if !ok {
+			return mismatch()
+		}
+		b.Append(x)
+	case *array.StringBuilder:
+		switch x := v.(type) {
+		case string:
+			b.Append(x)
+		case deltalake.Decimal:
+			b.Append(string(x))
+		default:
+			return mismatch()
+		}
+	case *array.BinaryBuilder:
+		x, ok := v.([]byte)
+		if !ok {
+			return mismatch()
+		}
+		b.Append(x)
+	case *array.TimestampBuilder:
+		x, ok := v.(time.Time)
+		if !ok {
+			return mismatch()
+		}
+		b.Append(arrow.Timestamp(x.UnixMicro()))
+	case *array.ExtensionBuilder:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.StorageBuilder().(*array.StringBuilder).Append(string(raw))
+	case *array.DenseUnionBuilder:
+		code := anyTypeCode(v)
+		b.Append(code)
+		return appendArrowValue(b.Child(int(code)), v)
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// anyTypeCode returns child of _anyType keeping the value
+func anyTypeCode(v any) arrow.UnionTypeCode {
+	switch v.(type) {
+	case bool:
+		return _anyBool
+	case int64, int:
+		return _anyInt64
+	case float64:
+		return _anyDouble
+	case string:
+		return _anyString
+	case []byte:
+		return _anyBytes
+	case time.Time:
+		return _anyTimestamp
+	case deltalake.Decimal:
+		return _anyDecimal
+	default:
+		return _anyJSON
+	}
+}
+
+// recordRows returns rows of the record batch
+func recordRows(rec arrow.Record) ([][]any, error) {
+	rows := make([][]any, rec.NumRows())
+	for i := range rows {
+		rows[i] = make([]any, rec.NumCols())
+	}
+	for col, arr := range rec.Columns() {
+		for i := range rows {
+			v, err := arrowValue(arr, i)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", rec.ColumnName(col), err)
+			}
+			rows[i][col] = v
+		}
+	}
+	return rows, nil
+}
+
+// arrowValue returns i-th value of the array converted to the type used by
+// rows, integers are widened to int64
+func arrowValue(arr arrow.Array, i int) (any, error) {
+	switch a := arr.(type) {
+	case *array.DenseUnion:
+		child := a.ChildID(i)
+		v, err := arrowValue(a.Field(child), int(a.ValueOffset(i)))
+		return unionValue(a.UnionType(), child, v), err
+	case *array.SparseUnion:
+		child := a.ChildID(i)
+		v, err := arrowValue(a.Field(child), i)
+		return unionValue(a.UnionType(), child, v), err
+	}
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	switch a := arr.(type) {
+	case *array.Null:
+		return nil, nil
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.Int8:
+		return int64(a.Value(i)), nil
+	case *array.Int16:
+		return int64(a.Value(i)), nil
+	case *array.Int32:
+		return int64(a.Value(i)), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Uint8:
+		return int64(a.Value(i)), nil
+	case *array.Uint16:
+		return int64(a.Value(i)), nil
+	case *array.Uint32:
+		return int64(a.Value(i)), nil
+	case *array.Uint64:
+		if a.Value(i) > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: value %d overflows int64", errArrowUnsupported, a.Value(i))
+		}
+		return int64(a.Value(i)), nil
+	case *array.Float32:
+		return float64(a.Value(i)), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	case *array.String:
+		return a.Value(i), nil
+	case *array.LargeString:
+		return a.Value(i), nil
+	case *array.Binary:
+		return append([]byte(nil), a.Value(i)...), nil
+	case *array.LargeBinary:
+		return append([]byte(nil), a.Value(i)...), nil
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return a.Value(i).ToTime(unit).UTC(), nil
+	case *array.Date32:
+		return a.Value(i).ToTime().UTC(), nil
+	case *array.Date64:
+		return a.Value(i).ToTime().UTC(), nil
+	case *array.Decimal128:
+		scale := a.DataType().(*arrow.Decimal128Type).Scale
+		return deltalake.Decimal(a.Value(i).ToString(scale)), nil
+	case *extensions.JSONArray:
+		var v any
+		if err := json.Unmarshal(a.ValueJSON(i), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case *array.List:
+		start, end := a.ValueOffsets(i)
+		return listValues(a.ListValues(), start, end)
+	case *array.LargeList:
+		start, end := a.ValueOffsets(i)
+		return listValues(a.ListValues(), start, end)
+	case *array.Struct:
+		st := a.DataType().(*arrow.StructType)
+		m := make(map[string]any, a.NumField())
+		for f := 0; f < a.NumField(); f++ {
+			v, err := arrowValue(a.Field(f), i)
+			if err != nil {
+				return nil, err
+			}
+			m[st.Field(f).Name] = v
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%w: type %s", errArrowUnsupported, arr.DataType())
+	}
+}
+
+func listValues(values arrow.Array, start, end int64) ([]any, error) {
+	res := make([]any, 0, end-start)
+	for j := start; j < end; j++ {
+		v, err := arrowValue(values, int(j))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// unionValue restores decimals of any columns sent as text
+func unionValue(typ arrow.UnionType, child int, v any) any {
+	if s, ok := v.(string); ok && typ.Fields()[child].Name == "decimal" {
+		return deltalake.Decimal(s)
+	}
+	return v
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deltalake"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var errUnauthenticated = status.Error(codes.Unauthenticated, "missing or invalid credentials")
+
+// Authenticator returns the principal making the request
+type Authenticator interface {
+	Authenticate(ctx context.Context) (string, error)
+}
+
+// tokenAuthenticator accepts static bearer tokens passed in the
+// authorization metadata
+type tokenAuthenticator struct {
+	tokens map[string]string // token -> principal
+}
+
+func newTokenAuthenticator(tokens map[string]string) *tokenAuthenticator {
+	return &tokenAuthenticator{tokens: tokens}
+}
+
+func (ta *tokenAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", errUnauthenticated
+	}
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if !ok {
+			continue
+		}
+		for known, principal := range ta.tokens {
+			if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+				return principal, nil
+			}
+		}
+	}
+	return "", errUnauthenticated
+}
+
+// mtlsAuthenticator uses common name of the verified client certificate
+type mtlsAuthenticator struct{}
+
+func (mtlsAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errUnauthenticated
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", errUnauthenticated
+	}
+	cn := info.State.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return "", errUnauthenticated
+	}
+	return cn, nil
+}
+
+// chainAuthenticator returns the first principal found by any authenticator
+type chainAuthenticator []Authenticator
+
+func (ca chainAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	for _, a := range ca {
+		if principal, err := a.Authenticate(ctx); err == nil {
+			return principal, nil
+		}
+	}
+	return "", errUnauthenticated
+}
+
+type principalKey struct{}
+
+func principalFromContext(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(principalKey{}).(string)
+	return p, ok
+}
+
+func authUnaryInterceptor(auth Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		principal, err := auth.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, principalKey{}, principal), req)
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
+
+func authStreamInterceptor(auth Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		principal, err := auth.Authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ss.Context(), principalKey{}, principal),
+		})
+	}
+}
+
+type permission int
+
+const (
+	permRead permission = iota + 1
+	permWrite
+	permAdmin
+)
+
+func parsePermission(s string) (permission, error) {
+	switch strings.ToLower(s) {
+	case "read":
+		return permRead, nil
+	case "write":
+		return permWrite, nil
+	case "admin":
+		return permAdmin, nil
+	default:
+		return 0, fmt.Errorf("unknown permission %q", s)
+	}
+}
+
+func (p permission) String() string {
+	switch p {
+	case permRead:
+		return "read"
+	case permWrite:
+		return "write"
+	case permAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// grant gives principal permission on a resource. Resource is either a
+// table name, a namespace "ns.*" matching tables "ns.<name>" or "*" matching
+// every table. Higher permission implies the lower ones.
+type grant struct {
+	principal  string
+	resource   string
+	permission permission
+}
+
+func (g grant) matches(table string) bool {
+	if g.resource == "*" || g.resource == table {
+		return true
+	}
+	ns, ok := strings.CutSuffix(g.resource, "*")
+	return ok && strings.HasSuffix(ns, ".") && strings.HasPrefix(table, ns)
+}
+
+const (
+	_aclTable          = "_acl"
+	_defaultACLRefresh = 5 * time.Second
+)
+
+var aclSchema = deltalake.Schema{
+	{Name: "principal", Type: deltalake.StringType},
+	{Name: "resource", Type: deltalake.StringType},
+	{Name: "permission", Type: deltalake.StringType},
+}
+
+// aclStore keeps grants stored in the _acl table of the lake, grants are
+// reloaded periodically. Admins configured statically have admin on all
+// tables and are used to bootstrap the ACLs.
+type aclStore struct {
+	delta   deltalake.DeltaStorage
+	admins  map[string]bool
+	refresh time.Duration
+
+	mu       sync.Mutex
+	grants   []grant
+	loadedAt time.Time
+}
+
+func newACLStore(d deltalake.DeltaStorage, admins []string, refresh time.Duration) *aclStore {
+	if refresh <= 0 {
+		refresh = _defaultACLRefresh
+	}
+	as := &aclStore{
+		delta:   d,
+		admins:  make(map[string]bool),
+		refresh: refresh,
+	}
+	for _, a := range admins {
+		as.admins[a] = true
+	}
+	return as
+}
+
+// ensureTable creates the _acl table if it does not exist yet
+func (as *aclStore) ensureTable() error {
+	tx := as.delta.NewTransaction()
+	if _, err := tx.Schema(_aclTable); err == nil {
+		return tx.Rollback()
+	}
+	if err := tx.CreateWithSchema(_aclTable, aclSchema); err != nil {
+		tx.Rollback()
+		return err
+	}
+	err := tx.Commit()
+	if err != nil {
+		tx.Rollback()
+	}
+	if errors.Is(err, deltalake.ErrConflict) {
+		// created by another server, or other commit happened meanwhile
+		return as.ensureTable()
+	}
+	return err
+}
+
+func (as *aclStore) load(ctx context.Context) ([]grant, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.grants != nil && time.Since(as.loadedAt) < as.refresh {
+		return as.grants, nil
+	}
+
+	tx := as.delta.NewTransaction()
+	defer tx.Rollback()
+	grants := make([]grant, 0)
+	for row, err := range tx.Rows(ctx, _aclTable) {
+		if errors.Is(err, deltalake.ErrTableNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		principal, _ := row[0].(string)
+		resource, _ := row[1].(string)
+		rawPerm, _ := row[2].(string)
+		perm, err := parsePermission(rawPerm)
+		if err != nil {
+			slog.Error("invalid acl entry", slog.Any("entry", row), slog.Any("error", err))
+			continue
+		}
+		grants = append(grants, grant{principal: principal, resource: resource, permission: perm})
+	}
+	as.grants, as.loadedAt = grants, time.Now()
+	return grants, nil
+}
+
+func (as *aclStore) invalidate() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.grants = nil
+}
+
+func (as *aclStore) check(ctx context.Context, principal, table string, perm permission) error {
+	if as.admins[principal] {
+		return nil
+	}
+	grants, err := as.load(ctx)
+	if err != nil {
+		return err
+	}
+	for _, g := range grants {
+		if g.principal == principal && g.permission >= perm && g.matches(table) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "%s permission on table %s denied", perm, table)
+}
+
+// authorize checks if the principal of the request has permission on the
+// table, all requests are allowed when authentication is disabled. Modifying
+// the ACLs requires admin permission.
+func (s *Server) authorize(ctx context.Context, table string, perm permission) error {
+	if s.acl == nil {
+		return nil
+	}
+	if table == _aclTable && perm == permWrite {
+		perm = permAdmin
+	}
+	principal, ok := principalFromContext(ctx)
+	if !ok {
+		return errUnauthenticated
+	}
+	return s.acl.check(ctx, principal, table, perm)
+}
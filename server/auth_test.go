@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	protos2 "github.com/deltalake/protos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withAuth(t *testing.T, tokens map[string]string, admins ...string) func(s *Server) {
+	return func(s *Server) {
+		s.auth = newTokenAuthenticator(tokens)
+		s.acl = newACLStore(s.delta, admins, 0)
+		require.NoError(t, s.acl.ensureTable())
+	}
+}
+
+func asPrincipal(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGrantMatches(t *testing.T) {
+	for _, tc := range []struct {
+		resource string
+		table    string
+		match    bool
+	}{
+		{"*", "foo", true},
+		{"foo", "foo", true},
+		{"foo", "foobar", false},
+		{"sales.*", "sales.orders", true},
+		{"sales.*", "salesorders", false},
+		{"sales*", "salesorders", false},
+	} {
+		assert.Equal(t, tc.match, grant{resource: tc.resource}.matches(tc.table), tc)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	c := newTestServer(t, withAuth(t, map[string]string{
+		"admin-token":  "admin",
+		"reader-token": "reader",
+		"writer-token": "writer",
+	}, "admin"))
+	admin, reader, writer := asPrincipal("admin-token"), asPrincipal("reader-token"), asPrincipal("writer-token")
+
+	_, err := c.reader.DescribeTable(context.Background(), &protos2.DescribeTableRequest{Table: "sales.orders"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = c.reader.DescribeTable(asPrincipal("unknown"), &protos2.DescribeTableRequest{Table: "sales.orders"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = c.writer.Create(writer, &protos2.CreateRequest{Table: "sales.orders", Columns: []string{"id"}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.writer.Create(admin, &protos2.CreateRequest{Table: "sales.orders", Columns: []string{"id"}})
+	require.NoError(t, err)
+
+	for _, g := range [][]any{
+		{"reader", "sales.*", "read"},
+		{"writer", "sales.orders", "write"},
+	} {
+		row, err := toProtoRow(g)
+		require.NoError(t, err)
+		// only admins can modify acls
+		_, err = c.writer.Set(writer, &protos2.SetRequest{Table: _aclTable, Row: row})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = c.writer.Set(admin, &protos2.SetRequest{Table: _aclTable, Row: row})
+		require.NoError(t, err)
+	}
+
+	row, err := toProtoRow([]any{"1"})
+	require.NoError(t, err)
+	_, err = c.writer.Set(reader, &protos2.SetRequest{Table: "sales.orders", Row: row})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.writer.Set(writer, &protos2.SetRequest{Table: "sales.orders", Row: row})
+	require.NoError(t, err)
+	_, err = c.reader.DescribeTable(reader, &protos2.DescribeTableRequest{Table: "sales.orders"})
+	assert.NoError(t, err)
+	_, err = c.reader.DescribeTable(writer, &protos2.DescribeTableRequest{Table: "other"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// transactions can be used only by their owner
+	tx, err := c.writer.NewTransaction(writer, &protos2.Empty{})
+	require.NoError(t, err)
+	_, err = c.writer.Set(writer, &protos2.SetRequest{TxId: &tx.TxId, Table: "sales.orders", Row: row})
+	require.NoError(t, err)
+	_, err = c.writer.Commit(reader, tx)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = c.writer.Commit(writer, tx)
+	require.NoError(t, err)
+
+	// commits are attributed to the principal
+	history, err := c.reader.History(reader, &protos2.HistoryRequest{Table: "sales.orders"})
+	require.NoError(t, err)
+	require.Len(t, history.Commits, 3)
+	for i, expected := range []string{"writer", "writer", "admin"} {
+		assert.Equal(t, expected, history.Commits[i].ClientId)
+	}
+	assert.Equal(t, "CREATE TABLE", history.Commits[2].Operation)
+	assert.Equal(t, int64(1), history.Commits[0].Metrics["numOutputRows"])
+	_, err = c.reader.History(writer, &protos2.HistoryRequest{Table: "other"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
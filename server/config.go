@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deltalake"
+)
+
+const _envPrefix = "DELTALAKE_"
+
+// duration is time.Duration read from strings like "30s" in config files
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type StorageConfig struct {
+	Type string `json:"type"` // only "local" is supported
+	Dir  string `json:"dir"`
+	// CacheBytes enables read-through cache of files, 0 disables it
+	CacheBytes int `json:"cacheBytes"`
+}
+
+type DeltaConfig struct {
+	// MaxMemoryBufferSz limits rows of a data object, 0 is unlimited
+	MaxMemoryBufferSz   int   `json:"maxMemoryBufferSz"`
+	TargetFileSizeBytes int64 `json:"targetFileSizeBytes"`
+	RowCacheSize        int   `json:"rowCacheSize"`
+	// MemoryBudget limits bytes buffered by all transactions, 0 is unlimited
+	MemoryBudget int64 `json:"memoryBudget"`
+	// MemoryWaitTimeout limits how long a put waits for the memory budget
+	MemoryWaitTimeout duration `json:"memoryWaitTimeout"`
+	// FlushWorkers writing data objects in the background, 0 flushes in Put
+	FlushWorkers int `json:"flushWorkers"`
+	// AutoCompactMinFiles is the number of small data objects of tables with
+	// auto optimization which triggers their compaction
+	AutoCompactMinFiles int `json:"autoCompactMinFiles"`
+}
+
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ClientCAFile enables mTLS, clients have to present certificate signed
+	// by one of the CAs
+	ClientCAFile string `json:"clientCAFile"`
+}
+
+type ShutdownConfig struct {
+	// Timeout is the time given to in-flight requests, afterwards the server
+	// is stopped forcefully
+	Timeout duration `json:"timeout"`
+}
+
+// AuthConfig enables authentication when tokens are given or mTLS is used.
+// Permissions of principals are kept in the _acl table of the lake.
+type AuthConfig struct {
+	Tokens map[string]string `json:"tokens"` // bearer token -> principal
+	// TokensFile is a json file with the tokens
+	TokensFile string `json:"tokensFile"`
+	// MTLS authenticates clients by common name of their certificate
+	MTLS bool `json:"mtls"`
+	// Admins have admin permission on every table, used to bootstrap ACLs
+	Admins     []string `json:"admins"`
+	ACLRefresh duration `json:"aclRefresh"`
+}
+
+type Config struct {
+	Listen string `json:"listen"`
+	// HTTPListen is address of the HTTP/JSON gateway, empty disables it
+	HTTPListen string `json:"httpListen"`
+	// PGListen is address of the PostgreSQL wire protocol front-end, empty
+	// disables it
+	PGListen  string         `json:"pgListen"`
+	Storage   StorageConfig  `json:"storage"`
+	Delta     DeltaConfig    `json:"delta"`
+	TxTimeout duration       `json:"txTimeout"`
+	TLS       TLSConfig      `json:"tls"`
+	Auth      AuthConfig     `json:"auth"`
+	Shutdown  ShutdownConfig `json:"shutdown"`
+}
+
+func defaultConfig() Config {
+	opts := deltalake.DefaultOpts()
+	return Config{
+		Listen: ":9000",
+		Storage: StorageConfig{
+			Type: "local",
+		},
+		Delta: DeltaConfig{
+			MaxMemoryBufferSz:   opts.MaxMemoryBufferSz,
+			TargetFileSizeBytes: opts.TargetFileSizeBytes,
+			RowCacheSize:        opts.RowCacheSize,
+			MemoryBudget:        opts.MemoryBudget,
+			MemoryWaitTimeout:   duration(opts.MemoryWaitTimeout),
+			FlushWorkers:        opts.FlushWorkers,
+			AutoCompactMinFiles: opts.AutoCompactMinFiles,
+		},
+		TxTimeout: duration(_defaultTxTimeout),
+		Auth: AuthConfig{
+			ACLRefresh: duration(_defaultACLRefresh),
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: duration(30 * time.Second),
+		},
+	}
+}
+
+// loadConfig builds configuration from defaults, optional json config file,
+// DELTALAKE_* environment variables and flags, later sources take precedence
+func loadConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to json config file")
+	fs.String("listen", cfg.Listen, "address the server listens on")
+	fs.String("httpListen", "", "address of the HTTP/JSON gateway, disabled when empty")
+	fs.String("pgListen", "", "address of the PostgreSQL wire protocol front-end, disabled when empty")
+	fs.String("storage", cfg.Storage.Type, "storage type: local")
+	fs.String("storageDst", "", "where storage should be kept")
+	fs.Int("storageCache", 0, "size in bytes of the storage read cache")
+	fs.Int("maxMemoryBufferSz", cfg.Delta.MaxMemoryBufferSz, "rows of a data object, 0 is unlimited")
+	fs.Int64("targetFileSizeBytes", cfg.Delta.TargetFileSizeBytes, "size of data objects written by puts and optimize")
+	fs.Int("rowCacheSize", cfg.Delta.RowCacheSize, "number of decoded rows cached")
+	fs.Int64("memoryBudget", cfg.Delta.MemoryBudget, "bytes of rows buffered by all transactions, 0 is unlimited")
+	fs.Duration("memoryWaitTimeout", time.Duration(cfg.Delta.MemoryWaitTimeout), "time a put waits for the memory budget, 0 waits until the request is canceled")
+	fs.Int("flushWorkers", cfg.Delta.FlushWorkers, "data objects written in the background, 0 writes them in put")
+	fs.Int("autoCompactMinFiles", cfg.Delta.AutoCompactMinFiles, "small data objects of auto optimized table which trigger its compaction")
+	fs.Duration("txTimeout", time.Duration(cfg.TxTimeout), "idle time after which open transaction is rolled back")
+	fs.String("tlsCert", "", "server certificate file")
+	fs.String("tlsKey", "", "server key file")
+	fs.String("tlsClientCA", "", "CA file used to verify client certificates (mTLS)")
+	fs.String("authTokensFile", "", "json file mapping bearer tokens to principals")
+	fs.Bool("mtlsAuth", false, "authenticate clients by common name of their certificate")
+	fs.String("admins", "", "comma separated principals with admin permission on every table")
+	fs.Duration("shutdownTimeout", time.Duration(cfg.Shutdown.Timeout), "time given to in-flight requests on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configFile != "" {
+		raw, err := os.ReadFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("invalid config file %s: %w", *configFile, err)
+		}
+	}
+
+	// environment variables use the flag names, e.g. DELTALAKE_STORAGEDST
+	set := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := os.LookupEnv(_envPrefix + strings.ToUpper(f.Name)); ok {
+			set[f.Name] = v
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	for name, v := range set {
+		if err := cfg.set(name, v); err != nil {
+			return cfg, fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *Config) set(name, v string) error {
+	var err error
+	atoi := func(dst *int) {
+		*dst, err = strconv.Atoi(v)
+	}
+	dur := func(dst *duration) {
+		var d time.Duration
+		d, err = time.ParseDuration(v)
+		*dst = duration(d)
+	}
+	switch name {
+	case "config":
+	case "listen":
+		c.Listen = v
+	case "httpListen":
+		c.HTTPListen = v
+	case "pgListen":
+		c.PGListen = v
+	case "storage":
+		c.Storage.Type = v
+	case "storageDst":
+		c.Storage.Dir = v
+	case "storageCache":
+		atoi(&c.Storage.CacheBytes)
+	case "maxMemoryBufferSz":
+		atoi(&c.Delta.MaxMemoryBufferSz)
+	case "targetFileSizeBytes":
+		c.Delta.TargetFileSizeBytes, err = strconv.ParseInt(v, 10, 64)
+	case "rowCacheSize":
+		atoi(&c.Delta.RowCacheSize)
+	case "memoryBudget":
+		c.Delta.MemoryBudget, err = strconv.ParseInt(v, 10, 64)
+	case "memoryWaitTimeout":
+		dur(&c.Delta.MemoryWaitTimeout)
+	case "flushWorkers":
+		atoi(&c.Delta.FlushWorkers)
+	case "autoCompactMinFiles":
+		atoi(&c.Delta.AutoCompactMinFiles)
+	case "txTimeout":
+		dur(&c.TxTimeout)
+	case "tlsCert":
+		c.TLS.CertFile = v
+	case "tlsKey":
+		c.TLS.KeyFile = v
+	case "tlsClientCA":
+		c.TLS.ClientCAFile = v
+	case "authTokensFile":
+		c.Auth.TokensFile = v
+	case "mtlsAuth":
+		c.Auth.MTLS, err = strconv.ParseBool(v)
+	case "admins":
+		c.Auth.Admins = strings.Split(v, ",")
+	case "shutdownTimeout":
+		dur(&c.Shutdown.Timeout)
+	default:
+		return errors.New("unknown option")
+	}
+	return err
+}
+
+func (c *Config) validate() error {
+	// "0" is kept for compatibility with the former numeric storage flag
+	if c.Storage.Type != "local" && c.Storage.Type != "0" {
+		return fmt.Errorf("invalid storage type %q", c.Storage.Type)
+	}
+	if c.Storage.Dir == "" {
+		return errors.New("no storage destination provided")
+	}
+	if c.Delta.MaxMemoryBufferSz < 0 {
+		return errors.New("maxMemoryBufferSz can't be negative")
+	}
+	if c.Delta.TargetFileSizeBytes <= 0 {
+		return errors.New("targetFileSizeBytes has to be positive")
+	}
+	if c.Delta.MemoryBudget < 0 {
+		return errors.New("memoryBudget can't be negative")
+	}
+	if c.Delta.MemoryWaitTimeout < 0 {
+		return errors.New("memoryWaitTimeout can't be negative")
+	}
+	if c.Delta.FlushWorkers < 0 {
+		return errors.New("flushWorkers can't be negative")
+	}
+	if c.Delta.AutoCompactMinFiles < 0 {
+		return errors.New("autoCompactMinFiles can't be negative")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("both tls certificate and key have to be provided")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return errors.New("mTLS requires server certificate")
+	}
+	if c.Auth.MTLS && c.TLS.ClientCAFile == "" {
+		return errors.New("mTLS authentication requires client CA")
+	}
+	return nil
+}
+
+func (c *Config) objectStorage() deltalake.ObjectStorage {
+	store := deltalake.NewFileStorage(c.Storage.Dir)
+	if c.Storage.CacheBytes > 0 {
+		return deltalake.NewCachedStorage(store, c.Storage.CacheBytes)
+	}
+	return store
+}
+
+func (c *Config) deltaOpts() *deltalake.Opts {
+	opts := deltalake.DefaultOpts()
+	opts.MaxMemoryBufferSz = c.Delta.MaxMemoryBufferSz
+	opts.TargetFileSizeBytes = c.Delta.TargetFileSizeBytes
+	opts.RowCacheSize = c.Delta.RowCacheSize
+	opts.MemoryBudget = c.Delta.MemoryBudget
+	opts.MemoryWaitTimeout = time.Duration(c.Delta.MemoryWaitTimeout)
+	opts.FlushWorkers = c.Delta.FlushWorkers
+	opts.AutoCompactMinFiles = c.Delta.AutoCompactMinFiles
+	return opts
+}
+
+// tlsConfig returns nil when TLS is not configured, the same configuration is
+// used by the grpc server and the HTTP gateway
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.TLS.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.TLS.ClientCAFile != "" {
+		raw, err := os.ReadFile(c.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, errors.New("no certificates found in client CA file")
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// authenticator returns nil when authentication is disabled
+func (c *Config) authenticator() (Authenticator, error) {
+	tokens := make(map[string]string)
+	for t, p := range c.Auth.Tokens {
+		tokens[t] = p
+	}
+	if c.Auth.TokensFile != "" {
+		raw, err := os.ReadFile(c.Auth.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &tokens); err != nil {
+			return nil, fmt.Errorf("invalid tokens file %s: %w", c.Auth.TokensFile, err)
+		}
+	}
+
+	chain := make(chainAuthenticator, 0)
+	if len(tokens) > 0 {
+		chain = append(chain, newTokenAuthenticator(tokens))
+	}
+	if c.Auth.MTLS {
+		chain = append(chain, mtlsAuthenticator{})
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
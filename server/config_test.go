@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"listen": ":9100",
+		"storage": {"dir": "/from/file", "cacheBytes": 1024},
+		"txTimeout": "1m",
+		"shutdown": {"timeout": "5s"}
+	}`), 0644))
+	t.Setenv("DELTALAKE_STORAGEDST", "/from/env")
+	t.Setenv("DELTALAKE_LISTEN", ":9200")
+
+	cfg, err := loadConfig([]string{"-config", file, "-listen", ":9300", "-rowCacheSize", "10"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9300", cfg.Listen)
+	assert.Equal(t, "/from/env", cfg.Storage.Dir)
+	assert.Equal(t, 1024, cfg.Storage.CacheBytes)
+	assert.Equal(t, 10, cfg.Delta.RowCacheSize)
+	assert.Equal(t, time.Minute, time.Duration(cfg.TxTimeout))
+	assert.Equal(t, 5*time.Second, time.Duration(cfg.Shutdown.Timeout))
+	assert.Equal(t, defaultConfig().Delta.MaxMemoryBufferSz, cfg.Delta.MaxMemoryBufferSz)
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-storageDst", "x", "-storage", "s3"},
+		{"-storageDst", "x", "-tlsCert", "cert.pem"},
+		{"-storageDst", "x", "-tlsClientCA", "ca.pem"},
+		{"-storageDst", "x", "-maxMemoryBufferSz", "-1"},
+		{"-storageDst", "x", "-targetFileSizeBytes", "0"},
+		{"-storageDst", "x", "-flushWorkers", "-1"},
+	} {
+		_, err := loadConfig(args)
+		assert.Error(t, err, args)
+	}
+	_, err := loadConfig([]string{"-storageDst", "x", "-storage", "0"})
+	assert.NoError(t, err)
+}
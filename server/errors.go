@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/deltalake"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const _errorDomain = "deltalake"
+
+// toStatus maps errors returned by deltalake to grpc status with ErrorInfo
+// details carrying table and version the error refers to
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code, reason := codes.Internal, "INTERNAL"
+	switch {
+	case errors.Is(err, deltalake.ErrTableNotFound):
+		code, reason = codes.NotFound, "TABLE_NOT_FOUND"
+	case errors.Is(err, deltalake.ErrTableExists):
+		code, reason = codes.AlreadyExists, "TABLE_EXISTS"
+	case errors.Is(err, deltalake.ErrSchemaMismatch):
+		code, reason = codes.InvalidArgument, "SCHEMA_MISMATCH"
+	case errors.Is(err, deltalake.ErrInvalidQuery):
+		code, reason = codes.InvalidArgument, "INVALID_QUERY"
+	case errors.Is(err, deltalake.ErrConflict):
+		code, reason = codes.Aborted, "CONFLICT"
+	case errors.Is(err, deltalake.ErrTransactionClosed):
+		code, reason = codes.FailedPrecondition, "TRANSACTION_CLOSED"
+	case errors.Is(err, deltalake.ErrMemoryBudgetExceeded):
+		code, reason = codes.ResourceExhausted, "MEMORY_BUDGET_EXCEEDED"
+	case errors.Is(err, context.Canceled):
+		code, reason = codes.Canceled, "CANCELED"
+	case errors.Is(err, context.DeadlineExceeded):
+		code, reason = codes.DeadlineExceeded, "DEADLINE_EXCEEDED"
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   _errorDomain,
+		Metadata: make(map[string]string),
+	}
+	var tableErr *deltalake.TableError
+	if errors.As(err, &tableErr) {
+		info.Metadata["table"] = tableErr.Table
+	}
+	var conflictErr *deltalake.ConflictError
+	if errors.As(err, &conflictErr) {
+		info.Metadata["version"] = strconv.FormatInt(conflictErr.Version, 10)
+	}
+
+	st, detailsErr := status.New(code, err.Error()).WithDetails(info)
+	if detailsErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
+
+func errorUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatus(err)
+}
+
+func errorStreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toStatus(handler(srv, ss))
+}
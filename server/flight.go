@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"go.uber.org/multierr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// flightServer exposes tables through Arrow Flight and Flight SQL. Plain
+// Flight addresses tables by path descriptors with the table name or by
+// command descriptors holding json encoded flightCommand, commands are also
+// used as tickets. DoGet streams table scan as record batches, DoPut inserts
+// received batches in a single transaction. Other descriptors and tickets
+// are Flight SQL commands served by flightSQLServer.
+type flightServer struct {
+	flight.FlightServer
+
+	s *Server
+}
+
+func newFlightServer(s *Server) *flightServer {
+	return &flightServer{FlightServer: flightsql.NewFlightServer(newFlightSQLServer(s)), s: s}
+}
+
+type flightCommand struct {
+	Table string `json:"table"`
+	TxId  *int64 `json:"txId,omitempty"`
+}
+
+// isFlightCommand tells json commands apart from Flight SQL commands, which
+// are protobuf messages and never valid json
+func isFlightCommand(raw []byte) bool {
+	return json.Valid(raw)
+}
+
+func isFlightTable(d *flight.FlightDescriptor) bool {
+	return d.GetType() == flight.DescriptorPATH || d.GetType() == flight.DescriptorCMD && isFlightCommand(d.GetCmd())
+}
+
+func parseFlightCommand(raw []byte) (flightCommand, error) {
+	var cmd flightCommand
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return cmd, status.Errorf(codes.InvalidArgument, "invalid flight command: %v", err)
+	}
+	if cmd.Table == "" {
+		return cmd, status.Error(codes.InvalidArgument, "flight command without table")
+	}
+	return cmd, nil
+}
+
+func parseFlightDescriptor(d *flight.FlightDescriptor) (flightCommand, error) {
+	if d.GetType() == flight.DescriptorPATH {
+		if len(d.Path) != 1 {
+			return flightCommand{}, status.Error(codes.InvalidArgument, "flight path has to be a single table name")
+		}
+		return flightCommand{Table: d.Path[0]}, nil
+	}
+	return parseFlightCommand(d.GetCmd())
+}
+
+func (fs *flightServer) schema(ctx context.Context, cmd flightCommand) (*arrow.Schema, error) {
+	ts, err := fs.s.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: cmd.Table, TxId: cmd.TxId})
+	if err != nil {
+		return nil, err
+	}
+	schema, err := fromProtoSchema(ts.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return arrowSchema(schema), nil
+}
+
+func (fs *flightServer) GetSchema(ctx context.Context, in *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	if !isFlightTable(in) {
+		return fs.FlightServer.GetSchema(ctx, in)
+	}
+	cmd, err := parseFlightDescriptor(in)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := fs.schema(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(schema, memory.DefaultAllocator)}, nil
+}
+
+func (fs *flightServer) GetFlightInfo(ctx context.Context, in *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	if !isFlightTable(in) {
+		return fs.FlightServer.GetFlightInfo(ctx, in)
+	}
+	cmd, err := parseFlightDescriptor(in)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := fs.schema(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return flightInfo(schema, in, ticket), nil
+}
+
+func flightInfo(schema *arrow.Schema, desc *flight.FlightDescriptor, ticket []byte) *flight.FlightInfo {
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(schema, memory.DefaultAllocator),
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: ticket}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}
+}
+
+func (fs *flightServer) DoGet(in *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	if !isFlightCommand(in.Ticket) {
+		return fs.FlightServer.DoGet(in, stream)
+	}
+	ctx := stream.Context()
+	cmd, err := parseFlightCommand(in.Ticket)
+	if err != nil {
+		return err
+	}
+	schema, err := fs.schema(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(schema))
+	batches := newRecordBatcher(schema, func(rec arrow.Record) error {
+		defer rec.Release()
+		return w.Write(rec)
+	})
+	defer batches.release()
+	err = fs.s.scan(ctx, &protos2.GetRequest{Table: cmd.Table, TxId: cmd.TxId}, batches.add)
+	if err == nil {
+		err = batches.flush()
+	}
+	return multierr.Append(err, w.Close())
+}
+
+// putStream returns the first message again after it was inspected
+type putStream struct {
+	flight.FlightService_DoPutServer
+
+	first *flight.FlightData
+}
+
+func (ps *putStream) Recv() (*flight.FlightData, error) {
+	if first := ps.first; first != nil {
+		ps.first = nil
+		return first, nil
+	}
+	return ps.FlightService_DoPutServer.Recv()
+}
+
+// DoPut expects schema in the first message together with the descriptor,
+// the summary of the insert is returned as json app metadata
+func (fs *flightServer) DoPut(stream flight.FlightService_DoPutServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	replay := &putStream{FlightService_DoPutServer: stream, first: first}
+	if !isFlightTable(first.FlightDescriptor) {
+		return fs.FlightServer.DoPut(replay)
+	}
+	ctx := stream.Context()
+	cmd, err := parseFlightDescriptor(first.FlightDescriptor)
+	if err != nil {
+		return err
+	}
+	ts, err := fs.s.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: cmd.Table, TxId: cmd.TxId})
+	if err != nil {
+		return err
+	}
+	rdr, err := flight.NewRecordReader(replay)
+	if err != nil {
+		return arrowError(err)
+	}
+	defer rdr.Release()
+
+	schema, err := fromProtoSchema(ts.Columns)
+	if err != nil {
+		return err
+	}
+	summary, err := fs.s.insert(ctx, cmd.TxId, nil, recordSource(cmd.Table, schema, rdr))
+	if err != nil {
+		return err
+	}
+	meta, err := protojson.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&flight.PutResult{AppMetadata: meta})
+}
+
+// recordSource returns rows of the record batches read by rdr one by one,
+// fields are matched to the table columns by name and columns missing in the
+// batches are null
+func recordSource(table string, columns deltalake.Schema, rdr array.RecordReader) func() (string, []any, error) {
+	var (
+		pending [][]any
+		index   []int
+	)
+	return func() (string, []any, error) {
+		for len(pending) == 0 {
+			if !rdr.Next() {
+				if err := rdr.Err(); err != nil {
+					return "", nil, arrowError(err)
+				}
+				return "", nil, io.EOF
+			}
+			if index == nil {
+				var err error
+				if index, err = columnIndex(table, columns, rdr.Schema()); err != nil {
+					return "", nil, err
+				}
+			}
+			rows, err := recordRows(rdr.Record())
+			if err != nil {
+				return "", nil, arrowError(err)
+			}
+			pending = rows
+		}
+		row := make([]any, len(columns))
+		for i, v := range pending[0] {
+			row[index[i]] = v
+		}
+		pending = pending[1:]
+		return table, row, nil
+	}
+}
+
+// columnIndex returns positions of the fields of the batches in the table
+func columnIndex(table string, columns deltalake.Schema, schema *arrow.Schema) ([]int, error) {
+	index := make([]int, schema.NumFields())
+	for i, f := range schema.Fields() {
+		index[i] = slices.IndexFunc(columns, func(c deltalake.Column) bool { return c.Name == f.Name })
+		if index[i] < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "table %s has no column %s", table, f.Name)
+		}
+	}
+	return index, nil
+}
+
+// arrowError reports data the client sent as invalid argument, errors of the
+// stream keep their status
+func arrowError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// flightSQLServer serves Flight SQL: queries run by Transaction.Query,
+// listing of tables, bulk ingestion and transactions. Transaction ids are ids
+// of server transactions in decimal.
+type flightSQLServer struct {
+	flightsql.BaseServer
+
+	s *Server
+}
+
+func newFlightSQLServer(s *Server) *flightSQLServer {
+	fs := &flightSQLServer{s: s}
+	for id, v := range map[flightsql.SqlInfo]any{
+		flightsql.SqlInfoFlightSqlServerName:        "deltalake",
+		flightsql.SqlInfoFlightSqlServerReadOnly:    false,
+		flightsql.SqlInfoFlightSqlServerSql:         true,
+		flightsql.SqlInfoFlightSqlServerTransaction: int32(flightsql.SqlTransactionTransaction),
+	} {
+		if err := fs.RegisterSqlInfo(id, v); err != nil {
+			panic(err)
+		}
+	}
+	return fs
+}
+
+// sqlStatement is the handle of statement tickets
+type sqlStatement struct {
+	Query string `json:"query"`
+	TxId  *int64 `json:"txId,omitempty"`
+}
+
+func parseTxId(raw []byte) (*int64, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction id %q", raw)
+	}
+	return &id, nil
+}
+
+// query plans the statement after checking read permission on its tables,
+// the returned handle has to be rolled back once the query is closed
+func (fs *flightSQLServer) query(ctx context.Context, stmt sqlStatement) (*txHandle, deltalake.QueryIterator, error) {
+	tables, err := deltalake.QueryTables(stmt.Query)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, table := range tables {
+		if err := fs.s.authorize(ctx, table, permRead); err != nil {
+			return nil, nil, err
+		}
+	}
+	h, err := fs.s.openTx(ctx, stmt.TxId)
+	if err != nil {
+		return nil, nil, err
+	}
+	it, err := h.tx.QueryContext(ctx, stmt.Query)
+	if err != nil {
+		h.rollback()
+		return nil, nil, err
+	}
+	return h, it, nil
+}
+
+func (fs *flightSQLServer) statementSchema(ctx context.Context, cmd flightsql.StatementQuery) (sqlStatement, *arrow.Schema, error) {
+	stmt := sqlStatement{Query: cmd.GetQuery()}
+	var err error
+	if stmt.TxId, err = parseTxId(cmd.GetTransactionId()); err != nil {
+		return stmt, nil, err
+	}
+	h, it, err := fs.query(ctx, stmt)
+	if err != nil {
+		return stmt, nil, err
+	}
+	defer h.rollback()
+	defer it.Close()
+	return stmt, arrowSchema(it.Schema()), nil
+}
+
+func (fs *flightSQLServer) GetFlightInfoStatement(ctx context.Context, cmd flightsql.StatementQuery, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	stmt, schema, err := fs.statementSchema(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := flightsql.CreateStatementQueryTicket(handle)
+	if err != nil {
+		return nil, err
+	}
+	return flightInfo(schema, desc, ticket), nil
+}
+
+func (fs *flightSQLServer) GetSchemaStatement(ctx context.Context, cmd flightsql.StatementQuery, _ *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	_, schema, err := fs.statementSchema(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(schema, memory.DefaultAllocator)}, nil
+}
+
+func (fs *flightSQLServer) DoGetStatement(ctx context.Context, ticket flightsql.StatementQueryTicket) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	var stmt sqlStatement
+	if err := json.Unmarshal(ticket.GetStatementHandle(), &stmt); err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid statement handle: %v", err)
+	}
+	h, it, err := fs.query(ctx, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	schema := arrowSchema(it.Schema())
+	chunks := make(chan flight.StreamChunk)
+	// chunks are not read anymore once sending of the stream fails, the
+	// stream context is done then
+	send := func(chunk flight.StreamChunk) error {
+		select {
+		case chunks <- chunk:
+			return nil
+		case <-ctx.Done():
+			if chunk.Data != nil {
+				chunk.Data.Release()
+			}
+			return ctx.Err()
+		}
+	}
+	go func() {
+		defer close(chunks)
+		defer h.rollback()
+		batches := newRecordBatcher(schema, func(rec arrow.Record) error {
+			return send(flight.StreamChunk{Data: rec})
+		})
+		defer batches.release()
+		err := func() error {
+			for row, err := range deltalake.All(it) {
+				if err == nil {
+					err = batches.add(row)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return batches.flush()
+		}()
+		if err != nil {
+			send(flight.StreamChunk{Err: err})
+		}
+	}()
+	return schema, chunks, nil
+}
+
+func (fs *flightSQLServer) GetFlightInfoTables(_ context.Context, cmd flightsql.GetTables, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+	return flightInfo(schema, desc, desc.Cmd), nil
+}
+
+// DoGetTables lists tables the principal can read, tables are in the default
+// catalog and schema and all of them are of type TABLE
+func (fs *flightSQLServer) DoGetTables(ctx context.Context, cmd flightsql.GetTables) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+	h, err := fs.s.openTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer h.rollback()
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	matches := func(pattern *string, name string) bool {
+		return pattern == nil || likePattern(*pattern).MatchString(name)
+	}
+	types := cmd.GetTableTypes()
+	if cmd.GetCatalog() != nil && *cmd.GetCatalog() != "" || !matches(cmd.GetDBSchemaFilterPattern(), "") ||
+		len(types) > 0 && !slices.Contains(types, "TABLE") {
+		return schema, emptyChunks(), nil
+	}
+	for _, table := range h.tx.Tables() {
+		if !matches(cmd.GetTableNameFilterPattern(), table) {
+			continue
+		}
+		err := fs.s.authorize(ctx, table, permRead)
+		if status.Code(err) == codes.PermissionDenied {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		b.Field(0).AppendNull()
+		b.Field(1).AppendNull()
+		b.Field(2).(*array.StringBuilder).Append(table)
+		b.Field(3).(*array.StringBuilder).Append("TABLE")
+		if cmd.GetIncludeSchema() {
+			ts, err := h.tx.Schema(table)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.Field(4).(*array.BinaryBuilder).Append(flight.SerializeSchema(arrowSchema(ts), memory.DefaultAllocator))
+		}
+	}
+	chunks := make(chan flight.StreamChunk, 1)
+	chunks <- flight.StreamChunk{Data: b.NewRecord()}
+	close(chunks)
+	return schema, chunks, nil
+}
+
+func emptyChunks() <-chan flight.StreamChunk {
+	chunks := make(chan flight.StreamChunk)
+	close(chunks)
+	return chunks
+}
+
+// likePattern compiles SQL LIKE pattern of Flight SQL filters
+func likePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+func (fs *flightSQLServer) GetFlightInfoTableTypes(_ context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return flightInfo(schema_ref.TableTypes, desc, desc.Cmd), nil
+}
+
+func (fs *flightSQLServer) DoGetTableTypes(context.Context) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema_ref.TableTypes)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).Append("TABLE")
+	chunks := make(chan flight.StreamChunk, 1)
+	chunks <- flight.StreamChunk{Data: b.NewRecord()}
+	close(chunks)
+	return schema_ref.TableTypes, chunks, nil
+}
+
+// DoPutCommandStatementIngest inserts the batches into the table in a single
+// transaction. Missing table is created from the schema of the batches when
+// the options ask for it, existing tables can only be appended to.
+func (fs *flightSQLServer) DoPutCommandStatementIngest(ctx context.Context, cmd flightsql.StatementIngest, rdr flight.MessageReader) (int64, error) {
+	table := cmd.GetTable()
+	txId, err := parseTxId(cmd.GetTransactionId())
+	if err != nil {
+		return 0, err
+	}
+	schema := rdr.Schema()
+	if schema == nil {
+		return 0, arrowError(rdr.Err())
+	}
+	opts := cmd.GetTableDefinitionOptions()
+	ts, err := fs.s.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: table, TxId: txId})
+	var columns deltalake.Schema
+	switch {
+	case err != nil && !errors.Is(err, deltalake.ErrTableNotFound):
+		return 0, err
+	case err == nil && opts.GetIfExists() != flightsql.TableDefinitionOptionsTableExistsOptionAppend:
+		return 0, status.Errorf(codes.AlreadyExists, "table %s already exists, only appending to it is supported", table)
+	case err != nil && opts.GetIfNotExist() != flightsql.TableDefinitionOptionsTableNotExistOptionCreate:
+		return 0, err
+	case err != nil:
+		columns = fromArrowSchema(schema)
+		create := &protos2.CreateRequest{Table: table, TxId: txId, Schema: toProtoSchema(table, columns).Columns}
+		if _, err := fs.s.Create(ctx, create); err != nil {
+			return 0, err
+		}
+	default:
+		if columns, err = fromProtoSchema(ts.Columns); err != nil {
+			return 0, err
+		}
+	}
+
+	summary, err := fs.s.insert(ctx, txId, nil, recordSource(table, columns, rdr))
+	if err != nil {
+		return 0, err
+	}
+	return summary.Rows, nil
+}
+
+func (fs *flightSQLServer) BeginTransaction(ctx context.Context, _ flightsql.ActionBeginTransactionRequest) ([]byte, error) {
+	tx, err := fs.s.NewTransaction(ctx, &protos2.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatInt(tx.TxId, 10)), nil
+}
+
+func (fs *flightSQLServer) EndTransaction(ctx context.Context, req flightsql.ActionEndTransactionRequest) error {
+	id, err := parseTxId(req.GetTransactionId())
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		return status.Error(codes.InvalidArgument, "missing transaction id")
+	}
+	tx := &protos2.Transaction{TxId: *id}
+	switch req.GetAction() {
+	case flightsql.EndTransactionCommit:
+		_, err = fs.s.Commit(ctx, tx)
+	case flightsql.EndTransactionRollback:
+		_, err = fs.s.Rollback(ctx, tx)
+	default:
+		err = status.Errorf(codes.InvalidArgument, "unknown end transaction action %s", req.GetAction())
+	}
+	return err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var flightTestSchema = deltalake.Schema{
+	{Name: "id", Type: deltalake.Int64Type},
+	{Name: "name", Type: deltalake.StringType},
+	{Name: "ts", Type: deltalake.TimestampType},
+	{Name: "tags", Type: deltalake.ListType},
+	{Name: "extra", Type: deltalake.AnyType},
+}
+
+// jsonRecord builds record of the schema from json rows the way clients do
+func jsonRecord(t *testing.T, schema *arrow.Schema, rows string) arrow.Record {
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, schema, strings.NewReader(rows))
+	require.NoError(t, err)
+	t.Cleanup(rec.Release)
+	return rec
+}
+
+func flightPut(t *testing.T, c *testClient, desc *flight.FlightDescriptor, recs ...arrow.Record) (*protos2.InsertSummary, error) {
+	stream, err := c.flight.DoPut(context.Background())
+	require.NoError(t, err)
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(recs[0].Schema()))
+	w.SetFlightDescriptor(desc)
+	for _, rec := range recs {
+		require.NoError(t, w.Write(rec))
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, stream.CloseSend())
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	summary := &protos2.InsertSummary{}
+	require.NoError(t, protojson.Unmarshal(res.AppMetadata, summary))
+	return summary, nil
+}
+
+// flightGet returns schema and rows of the stream, stream of Flight SQL
+// query is read with the same reader
+func flightGet(t *testing.T, c *testClient, ticket []byte) (*arrow.Schema, [][]any) {
+	stream, err := c.flight.DoGet(context.Background(), &flight.Ticket{Ticket: ticket})
+	require.NoError(t, err)
+	rdr, err := flight.NewRecordReader(stream)
+	require.NoError(t, err)
+	defer rdr.Release()
+	rows := make([][]any, 0)
+	for rdr.Next() {
+		batch, err := recordRows(rdr.Record())
+		require.NoError(t, err)
+		rows = append(rows, batch...)
+	}
+	require.NoError(t, rdr.Err())
+	return rdr.Schema(), rows
+}
+
+func TestFlight(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	_, err := c.writer.Create(ctx, &protos2.CreateRequest{Table: "foo", Schema: toProtoSchema("foo", flightTestSchema).Columns})
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	rows := make([][]any, 0)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, []any{int64(i), "name", ts, []any{"a", float64(i)}, float64(i)})
+	}
+	rows[5][1], rows[6][3] = nil, nil
+	// any column keeps the type of every value
+	rows[1][4], rows[2][4], rows[3][4], rows[4][4] = "text", true, nil, map[string]any{"k": "v"}
+	rows[7][4], rows[8][4] = int64(1)<<60, deltalake.Decimal("1.50")
+
+	schema := arrowSchema(flightTestSchema)
+	recs := make([]arrow.Record, 0)
+	batches := newRecordBatcher(schema, func(rec arrow.Record) error {
+		recs = append(recs, rec)
+		return nil
+	})
+	defer batches.release()
+	for _, row := range rows {
+		require.NoError(t, batches.add(row))
+	}
+	require.NoError(t, batches.flush())
+	defer recs[0].Release()
+	summary, err := flightPut(t, c, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"foo"}}, recs...)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), summary.Rows)
+	assert.True(t, summary.Committed)
+
+	info, err := c.flight.GetFlightInfo(ctx, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"foo"}})
+	require.NoError(t, err)
+	require.Len(t, info.Endpoint, 1)
+	infoSchema, err := flight.DeserializeSchema(info.Schema, memory.DefaultAllocator)
+	require.NoError(t, err)
+	assert.True(t, schema.Equal(infoSchema))
+	assert.Equal(t, "arrow.json", infoSchema.Field(3).Type.(arrow.ExtensionType).ExtensionName())
+	assert.Equal(t, arrow.DENSE_UNION, infoSchema.Field(4).Type.ID())
+
+	streamSchema, got := flightGet(t, c, info.Endpoint[0].Ticket.Ticket)
+	assert.True(t, schema.Equal(streamSchema))
+	// values of any columns are stored as json
+	rows[7][4], rows[8][4] = float64(int64(1)<<60), "1.50"
+	assert.Equal(t, rows, got)
+
+	// columns of narrower client types are widened
+	narrow := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.LargeString},
+	}, nil)
+	_, err = flightPut(t, c, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"foo"}},
+		jsonRecord(t, narrow, `[{"id": 10, "name": "narrow"}]`))
+	require.NoError(t, err)
+	_, got = flightGet(t, c, []byte(`{"table": "foo"}`))
+	assert.Equal(t, []any{int64(10), "narrow", nil, nil, nil}, got[10])
+}
+
+func TestFlightTransaction(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	_, err := c.writer.Create(ctx, &protos2.CreateRequest{Table: "foo", Schema: toProtoSchema("foo", flightTestSchema).Columns})
+	require.NoError(t, err)
+	tx, err := c.writer.NewTransaction(ctx, &protos2.Empty{})
+	require.NoError(t, err)
+
+	cmd, err := json.Marshal(flightCommand{Table: "foo", TxId: &tx.TxId})
+	require.NoError(t, err)
+	summary, err := flightPut(t, c, &flight.FlightDescriptor{Type: flight.DescriptorCMD, Cmd: cmd},
+		jsonRecord(t, arrowSchema(flightTestSchema), `[{"id": 1, "name": "x"}]`))
+	require.NoError(t, err)
+	assert.False(t, summary.Committed)
+
+	_, rows := flightGet(t, c, []byte(`{"table": "foo"}`))
+	assert.Empty(t, rows)
+	_, err = c.writer.Commit(ctx, tx)
+	require.NoError(t, err)
+	_, rows = flightGet(t, c, []byte(`{"table": "foo"}`))
+	assert.Len(t, rows, 1)
+
+	// values not matching the table schema are rejected
+	mismatched := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.BinaryTypes.String}}, nil)
+	_, err = flightPut(t, c, &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"foo"}},
+		jsonRecord(t, mismatched, `[{"id": "1"}]`))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestFlightSQL(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	ingest := func(table string, opts *flightsql.TableDefinitionOptions, tx flightsql.Transaction, rec arrow.Record) (int64, error) {
+		rdr, err := array.NewRecordReader(rec.Schema(), []arrow.Record{rec})
+		require.NoError(t, err)
+		defer rdr.Release()
+		return c.sql.ExecuteIngest(ctx, rdr, &flightsql.ExecuteIngestOpts{
+			Table:                  table,
+			TableDefinitionOptions: opts,
+			TransactionId:          tx,
+		})
+	}
+	create := &flightsql.TableDefinitionOptions{
+		IfNotExist: flightsql.TableDefinitionOptionsTableNotExistOptionCreate,
+		IfExists:   flightsql.TableDefinitionOptionsTableExistsOptionFail,
+	}
+	appendRows := &flightsql.TableDefinitionOptions{
+		IfNotExist: flightsql.TableDefinitionOptionsTableNotExistOptionFail,
+		IfExists:   flightsql.TableDefinitionOptionsTableExistsOptionAppend,
+	}
+	query := func(tx *flightsql.Txn, q string) (*arrow.Schema, [][]any) {
+		var (
+			info *flight.FlightInfo
+			err  error
+		)
+		if tx != nil {
+			info, err = tx.Execute(ctx, q)
+		} else {
+			info, err = c.sql.Execute(ctx, q)
+		}
+		require.NoError(t, err, q)
+		return flightGet(t, c, info.Endpoint[0].Ticket.Ticket)
+	}
+
+	// table is created from the schema of the ingested batches
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "city", Type: arrow.BinaryTypes.String},
+		{Name: "amount", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	n, err := ingest("orders", create, nil, jsonRecord(t, schema,
+		`[{"id": 1, "city": "oslo", "amount": 1.5}, {"id": 2, "city": "rome", "amount": 2}, {"id": 3, "city": "oslo", "amount": null}]`))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+	_, err = ingest("orders", create, nil, jsonRecord(t, schema, `[{"id": 4, "city": "oslo"}]`))
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = ingest("missing", appendRows, nil, jsonRecord(t, schema, `[{"id": 4, "city": "oslo"}]`))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resultSchema, rows := query(nil, "SELECT city, count(*) AS n, sum(amount) FROM orders GROUP BY city ORDER BY city")
+	assert.Equal(t, []arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int64, arrow.PrimitiveTypes.Float64},
+		[]arrow.DataType{resultSchema.Field(0).Type, resultSchema.Field(1).Type, resultSchema.Field(2).Type})
+	assert.Equal(t, [][]any{{"oslo", int64(2), 1.5}, {"rome", int64(1), float64(2)}}, rows)
+	_, err = c.sql.Execute(ctx, "SELECT nope FROM orders")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// rows ingested in a transaction are visible after commit
+	tx, err := c.sql.BeginTransaction(ctx)
+	require.NoError(t, err)
+	_, err = ingest("orders", appendRows, tx.ID(), jsonRecord(t, schema, `[{"id": 4, "city": "oslo"}]`))
+	require.NoError(t, err)
+	_, rows = query(nil, "SELECT id FROM orders WHERE id = 4")
+	assert.Empty(t, rows)
+	// queries run in the transaction
+	_, rows = query(tx, "SELECT id FROM orders WHERE id = 1")
+	assert.Len(t, rows, 1)
+	require.NoError(t, tx.Commit(ctx))
+	_, rows = query(nil, "SELECT id FROM orders WHERE id = 4")
+	assert.Equal(t, [][]any{{int64(4)}}, rows)
+
+	info, err := c.sql.GetTables(ctx, &flightsql.GetTablesOpts{IncludeSchema: true})
+	require.NoError(t, err)
+	tablesSchema, tables := flightGet(t, c, info.Endpoint[0].Ticket.Ticket)
+	assert.True(t, schema_ref.TablesWithIncludedSchema.Equal(tablesSchema))
+	require.Len(t, tables, 1)
+	assert.Equal(t, []any{nil, nil, "orders", "TABLE"}, tables[0][:4])
+	ordersSchema, err := flight.DeserializeSchema(tables[0][4].([]byte), memory.DefaultAllocator)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "city", "amount"}, []string{ordersSchema.Field(0).Name, ordersSchema.Field(1).Name, ordersSchema.Field(2).Name})
+	pattern := "ord%"
+	info, err = c.sql.GetTables(ctx, &flightsql.GetTablesOpts{TableNameFilterPattern: &pattern})
+	require.NoError(t, err)
+	_, tables = flightGet(t, c, info.Endpoint[0].Ticket.Ticket)
+	assert.Len(t, tables, 1)
+	pattern = "x%"
+	info, err = c.sql.GetTables(ctx, &flightsql.GetTablesOpts{TableNameFilterPattern: &pattern})
+	require.NoError(t, err)
+	_, tables = flightGet(t, c, info.Endpoint[0].Ticket.Ticket)
+	assert.Empty(t, tables)
+}
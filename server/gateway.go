@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	protos2 "github.com/deltalake/protos"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	_ndjsonContentType = "application/x-ndjson"
+	_maxHTTPRowSize    = 16 << 20
+)
+
+// newHTTPHandler exposes the reader and writer services as HTTP/JSON API.
+// Messages are encoded with protojson, rows are streamed as newline
+// delimited json:
+//
+//	POST /tables                             create table (CreateRequest)
+//	GET  /tables/{table}                     describe table
+//	GET  /tables/{table}/history?limit=      commits of the table, newest first
+//	GET  /tables/{table}/rows?where=&limit=  scan table, rows returned as NDJSON
+//	POST /tables/{table}/rows                insert rows given as NDJSON
+//	POST /transactions                       start transaction
+//	POST /transactions/{id}/commit
+//	POST /transactions/{id}/rollback
+//	POST /transactions/{id}/keepalive
+//
+// Requests on tables accept optional txId query parameter.
+func newHTTPHandler(s *Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tables", s.httpCreate)
+	mux.HandleFunc("GET /tables/{table}", s.httpDescribe)
+	mux.HandleFunc("GET /tables/{table}/history", s.httpHistory)
+	mux.HandleFunc("GET /tables/{table}/rows", s.httpScan)
+	mux.HandleFunc("POST /tables/{table}/rows", s.httpInsert)
+	mux.HandleFunc("POST /transactions", s.httpNewTransaction)
+	mux.HandleFunc("POST /transactions/{id}/commit", s.httpFinishTransaction(s.Commit))
+	mux.HandleFunc("POST /transactions/{id}/rollback", s.httpFinishTransaction(s.Rollback))
+	mux.HandleFunc("POST /transactions/{id}/keepalive", func(w http.ResponseWriter, r *http.Request) {
+		tx, err := pathTransaction(r)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		lease, err := s.KeepAlive(r.Context(), tx)
+		writeHTTPResponse(w, http.StatusOK, lease, err)
+	})
+	if s.auth == nil {
+		return mux
+	}
+	return httpAuthMiddleware(s.auth, mux)
+}
+
+// httpAuthMiddleware authenticates requests with the same authenticator as
+// grpc requests, Authorization header and client certificate are passed the
+// way grpc does
+func httpAuthMiddleware(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs("authorization", r.Header.Get("Authorization")))
+		if r.TLS != nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+		}
+		principal, err := auth.Authenticate(ctx)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+func (s *Server) httpCreate(w http.ResponseWriter, r *http.Request) {
+	in := &protos2.CreateRequest{}
+	if err := readHTTPMessage(r, in); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	resp, err := s.Create(r.Context(), in)
+	writeHTTPResponse(w, http.StatusCreated, resp, err)
+}
+
+func (s *Server) httpDescribe(w http.ResponseWriter, r *http.Request) {
+	txId, err := queryTxId(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	resp, err := s.DescribeTable(r.Context(), &protos2.DescribeTableRequest{Table: r.PathValue("table"), TxId: txId})
+	writeHTTPResponse(w, http.StatusOK, resp, err)
+}
+
+func (s *Server) httpHistory(w http.ResponseWriter, r *http.Request) {
+	in := &protos2.HistoryRequest{Table: r.PathValue("table")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		if in.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			writeHTTPError(w, status.Errorf(codes.InvalidArgument, "invalid limit %q", limit))
+			return
+		}
+	}
+	resp, err := s.History(r.Context(), in)
+	writeHTTPResponse(w, http.StatusOK, resp, err)
+}
+
+func (s *Server) httpScan(w http.ResponseWriter, r *http.Request) {
+	txId, err := queryTxId(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	in := &protos2.GetRequest{Table: r.PathValue("table"), TxId: txId, Where: r.URL.Query().Get("where")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if in.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			writeHTTPError(w, status.Errorf(codes.InvalidArgument, "invalid limit %q", limit))
+			return
+		}
+	}
+
+	// status is sent with the first row, so errors before it are reported
+	// with proper status code
+	started := false
+	bw := bufio.NewWriter(w)
+	err = s.scan(r.Context(), in, func(v []any) error {
+		row, err := toProtoRow(v)
+		if err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", _ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		raw, err := protojson.Marshal(row)
+		if err != nil {
+			return err
+		}
+		bw.Write(raw)
+		return bw.WriteByte('\n')
+	})
+	switch {
+	case err != nil && !started:
+		writeHTTPError(w, err)
+		return
+	case err != nil:
+		// the stream ends with an error object instead of a row
+		raw, _ := json.Marshal(httpErrorBody(err))
+		bw.Write(raw)
+		bw.WriteByte('\n')
+	case !started:
+		w.Header().Set("Content-Type", _ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+	if err := bw.Flush(); err != nil {
+		slog.Debug("error while writing scan response", slog.Any("error", err))
+	}
+}
+
+func (s *Server) httpInsert(w http.ResponseWriter, r *http.Request) {
+	txId, err := queryTxId(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	table := r.PathValue("table")
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), _maxHTTPRowSize)
+	summary, err := s.insert(r.Context(), txId, nil, func() (string, []any, error) {
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			row := &protos2.Row{}
+			if err := protojson.Unmarshal(line, row); err != nil {
+				return "", nil, status.Errorf(codes.InvalidArgument, "invalid row: %v", err)
+			}
+			values, err := fromProtoRow(row)
+			return table, values, err
+		}
+		if err := scanner.Err(); err != nil {
+			return "", nil, status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+		}
+		return "", nil, io.EOF
+	})
+	writeHTTPResponse(w, http.StatusOK, summary, err)
+}
+
+func (s *Server) httpNewTransaction(w http.ResponseWriter, r *http.Request) {
+	tx, err := s.NewTransaction(r.Context(), &protos2.Empty{})
+	writeHTTPResponse(w, http.StatusCreated, tx, err)
+}
+
+func (s *Server) httpFinishTransaction(finish func(context.Context, *protos2.Transaction) (*protos2.Error, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tx, err := pathTransaction(r)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		resp, err := finish(r.Context(), tx)
+		writeHTTPResponse(w, http.StatusOK, resp, err)
+	}
+}
+
+func pathTransaction(r *http.Request) (*protos2.Transaction, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction id %q", r.PathValue("id"))
+	}
+	return &protos2.Transaction{TxId: id}, nil
+}
+
+func queryTxId(r *http.Request) (*int64, error) {
+	raw := r.URL.Query().Get("txId")
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction id %q", raw)
+	}
+	return &id, nil
+}
+
+func readHTTPMessage(r *http.Request, m proto.Message) error {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, _maxHTTPRowSize))
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(raw, m); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeHTTPResponse(w http.ResponseWriter, code int, m proto.Message, err error) {
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	raw, err := protojson.Marshal(m)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(raw)
+}
+
+type httpError struct {
+	Code     string            `json:"code"`
+	Message  string            `json:"message"`
+	Reason   string            `json:"reason,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func httpErrorBody(err error) map[string]httpError {
+	st := status.Convert(toStatus(err))
+	body := httpError{Code: st.Code().String(), Message: st.Message()}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			body.Reason, body.Metadata = info.Reason, info.Metadata
+		}
+	}
+	return map[string]httpError{"error": body}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	raw, _ := json.Marshal(httpErrorBody(err))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(status.Code(toStatus(err))))
+	w.Write(raw)
+}
+
+// httpStatusFromCode follows the mapping used by grpc-gateway
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
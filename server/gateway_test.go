@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	protos2 "github.com/deltalake/protos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func newTestGateway(t *testing.T) *httptest.Server {
+	c := newTestServer(t)
+	srv := httptest.NewServer(newHTTPHandler(c.server))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func httpDo(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(raw)
+}
+
+func httpScan(t *testing.T, srv *httptest.Server, table, where string) [][]any {
+	resp, err := http.Get(srv.URL + "/tables/" + table + "/rows?where=" + url.QueryEscape(where))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, _ndjsonContentType, resp.Header.Get("Content-Type"))
+
+	rows := make([][]any, 0)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		row := &protos2.Row{}
+		require.NoError(t, protojson.Unmarshal(scanner.Bytes(), row))
+		values, err := fromProtoRow(row)
+		require.NoError(t, err)
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+func TestGateway(t *testing.T) {
+	srv := newTestGateway(t)
+
+	code, _ := httpDo(t, http.MethodPost, srv.URL+"/tables",
+		`{"table": "foo", "schema": [{"name": "id", "type": "INT64"}, {"name": "name", "type": "STRING"}]}`)
+	require.Equal(t, http.StatusCreated, code)
+
+	code, body := httpDo(t, http.MethodGet, srv.URL+"/tables/foo", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"STRING"`)
+
+	ndjson := &strings.Builder{}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(ndjson, `{"values": [{"int64Value": "%d"}, {"stringValue": "name%d"}]}`+"\n", i, i)
+	}
+	code, body = httpDo(t, http.MethodPost, srv.URL+"/tables/foo/rows", ndjson.String())
+	require.Equal(t, http.StatusOK, code, body)
+	summary := &protos2.InsertSummary{}
+	require.NoError(t, protojson.Unmarshal([]byte(body), summary))
+	assert.Equal(t, int64(10), summary.Rows)
+	assert.True(t, summary.Committed)
+
+	assert.Len(t, httpScan(t, srv, "foo", ""), 10)
+	assert.Equal(t, [][]any{{int64(3), "name3"}, {int64(4), "name4"}}, httpScan(t, srv, "foo", "id >= 3 AND id < 5"))
+	assert.Equal(t, [][]any{{int64(7), "name7"}}, httpScan(t, srv, "foo", "name = 'name7'"))
+
+	code, body = httpDo(t, http.MethodGet, srv.URL+"/tables/foo/rows?where="+url.QueryEscape("bar = 1"), "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "unknown column bar")
+
+	// rows written in transaction are visible after commit
+	code, body = httpDo(t, http.MethodPost, srv.URL+"/transactions", "")
+	require.Equal(t, http.StatusCreated, code)
+	tx := &protos2.Transaction{}
+	require.NoError(t, protojson.Unmarshal([]byte(body), tx))
+	code, body = httpDo(t, http.MethodPost, fmt.Sprintf("%s/tables/foo/rows?txId=%d", srv.URL, tx.TxId),
+		`{"values": [{"int64Value": "10"}, {"nullValue": null}]}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Len(t, httpScan(t, srv, "foo", ""), 10)
+	code, _ = httpDo(t, http.MethodPost, fmt.Sprintf("%s/transactions/%d/commit", srv.URL, tx.TxId), "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, httpScan(t, srv, "foo", ""), 11)
+
+	code, body = httpDo(t, http.MethodGet, srv.URL+"/tables/foo/history?limit=2", "")
+	require.Equal(t, http.StatusOK, code, body)
+	history := &protos2.HistoryResponse{}
+	require.NoError(t, protojson.Unmarshal([]byte(body), history))
+	require.Len(t, history.Commits, 2)
+	assert.Equal(t, "WRITE", history.Commits[0].Operation)
+	assert.Greater(t, history.Commits[0].Version, history.Commits[1].Version)
+	code, _ = httpDo(t, http.MethodGet, srv.URL+"/tables/bar/history", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestGatewayErrors(t *testing.T) {
+	srv := newTestGateway(t)
+
+	code, body := httpDo(t, http.MethodGet, srv.URL+"/tables/missing/rows", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	var resp map[string]httpError
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	assert.Equal(t, "TABLE_NOT_FOUND", resp["error"].Reason)
+	assert.Equal(t, "missing", resp["error"].Metadata["table"])
+
+	code, _ = httpDo(t, http.MethodPost, srv.URL+"/tables", `{"table": "foo", "columns": ["id"]}`)
+	require.Equal(t, http.StatusCreated, code)
+	code, _ = httpDo(t, http.MethodPost, srv.URL+"/tables", `{"table": "foo", "columns": ["id"]}`)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = httpDo(t, http.MethodPost, srv.URL+"/tables/foo/rows", `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = httpDo(t, http.MethodPost, srv.URL+"/transactions/42/commit", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deltalake"
+)
+
+// type OIDs of the postgres catalog used to describe columns and parameters
+const (
+	_pgBool        uint32 = 16
+	_pgBytea       uint32 = 17
+	_pgInt8        uint32 = 20
+	_pgInt2        uint32 = 21
+	_pgInt4        uint32 = 23
+	_pgText        uint32 = 25
+	_pgJSON        uint32 = 114
+	_pgFloat4      uint32 = 700
+	_pgFloat8      uint32 = 701
+	_pgUnknown     uint32 = 705
+	_pgVarchar     uint32 = 1043
+	_pgTimestamp   uint32 = 1114
+	_pgTimestamptz uint32 = 1184
+	_pgNumeric     uint32 = 1700
+)
+
+const (
+	_pgFormatText   int16 = 0
+	_pgFormatBinary int16 = 1
+)
+
+// _pgEpoch is the origin of binary timestamps
+var _pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pgType returns OID of the column type, untyped columns are sent as text
+func pgType(ct deltalake.ColumnType) uint32 {
+	switch ct {
+	case deltalake.BoolType:
+		return _pgBool
+	case deltalake.Int64Type:
+		return _pgInt8
+	case deltalake.DoubleType:
+		return _pgFloat8
+	case deltalake.BytesType:
+		return _pgBytea
+	case deltalake.TimestampType:
+		return _pgTimestamptz
+	case deltalake.DecimalType:
+		return _pgNumeric
+	case deltalake.ListType, deltalake.StructType:
+		return _pgJSON
+	default:
+		return _pgText
+	}
+}
+
+// pgTypeSize is the typlen of RowDescription, -1 for variable length types
+func pgTypeSize(oid uint32) int16 {
+	switch oid {
+	case _pgBool:
+		return 1
+	case _pgInt8, _pgFloat8, _pgTimestamptz:
+		return 8
+	default:
+		return -1
+	}
+}
+
+// encodePGValue encodes value of a column with the given type OID, nil is
+// returned for null
+func encodePGValue(v any, oid uint32, format int16) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if format == _pgFormatBinary {
+		return encodePGBinary(v, oid)
+	}
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return []byte("Infinity"), nil
+		case math.IsInf(v, -1):
+			return []byte("-Infinity"), nil
+		case math.IsNaN(v):
+			return []byte("NaN"), nil
+		}
+		return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return []byte(`\x` + hex.EncodeToString(v)), nil
+	case time.Time:
+		return []byte(v.UTC().Format("2006-01-02 15:04:05.999999") + "+00"), nil
+	case deltalake.Decimal:
+		return []byte(v), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func encodePGBinary(v any, oid uint32) ([]byte, error) {
+	switch oid {
+	case _pgBool:
+		if b, ok := v.(bool); ok {
+			if b {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+	case _pgInt8:
+		if n, ok := v.(int64); ok {
+			return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+		}
+	case _pgFloat8:
+		if f, ok := v.(float64); ok {
+			return binary.BigEndian.AppendUint64(nil, math.Float64bits(f)), nil
+		}
+	case _pgBytea:
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+	case _pgTimestamptz:
+		if ts, ok := v.(time.Time); ok {
+			return binary.BigEndian.AppendUint64(nil, uint64(ts.Sub(_pgEpoch).Microseconds())), nil
+		}
+	case _pgNumeric:
+		if d, ok := v.(deltalake.Decimal); ok {
+			return encodePGNumeric(string(d))
+		}
+	case _pgText, _pgJSON:
+		// binary representation of text types is the text itself
+		return encodePGValue(v, oid, _pgFormatText)
+	}
+	return nil, fmt.Errorf("cannot encode %T as binary type %d", v, oid)
+}
+
+// encodePGNumeric encodes decimal as base 10000 digits with weight of the
+// first digit and display scale
+func encodePGNumeric(raw string) ([]byte, error) {
+	r, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", raw)
+	}
+	// decimals have finite expansion, scale is the larger of the powers of 2
+	// and 5 in the denominator
+	scale := 0
+	den, rem := new(big.Int).Set(r.Denom()), new(big.Int)
+	for _, factor := range []*big.Int{big.NewInt(2), big.NewInt(5)} {
+		power := 0
+		for den.Cmp(big.NewInt(1)) != 0 {
+			q, _ := new(big.Int).QuoRem(den, factor, rem)
+			if rem.Sign() != 0 {
+				break
+			}
+			den, power = q, power+1
+		}
+		scale = max(scale, power)
+	}
+	if den.Cmp(big.NewInt(1)) != 0 || scale > math.MaxInt16 {
+		return nil, fmt.Errorf("invalid decimal %q", raw)
+	}
+	text := r.FloatString(scale)
+	sign := uint16(0)
+	if neg, ok := strings.CutPrefix(text, "-"); ok {
+		sign, text = 0x4000, neg
+	}
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	intPart = strings.Repeat("0", (4-len(intPart)%4)%4) + intPart
+	fracPart += strings.Repeat("0", (4-len(fracPart)%4)%4)
+
+	digits := make([]int16, 0, (len(intPart)+len(fracPart))/4)
+	for s := intPart + fracPart; len(s) > 0; s = s[4:] {
+		d, _ := strconv.Atoi(s[:4])
+		digits = append(digits, int16(d))
+	}
+	weight := len(intPart)/4 - 1
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		weight = 0
+	}
+
+	buf := make([]byte, 0, 8+2*len(digits))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(digits)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(int16(weight)))
+	buf = binary.BigEndian.AppendUint16(buf, sign)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(scale))
+	for _, d := range digits {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(d))
+	}
+	return buf, nil
+}
+
+// decodePGParam converts parameter of Bind message to a Go value, values are
+// converted to the column types by the query like literals
+func decodePGParam(raw []byte, oid uint32, format int16) (any, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if format == _pgFormatText {
+		text := string(raw)
+		switch oid {
+		case _pgInt2, _pgInt4, _pgInt8:
+			return strconv.ParseInt(text, 10, 64)
+		case _pgFloat4, _pgFloat8:
+			return strconv.ParseFloat(text, 64)
+		case _pgNumeric:
+			if _, ok := new(big.Rat).SetString(text); !ok {
+				return nil, fmt.Errorf("invalid numeric parameter %q", raw)
+			}
+			return deltalake.Decimal(text), nil
+		case _pgBool:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bool parameter %q", raw)
+			}
+			return b, nil
+		case _pgBytea:
+			if h, ok := strings.CutPrefix(text, `\x`); ok {
+				return hex.DecodeString(h)
+			}
+			return raw, nil
+		default:
+			return text, nil
+		}
+	}
+
+	invalid := func() (any, error) {
+		return nil, fmt.Errorf("invalid binary parameter of type %d", oid)
+	}
+	switch oid {
+	case _pgBool:
+		if len(raw) != 1 {
+			return invalid()
+		}
+		return raw[0] != 0, nil
+	case _pgInt2:
+		if len(raw) != 2 {
+			return invalid()
+		}
+		return int64(int16(binary.BigEndian.Uint16(raw))), nil
+	case _pgInt4:
+		if len(raw) != 4 {
+			return invalid()
+		}
+		return int64(int32(binary.BigEndian.Uint32(raw))), nil
+	case _pgInt8:
+		if len(raw) != 8 {
+			return invalid()
+		}
+		return int64(binary.BigEndian.Uint64(raw)), nil
+	case _pgFloat4:
+		if len(raw) != 4 {
+			return invalid()
+		}
+		// shortest text of the float4 avoids noise digits of the conversion
+		f := math.Float32frombits(binary.BigEndian.Uint32(raw))
+		return strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	case _pgFloat8:
+		if len(raw) != 8 {
+			return invalid()
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	case _pgBytea:
+		return raw, nil
+	case _pgTimestamp, _pgTimestamptz:
+		if len(raw) != 8 {
+			return invalid()
+		}
+		return _pgEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(raw))) * time.Microsecond), nil
+	case _pgText, _pgVarchar, _pgUnknown, _pgJSON:
+		return string(raw), nil
+	default:
+		return nil, fmt.Errorf("binary parameters of type %d are not supported", oid)
+	}
+}
@@ -0,0 +1,1049 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	_pgProtocolVersion = 196608 // 3.0
+	_pgSSLRequest      = 80877103
+	_pgGSSENCRequest   = 80877104
+	_pgCancelRequest   = 80877102
+
+	// _maxPGMessageSize limits size of messages sent by clients
+	_maxPGMessageSize = 64 << 20
+	_pgServerVersion  = "14.0"
+)
+
+var errPGServerClosed = errors.New("pgwire: server closed")
+
+// pgError is reported to the client as ErrorResponse with the SQLSTATE code
+type pgError struct {
+	code string
+	msg  string
+}
+
+func (e *pgError) Error() string {
+	return e.msg
+}
+
+func newPGError(code, format string, args ...any) *pgError {
+	return &pgError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// toPGError maps errors to SQLSTATE codes, deltalake errors are mapped through
+// their grpc codes so all front-ends report errors consistently
+func toPGError(err error) *pgError {
+	var pe *pgError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	switch {
+	case errors.Is(err, deltalake.ErrUnsupportedStatement):
+		return &pgError{code: "0A000", msg: err.Error()}
+	case errors.Is(err, deltalake.ErrSyntax):
+		return &pgError{code: "42601", msg: err.Error()}
+	case errors.Is(err, deltalake.ErrUnknownColumn):
+		return &pgError{code: "42703", msg: err.Error()}
+	}
+	st := status.Convert(toStatus(err))
+	code := "XX000"
+	switch st.Code() {
+	case codes.NotFound:
+		code = "42P01"
+	case codes.AlreadyExists:
+		code = "42P07"
+	case codes.InvalidArgument:
+		code = "22000"
+	case codes.PermissionDenied:
+		code = "42501"
+	case codes.Unauthenticated:
+		code = "28P01"
+	case codes.Aborted:
+		code = "40001"
+	case codes.FailedPrecondition:
+		code = "25000"
+	case codes.Canceled:
+		code = "57014"
+	}
+	return &pgError{code: code, msg: st.Message()}
+}
+
+// pgServer speaks the PostgreSQL wire protocol (v3). Queries are limited to
+// the statements of deltalake.ParseStatements, every statement outside of
+// BEGIN/COMMIT block runs in its own transaction.
+type pgServer struct {
+	s      *Server
+	tlsCfg *tls.Config // nil when TLS is disabled
+
+	mu       sync.Mutex
+	lis      net.Listener
+	sessions map[*pgSession]bool // session -> idle
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func newPGServer(s *Server, tlsCfg *tls.Config) *pgServer {
+	return &pgServer{
+		s:        s,
+		tlsCfg:   tlsCfg,
+		sessions: make(map[*pgSession]bool),
+	}
+}
+
+// Serve accepts connections until Shutdown, errPGServerClosed is returned
+// afterwards
+func (ps *pgServer) Serve(lis net.Listener) error {
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return errPGServerClosed
+	}
+	ps.lis = lis
+	ps.mu.Unlock()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			ps.mu.Lock()
+			closed := ps.closed
+			ps.mu.Unlock()
+			if closed {
+				return errPGServerClosed
+			}
+			return err
+		}
+		sess := &pgSession{
+			srv:        ps,
+			s:          ps.s,
+			conn:       conn,
+			statements: make(map[string]*pgStatement),
+			portals:    make(map[string]*pgPortal),
+		}
+		ps.mu.Lock()
+		if ps.closed {
+			ps.mu.Unlock()
+			conn.Close()
+			return errPGServerClosed
+		}
+		ps.sessions[sess] = false
+		ps.wg.Add(1)
+		ps.mu.Unlock()
+
+		go func() {
+			defer ps.wg.Done()
+			sess.serve()
+			ps.mu.Lock()
+			delete(ps.sessions, sess)
+			ps.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and closes sessions once they are
+// idle. Remaining sessions are closed when ctx is done. Transactions left open
+// by the sessions are not rolled back, they are finished by the txManager.
+func (ps *pgServer) Shutdown(ctx context.Context) error {
+	ps.mu.Lock()
+	ps.closed = true
+	if ps.lis != nil {
+		ps.lis.Close()
+	}
+	ps.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ps.mu.Lock()
+		for sess, idle := range ps.sessions {
+			if idle {
+				sess.conn.Close()
+			}
+		}
+		remaining := len(ps.sessions)
+		ps.mu.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			ps.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the listener and all connections immediately
+func (ps *pgServer) Close() {
+	ps.mu.Lock()
+	ps.closed = true
+	if ps.lis != nil {
+		ps.lis.Close()
+	}
+	for sess := range ps.sessions {
+		sess.conn.Close()
+	}
+	ps.mu.Unlock()
+	ps.wg.Wait()
+}
+
+func (ps *pgServer) setIdle(sess *pgSession, idle bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if _, ok := ps.sessions[sess]; ok {
+		ps.sessions[sess] = idle
+	}
+	if idle && ps.closed {
+		sess.conn.Close()
+	}
+}
+
+func (ps *pgServer) isClosed() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.closed
+}
+
+// pgStatement is a statement prepared with Parse message
+type pgStatement struct {
+	stmt       *deltalake.Statement
+	paramTypes []uint32 // declared by the client, 0 when unspecified
+}
+
+// pgPortal is a statement with bound parameters, results of SELECT executed
+// with row limit are kept until the portal is drained
+type pgPortal struct {
+	stmt    *deltalake.Statement
+	args    []any // values of the parameters
+	formats []int16
+
+	started bool
+	rows    [][]any
+	columns deltalake.Schema
+}
+
+type pgSession struct {
+	srv  *pgServer
+	s    *Server
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	ctx  context.Context // carries the authenticated principal
+
+	txId     *int64 // transaction of BEGIN/COMMIT block
+	txFailed bool   // statement of the block failed, only ROLLBACK is accepted
+
+	statements map[string]*pgStatement
+	portals    map[string]*pgPortal
+}
+
+func (sess *pgSession) serve() {
+	defer sess.conn.Close()
+	sess.r = bufio.NewReader(sess.conn)
+	sess.w = bufio.NewWriter(sess.conn)
+	sess.ctx = context.Background()
+
+	ok, err := sess.startup()
+	if err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			log.Printf("pgwire: startup from %s failed: %v", sess.conn.RemoteAddr(), err)
+		}
+		return
+	}
+	if !ok {
+		return
+	}
+	defer sess.abandon()
+
+	// after error in extended query messages are discarded until Sync
+	skipUntilSync := false
+	for {
+		typ, msg, err := sess.readMessage()
+		if err != nil {
+			return
+		}
+		sess.srv.setIdle(sess, false)
+		if skipUntilSync && typ != 'S' && typ != 'X' {
+			continue
+		}
+		switch typ {
+		case 'Q':
+			err = sess.simpleQuery(msg.cstring())
+		case 'P':
+			err = sess.parse(msg)
+		case 'B':
+			err = sess.bind(msg)
+		case 'D':
+			err = sess.describe(msg)
+		case 'E':
+			err = sess.execute(msg)
+		case 'C':
+			err = sess.close(msg)
+		case 'S':
+			skipUntilSync = false
+			err = sess.readyForQuery()
+		case 'H':
+			err = sess.w.Flush()
+		case 'X':
+			return
+		default:
+			err = newPGError("08P01", "unsupported message type %q", typ)
+		}
+		var pe *pgError
+		if errors.As(err, &pe) {
+			skipUntilSync = true
+			err = sess.sendError(pe, false)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// abandon rolls back transaction left open by a client which disconnected,
+// on server shutdown it is left to the txManager
+func (sess *pgSession) abandon() {
+	if sess.txId == nil || sess.srv.isClosed() {
+		return
+	}
+	if _, err := sess.s.Rollback(sess.ctx, &protos2.Transaction{TxId: *sess.txId}); err != nil {
+		log.Printf("pgwire: failed to roll back transaction %d: %v", *sess.txId, err)
+	}
+}
+
+// startup negotiates TLS, authenticates the client and reports session
+// parameters, ok is false when the connection should be closed
+func (sess *pgSession) startup() (ok bool, err error) {
+	for {
+		msg, err := sess.readStartup()
+		if err != nil {
+			return false, err
+		}
+		version := msg.int32()
+		switch version {
+		case _pgSSLRequest:
+			tlsCfg := sess.srv.tlsCfg
+			if tlsCfg == nil || sess.isTLS() {
+				if _, err := sess.conn.Write([]byte{'N'}); err != nil {
+					return false, err
+				}
+				continue
+			}
+			if _, err := sess.conn.Write([]byte{'S'}); err != nil {
+				return false, err
+			}
+			tlsConn := tls.Server(sess.conn, tlsCfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return false, err
+			}
+			sess.conn = tlsConn
+			sess.r.Reset(tlsConn)
+			sess.w.Reset(tlsConn)
+		case _pgGSSENCRequest:
+			if _, err := sess.conn.Write([]byte{'N'}); err != nil {
+				return false, err
+			}
+		case _pgCancelRequest:
+			// queries are not cancellable, the request is ignored
+			return false, nil
+		case _pgProtocolVersion:
+			return sess.authenticate()
+		default:
+			return false, sess.sendError(newPGError("0A000", "unsupported frontend protocol %d.%d", version>>16, version&0xffff), true)
+		}
+	}
+}
+
+func (sess *pgSession) isTLS() bool {
+	_, ok := sess.conn.(*tls.Conn)
+	return ok
+}
+
+// authenticate uses client certificate if the authenticator accepts it,
+// otherwise the password is requested and used as the bearer token
+func (sess *pgSession) authenticate() (bool, error) {
+	if sess.srv.tlsCfg != nil && !sess.isTLS() {
+		return false, sess.sendError(newPGError("28000", "server requires SSL"), true)
+	}
+	if auth := sess.s.auth; auth != nil {
+		ctx := sess.ctx
+		if tlsConn, ok := sess.conn.(*tls.Conn); ok {
+			ctx = peer.NewContext(ctx, &peer.Peer{
+				Addr:     sess.conn.RemoteAddr(),
+				AuthInfo: credentials.TLSInfo{State: tlsConn.ConnectionState()},
+			})
+		}
+		principal, err := auth.Authenticate(ctx)
+		if err != nil {
+			// AuthenticationCleartextPassword
+			sess.send('R', pgBuffer{}.int32(3))
+			if err := sess.w.Flush(); err != nil {
+				return false, err
+			}
+			typ, msg, err := sess.readMessage()
+			if err != nil {
+				return false, err
+			}
+			if typ != 'p' {
+				return false, sess.sendError(newPGError("08P01", "expected password message"), true)
+			}
+			md := metadata.Pairs("authorization", "Bearer "+msg.cstring())
+			if principal, err = auth.Authenticate(metadata.NewIncomingContext(ctx, md)); err != nil {
+				return false, sess.sendError(newPGError("28P01", "password authentication failed"), true)
+			}
+		}
+		sess.ctx = context.WithValue(sess.ctx, principalKey{}, principal)
+	}
+
+	// AuthenticationOk
+	sess.send('R', pgBuffer{}.int32(0))
+	for _, p := range [][2]string{
+		{"server_version", _pgServerVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"TimeZone", "UTC"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		sess.send('S', pgBuffer{}.cstring(p[0]).cstring(p[1]))
+	}
+	// cancel requests are not supported, the key is random
+	var key [8]byte
+	rand.Read(key[:])
+	sess.send('K', key[:])
+	return true, sess.readyForQuery()
+}
+
+// simpleQuery executes statements of the query string, execution stops at the
+// first failed statement
+func (sess *pgSession) simpleQuery(query string) error {
+	delete(sess.portals, "")
+	stmts, err := deltalake.ParseStatements(query)
+	if err == nil && len(stmts) == 0 {
+		sess.send('I', nil)
+	}
+	for _, stmt := range stmts {
+		if err != nil {
+			break
+		}
+		portal := &pgPortal{stmt: stmt}
+		if stmt.Kind == deltalake.SelectStatement {
+			if err = sess.describePortal(portal); err != nil {
+				break
+			}
+		}
+		err = sess.run(portal, 0)
+	}
+	if err != nil {
+		if err := sess.sendError(toPGError(err), false); err != nil {
+			return err
+		}
+	}
+	return sess.readyForQuery()
+}
+
+func (sess *pgSession) parse(msg *pgReader) error {
+	name, query := msg.cstring(), msg.cstring()
+	paramTypes := make([]uint32, msg.int16())
+	for i := range paramTypes {
+		paramTypes[i] = uint32(msg.int32())
+	}
+	if msg.err != nil {
+		return newPGError("08P01", "invalid Parse message")
+	}
+	stmts, err := deltalake.ParseStatements(query)
+	if err != nil {
+		return toPGError(err)
+	}
+	if len(stmts) > 1 {
+		return newPGError("42601", "cannot insert multiple commands into a prepared statement")
+	}
+	ps := &pgStatement{stmt: &deltalake.Statement{Kind: deltalake.EmptyStatement}, paramTypes: paramTypes}
+	if len(stmts) == 1 {
+		ps.stmt = stmts[0]
+	}
+	if n := ps.stmt.Params; n > len(ps.paramTypes) {
+		ps.paramTypes = append(ps.paramTypes, make([]uint32, n-len(ps.paramTypes))...)
+	}
+	sess.statements[name] = ps
+	sess.send('1', nil)
+	return nil
+}
+
+func (sess *pgSession) bind(msg *pgReader) error {
+	portalName, stmtName := msg.cstring(), msg.cstring()
+	paramFormats := make([]int16, msg.int16())
+	for i := range paramFormats {
+		paramFormats[i] = msg.int16()
+	}
+	params := make([][]byte, msg.int16())
+	for i := range params {
+		params[i] = msg.bytes(int(msg.int32()))
+	}
+	formats := make([]int16, msg.int16())
+	for i := range formats {
+		formats[i] = msg.int16()
+	}
+	if msg.err != nil {
+		return newPGError("08P01", "invalid Bind message")
+	}
+	ps, ok := sess.statements[stmtName]
+	if !ok {
+		return newPGError("26000", "prepared statement %q does not exist", stmtName)
+	}
+	if len(params) != len(ps.paramTypes) {
+		return newPGError("08P01", "bind message supplies %d parameters, but prepared statement requires %d", len(params), len(ps.paramTypes))
+	}
+
+	args := make([]any, len(params))
+	if len(params) > 0 {
+		if err := sess.resolveParamTypes(ps); err != nil {
+			return toPGError(err)
+		}
+		for i, raw := range params {
+			format := _pgFormatText
+			switch len(paramFormats) {
+			case 0:
+			case 1:
+				format = paramFormats[0]
+			default:
+				format = paramFormats[min(i, len(paramFormats)-1)]
+			}
+			v, err := decodePGParam(raw, ps.paramTypes[i], format)
+			if err != nil {
+				return newPGError("22P03", "parameter $%d: %v", i+1, err)
+			}
+			args[i] = v
+		}
+	}
+	sess.portals[portalName] = &pgPortal{stmt: ps.stmt, args: args, formats: formats}
+	sess.send('2', nil)
+	return nil
+}
+
+// resolveParamTypes infers types of parameters not declared by the client
+// from the columns they are compared with or inserted into
+func (sess *pgSession) resolveParamTypes(ps *pgStatement) error {
+	if !slices.Contains(ps.paramTypes, 0) {
+		return nil
+	}
+	var types []deltalake.ColumnType
+	switch ps.stmt.Kind {
+	case deltalake.SelectStatement, deltalake.InsertStatement:
+		h, err := sess.openTx(ps.stmt)
+		if err != nil {
+			return err
+		}
+		types, err = h.tx.ParamTypes(ps.stmt)
+		h.rollback()
+		if err != nil {
+			return err
+		}
+	}
+	for i, oid := range ps.paramTypes {
+		if oid != 0 {
+			continue
+		}
+		ps.paramTypes[i] = _pgText
+		if i < len(types) {
+			ps.paramTypes[i] = pgType(types[i])
+		}
+	}
+	return nil
+}
+
+func (sess *pgSession) describe(msg *pgReader) error {
+	kind, name := msg.byte(), msg.cstring()
+	if msg.err != nil {
+		return newPGError("08P01", "invalid Describe message")
+	}
+	switch kind {
+	case 'S':
+		ps, ok := sess.statements[name]
+		if !ok {
+			return newPGError("26000", "prepared statement %q does not exist", name)
+		}
+		if err := sess.resolveParamTypes(ps); err != nil {
+			return toPGError(err)
+		}
+		// columns don't depend on the parameters, they are planned as nulls
+		portal := &pgPortal{stmt: ps.stmt, args: make([]any, ps.stmt.Params)}
+		if err := sess.resolveColumns(portal); err != nil {
+			return err
+		}
+		buf := pgBuffer{}.int16(int16(len(ps.paramTypes)))
+		for _, oid := range ps.paramTypes {
+			buf = buf.int32(int32(oid))
+		}
+		sess.send('t', buf)
+		return sess.describePortal(portal)
+	case 'P':
+		portal, ok := sess.portals[name]
+		if !ok {
+			return newPGError("34000", "portal %q does not exist", name)
+		}
+		return sess.describePortal(portal)
+	default:
+		return newPGError("08P01", "invalid Describe kind %q", kind)
+	}
+}
+
+// resolveColumns finds columns returned by SELECT of the portal
+func (sess *pgSession) resolveColumns(portal *pgPortal) error {
+	if portal.stmt.Kind != deltalake.SelectStatement || portal.columns != nil {
+		return nil
+	}
+	h, it, err := sess.query(portal)
+	if err != nil {
+		return toPGError(err)
+	}
+	defer h.rollback()
+	portal.columns = it.Schema()
+	return it.Close()
+}
+
+// describePortal sends RowDescription of SELECT or NoData
+func (sess *pgSession) describePortal(portal *pgPortal) error {
+	if portal.stmt.Kind != deltalake.SelectStatement {
+		sess.send('n', nil)
+		return nil
+	}
+	if err := sess.resolveColumns(portal); err != nil {
+		return err
+	}
+	buf := pgBuffer{}.int16(int16(len(portal.columns)))
+	for i, col := range portal.columns {
+		oid := pgType(col.Type)
+		buf = buf.cstring(col.Name).
+			int32(0). // table OID
+			int16(0). // column number
+			int32(int32(oid)).
+			int16(pgTypeSize(oid)).
+			int32(-1). // type modifier
+			int16(portal.format(i))
+	}
+	sess.send('T', buf)
+	return nil
+}
+
+func (sess *pgSession) execute(msg *pgReader) error {
+	name, maxRows := msg.cstring(), msg.int32()
+	if msg.err != nil {
+		return newPGError("08P01", "invalid Execute message")
+	}
+	portal, ok := sess.portals[name]
+	if !ok {
+		return newPGError("34000", "portal %q does not exist", name)
+	}
+	if err := sess.run(portal, int(maxRows)); err != nil {
+		return toPGError(err)
+	}
+	return nil
+}
+
+func (sess *pgSession) close(msg *pgReader) error {
+	kind, name := msg.byte(), msg.cstring()
+	switch kind {
+	case 'S':
+		delete(sess.statements, name)
+	case 'P':
+		delete(sess.portals, name)
+	default:
+		return newPGError("08P01", "invalid Close kind %q", kind)
+	}
+	sess.send('3', nil)
+	return nil
+}
+
+// run executes statement of the portal and sends its results, SELECT stops
+// after maxRows rows when it is positive and can be resumed
+func (sess *pgSession) run(portal *pgPortal, maxRows int) error {
+	if sess.txFailed {
+		switch portal.stmt.Kind {
+		case deltalake.CommitStatement, deltalake.RollbackStatement:
+		default:
+			return newPGError("25P02", "current transaction is aborted, commands ignored until end of transaction block")
+		}
+	}
+	err := sess.runStatement(portal, maxRows)
+	if err != nil && sess.txId != nil {
+		sess.txFailed = true
+	}
+	return err
+}
+
+func (sess *pgSession) runStatement(portal *pgPortal, maxRows int) error {
+	switch portal.stmt.Kind {
+	case deltalake.EmptyStatement:
+		sess.send('I', nil)
+		return nil
+	case deltalake.SetStatement:
+		return sess.complete("SET")
+	case deltalake.BeginStatement:
+		if sess.txId == nil {
+			principal, _ := principalFromContext(sess.ctx)
+			id, _ := sess.s.txs.begin(principal)
+			sess.txId = &id
+		}
+		return sess.complete("BEGIN")
+	case deltalake.CommitStatement:
+		if sess.txId == nil {
+			return sess.complete("COMMIT")
+		}
+		tx := &protos2.Transaction{TxId: *sess.txId}
+		failed := sess.txFailed
+		sess.txId, sess.txFailed = nil, false
+		if failed {
+			if _, err := sess.s.Rollback(sess.ctx, tx); err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			return sess.complete("ROLLBACK")
+		}
+		if _, err := sess.s.Commit(sess.ctx, tx); err != nil {
+			return err
+		}
+		return sess.complete("COMMIT")
+	case deltalake.RollbackStatement:
+		if sess.txId != nil {
+			tx := &protos2.Transaction{TxId: *sess.txId}
+			sess.txId, sess.txFailed = nil, false
+			// transaction could be already rolled back after timeout
+			if _, err := sess.s.Rollback(sess.ctx, tx); err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+		}
+		return sess.complete("ROLLBACK")
+	case deltalake.InsertStatement:
+		n, err := sess.insert(portal)
+		if err != nil {
+			return err
+		}
+		return sess.complete(fmt.Sprintf("INSERT 0 %d", n))
+	case deltalake.SelectStatement:
+		return sess.runSelect(portal, maxRows)
+	default:
+		return newPGError("0A000", "unsupported statement")
+	}
+}
+
+// query plans SELECT of the portal after checking read permission on its
+// tables, the returned handle has to be rolled back once the query is closed
+func (sess *pgSession) query(portal *pgPortal) (*txHandle, deltalake.QueryIterator, error) {
+	h, err := sess.openTx(portal.stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	it, err := h.tx.QueryContext(sess.ctx, portal.stmt.Text, portal.args...)
+	if err != nil {
+		h.rollback()
+		return nil, nil, err
+	}
+	return h, it, nil
+}
+
+func (sess *pgSession) runSelect(portal *pgPortal, maxRows int) error {
+	if !portal.started {
+		portal.started = true
+		h, it, err := sess.query(portal)
+		if err != nil {
+			return err
+		}
+		defer h.rollback()
+		portal.columns = it.Schema()
+
+		// without row limit rows are streamed, otherwise they are kept in
+		// the portal until it is drained
+		sent := 0
+		buffered := maxRows > 0
+		for row, err := range deltalake.All(it) {
+			if err != nil {
+				return err
+			}
+			sent++
+			if buffered {
+				portal.rows = append(portal.rows, row)
+				continue
+			}
+			if err := sess.sendRow(portal, row); err != nil {
+				return err
+			}
+		}
+		if !buffered {
+			return sess.complete(fmt.Sprintf("SELECT %d", sent))
+		}
+	}
+
+	n := len(portal.rows)
+	if maxRows > 0 {
+		n = min(n, maxRows)
+	}
+	for _, row := range portal.rows[:n] {
+		if err := sess.sendRow(portal, row); err != nil {
+			return err
+		}
+	}
+	portal.rows = portal.rows[n:]
+	if len(portal.rows) > 0 {
+		// PortalSuspended
+		sess.send('s', nil)
+		return nil
+	}
+	return sess.complete(fmt.Sprintf("SELECT %d", n))
+}
+
+func (sess *pgSession) sendRow(portal *pgPortal, row []any) error {
+	buf := pgBuffer{}.int16(int16(len(row)))
+	for i, v := range row {
+		raw, err := encodePGValue(v, pgType(portal.columns[i].Type), portal.format(i))
+		if err != nil {
+			return newPGError("22000", "column %s: %v", portal.columns[i].Name, err)
+		}
+		if raw == nil {
+			buf = buf.int32(-1)
+			continue
+		}
+		buf = append(buf.int32(int32(len(raw))), raw...)
+	}
+	sess.send('D', buf)
+	return nil
+}
+
+func (sess *pgSession) insert(portal *pgPortal) (int64, error) {
+	h, err := sess.openTx(portal.stmt)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := h.tx.InsertRows(portal.stmt, portal.args...)
+	h.rollback()
+	if errors.Is(err, deltalake.ErrSchemaMismatch) {
+		return 0, &pgError{code: "22P02", msg: err.Error()}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	summary, err := sess.s.insert(sess.ctx, sess.txId, nil, func() (string, []any, error) {
+		if len(rows) == 0 {
+			return "", nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return portal.stmt.Table, row, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return summary.Rows, nil
+}
+
+// openTx checks permission of the statement on its tables, SELECT reads them
+// and INSERT writes. The returned handle has to be rolled back.
+func (sess *pgSession) openTx(stmt *deltalake.Statement) (*txHandle, error) {
+	tables, perm := []string{stmt.Table}, permWrite
+	if stmt.Kind == deltalake.SelectStatement {
+		var err error
+		if tables, err = deltalake.QueryTables(stmt.Text); err != nil {
+			return nil, err
+		}
+		perm = permRead
+	}
+	for _, table := range tables {
+		if err := sess.s.authorize(sess.ctx, table, perm); err != nil {
+			return nil, err
+		}
+	}
+	return sess.s.openTx(sess.ctx, sess.txId)
+}
+
+// format returns result format of the column requested in Bind
+func (p *pgPortal) format(col int) int16 {
+	switch len(p.formats) {
+	case 0:
+		return _pgFormatText
+	case 1:
+		return p.formats[0]
+	default:
+		if col < len(p.formats) {
+			return p.formats[col]
+		}
+		return _pgFormatText
+	}
+}
+
+func (sess *pgSession) complete(tag string) error {
+	sess.send('C', pgBuffer{}.cstring(tag))
+	return nil
+}
+
+func (sess *pgSession) readyForQuery() error {
+	state := byte('I')
+	switch {
+	case sess.txFailed:
+		state = 'E'
+	case sess.txId != nil:
+		state = 'T'
+	}
+	sess.send('Z', []byte{state})
+	if err := sess.w.Flush(); err != nil {
+		return err
+	}
+	sess.srv.setIdle(sess, true)
+	return nil
+}
+
+// sendError sends ErrorResponse, fatal errors are flushed since the
+// connection is closed afterwards
+func (sess *pgSession) sendError(pe *pgError, fatal bool) error {
+	severity := "ERROR"
+	if fatal {
+		severity = "FATAL"
+	}
+	buf := pgBuffer{}.
+		byte('S').cstring(severity).
+		byte('V').cstring(severity).
+		byte('C').cstring(pe.code).
+		byte('M').cstring(pe.msg).
+		byte(0)
+	sess.send('E', buf)
+	if fatal {
+		return sess.w.Flush()
+	}
+	return nil
+}
+
+// send buffers the message, buffer is flushed by ReadyForQuery, Flush
+// message or once it is full
+func (sess *pgSession) send(typ byte, payload []byte) {
+	var header [5]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
+	sess.w.Write(header[:])
+	sess.w.Write(payload)
+}
+
+func (sess *pgSession) readStartup() (*pgReader, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(sess.r, size[:]); err != nil {
+		return nil, err
+	}
+	return sess.readPayload(binary.BigEndian.Uint32(size[:]))
+}
+
+func (sess *pgSession) readMessage() (byte, *pgReader, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(sess.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	msg, err := sess.readPayload(binary.BigEndian.Uint32(header[1:]))
+	return header[0], msg, err
+}
+
+func (sess *pgSession) readPayload(size uint32) (*pgReader, error) {
+	if size < 4 || size > _maxPGMessageSize {
+		return nil, fmt.Errorf("invalid message size %d", size)
+	}
+	buf := make([]byte, size-4)
+	if _, err := io.ReadFull(sess.r, buf); err != nil {
+		return nil, err
+	}
+	return &pgReader{buf: buf}, nil
+}
+
+// pgBuffer builds message payloads
+type pgBuffer []byte
+
+func (b pgBuffer) byte(v byte) pgBuffer {
+	return append(b, v)
+}
+
+func (b pgBuffer) int16(v int16) pgBuffer {
+	return binary.BigEndian.AppendUint16(b, uint16(v))
+}
+
+func (b pgBuffer) int32(v int32) pgBuffer {
+	return binary.BigEndian.AppendUint32(b, uint32(v))
+}
+
+func (b pgBuffer) cstring(s string) pgBuffer {
+	return append(append(b, s...), 0)
+}
+
+// pgReader reads message payloads, err is set once the payload is too short
+// and zero values are returned afterwards
+type pgReader struct {
+	buf []byte
+	err error
+}
+
+func (r *pgReader) take(n int) []byte {
+	if r.err != nil || n > len(r.buf) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *pgReader) byte() byte {
+	if v := r.take(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (r *pgReader) int16() int16 {
+	if v := r.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (r *pgReader) int32() int32 {
+	if v := r.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+// bytes returns nil for negative length which stands for null
+func (r *pgReader) bytes(n int) []byte {
+	if n < 0 {
+		return nil
+	}
+	return r.take(n)
+}
+
+func (r *pgReader) cstring() string {
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = io.ErrUnexpectedEOF
+	return ""
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/deltalake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pgTestConn is a minimal client of the PostgreSQL wire protocol
+type pgTestConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type pgTestResult struct {
+	types   []byte // received message types
+	columns []string
+	oids    []uint32
+	rows    [][][]byte // nil for null values
+	tags    []string
+	errors  []*pgError
+	status  byte // transaction status of ReadyForQuery
+}
+
+func newTestPG(t *testing.T, configure ...func(s *Server)) (*testClient, string) {
+	c := newTestServer(t, configure...)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := newPGServer(c.server, nil)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Close)
+	return c, lis.Addr().String()
+}
+
+// pgConnect returns error sent by the server when startup fails
+func pgConnect(t *testing.T, addr, password string) (*pgTestConn, *pgError) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &pgTestConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	startup := pgBuffer{}.int32(_pgProtocolVersion).cstring("user").cstring("test").byte(0)
+	_, err = conn.Write(append(pgBuffer{}.int32(int32(len(startup)+4)), startup...))
+	require.NoError(t, err)
+	for {
+		typ, msg := c.recv()
+		switch typ {
+		case 'R':
+			if msg.int32() == 3 {
+				c.send('p', pgBuffer{}.cstring(password))
+			}
+		case 'E':
+			return nil, readPGError(msg)
+		case 'Z':
+			return c, nil
+		}
+	}
+}
+
+func readPGError(msg *pgReader) *pgError {
+	pe := &pgError{}
+	for field := msg.byte(); field != 0; field = msg.byte() {
+		switch v := msg.cstring(); field {
+		case 'C':
+			pe.code = v
+		case 'M':
+			pe.msg = v
+		}
+	}
+	return pe
+}
+
+func (c *pgTestConn) send(typ byte, payload []byte) {
+	header := pgBuffer{}.byte(typ).int32(int32(len(payload) + 4))
+	_, err := c.conn.Write(append(header, payload...))
+	require.NoError(c.t, err)
+}
+
+func (c *pgTestConn) recv() (byte, *pgReader) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(c.r, header)
+	require.NoError(c.t, err)
+	payload := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	_, err = io.ReadFull(c.r, payload)
+	require.NoError(c.t, err)
+	return header[0], &pgReader{buf: payload}
+}
+
+// result reads messages until ReadyForQuery
+func (c *pgTestConn) result() *pgTestResult {
+	res := &pgTestResult{}
+	for {
+		typ, msg := c.recv()
+		res.types = append(res.types, typ)
+		switch typ {
+		case 'T':
+			for n := msg.int16(); n > 0; n-- {
+				res.columns = append(res.columns, msg.cstring())
+				msg.int32()
+				msg.int16()
+				res.oids = append(res.oids, uint32(msg.int32()))
+				msg.int16()
+				msg.int32()
+				msg.int16()
+			}
+		case 't':
+			for n := msg.int16(); n > 0; n-- {
+				res.oids = append(res.oids, uint32(msg.int32()))
+			}
+		case 'D':
+			row := make([][]byte, msg.int16())
+			for i := range row {
+				row[i] = msg.bytes(int(msg.int32()))
+			}
+			res.rows = append(res.rows, row)
+		case 'C':
+			res.tags = append(res.tags, msg.cstring())
+		case 'E':
+			res.errors = append(res.errors, readPGError(msg))
+		case 'Z':
+			res.status = msg.byte()
+			require.NoError(c.t, msg.err)
+			return res
+		}
+		require.NoError(c.t, msg.err)
+	}
+}
+
+func (c *pgTestConn) query(sql string) *pgTestResult {
+	c.send('Q', pgBuffer{}.cstring(sql))
+	return c.result()
+}
+
+func (r *pgTestResult) text() [][]string {
+	rows := make([][]string, len(r.rows))
+	for i, row := range r.rows {
+		rows[i] = make([]string, len(row))
+		for j, v := range row {
+			if v == nil {
+				rows[i][j] = "NULL"
+			} else {
+				rows[i][j] = string(v)
+			}
+		}
+	}
+	return rows
+}
+
+func TestPGWireStartup(t *testing.T) {
+	_, addr := newTestPG(t)
+
+	// SSL is refused when TLS is not configured
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write(pgBuffer{}.int32(8).int32(_pgSSLRequest))
+	require.NoError(t, err)
+	resp := make([]byte, 1)
+	_, err = io.ReadFull(conn, resp)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{'N'}, resp)
+
+	c, pe := pgConnect(t, addr, "")
+	require.Nil(t, pe)
+	res := c.query("")
+	assert.Equal(t, []byte{'I', 'Z'}, res.types)
+	assert.Equal(t, byte('I'), res.status)
+	res = c.query("SET extra_float_digits = 3")
+	assert.Equal(t, []string{"SET"}, res.tags)
+	res = c.query("SELECT * FROM foo")
+	require.Len(t, res.errors, 1)
+	assert.Equal(t, "42P01", res.errors[0].code)
+}
+
+func TestPGWireQueries(t *testing.T) {
+	c, addr := newTestPG(t)
+	tx := c.server.delta.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", deltalake.Schema{
+		{Name: "id", Type: deltalake.Int64Type},
+		{Name: "name", Type: deltalake.StringType},
+		{Name: "price", Type: deltalake.DecimalType},
+		{Name: "tags", Type: deltalake.ListType},
+	}))
+	require.NoError(t, tx.Commit())
+
+	conn, pe := pgConnect(t, addr, "")
+	require.Nil(t, pe)
+
+	res := conn.query("INSERT INTO foo VALUES (1, 'one', 1.5, '[\"a\"]'), (2, 'it''s', -2, null)")
+	require.Empty(t, res.errors)
+	assert.Equal(t, []string{"INSERT 0 2"}, res.tags)
+	res = conn.query("insert into foo (name, id) values ('three', 3)")
+	require.Empty(t, res.errors)
+
+	res = conn.query("SELECT * FROM foo")
+	require.Empty(t, res.errors)
+	assert.Equal(t, []string{"id", "name", "price", "tags"}, res.columns)
+	assert.Equal(t, []uint32{_pgInt8, _pgText, _pgNumeric, _pgJSON}, res.oids)
+	assert.Equal(t, [][]string{
+		{"1", "one", "1.5", `["a"]`},
+		{"2", "it's", "-2", "NULL"},
+		{"3", "three", "NULL", "NULL"},
+	}, res.text())
+	assert.Equal(t, []string{"SELECT 3"}, res.tags)
+
+	res = conn.query("SELECT name FROM foo WHERE id >= 2 AND name != 'x' LIMIT 1")
+	assert.Equal(t, [][]string{{"it's"}}, res.text())
+	assert.Equal(t, []string{"SELECT 1"}, res.tags)
+
+	// rows of the transaction are visible after commit
+	res = conn.query("BEGIN; INSERT INTO foo (id) VALUES (4)")
+	require.Empty(t, res.errors)
+	assert.Equal(t, byte('T'), res.status)
+	assert.Len(t, c.scan(t, "foo"), 3)
+	res = conn.query("COMMIT")
+	assert.Equal(t, []string{"COMMIT"}, res.tags)
+	assert.Equal(t, byte('I'), res.status)
+	assert.Len(t, c.scan(t, "foo"), 4)
+
+	// failed statement aborts the transaction
+	res = conn.query("BEGIN")
+	require.Empty(t, res.errors)
+	res = conn.query("INSERT INTO foo (id) VALUES ('x')")
+	require.Len(t, res.errors, 1)
+	assert.Equal(t, "22P02", res.errors[0].code)
+	assert.Equal(t, byte('E'), res.status)
+	res = conn.query("SELECT * FROM foo")
+	require.Len(t, res.errors, 1)
+	assert.Equal(t, "25P02", res.errors[0].code)
+	res = conn.query("COMMIT")
+	assert.Equal(t, []string{"ROLLBACK"}, res.tags)
+	assert.Equal(t, byte('I'), res.status)
+
+	for sql, code := range map[string]string{
+		"SELECT bar FROM foo":            "42703",
+		"SELECT * FROM foo WHERE":        "42601",
+		"UPDATE foo SET id = 1":          "0A000",
+		"INSERT INTO foo VALUES (1, 2)":  "",
+		"INSERT INTO missing VALUES (1)": "42P01",
+		"SELECT * FROM foo; SELECT":      "42601",
+	} {
+		res := conn.query(sql)
+		if code == "" {
+			assert.Empty(t, res.errors, sql)
+			continue
+		}
+		require.Len(t, res.errors, 1, sql)
+		assert.Equal(t, code, res.errors[0].code, sql)
+		assert.Equal(t, byte('I'), res.status)
+	}
+}
+
+func TestPGWireExtended(t *testing.T) {
+	c, addr := newTestPG(t)
+	tx := c.server.delta.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", deltalake.Schema{
+		{Name: "id", Type: deltalake.Int64Type},
+		{Name: "price", Type: deltalake.DecimalType},
+	}))
+	require.NoError(t, tx.Commit())
+	conn, pe := pgConnect(t, addr, "")
+	require.Nil(t, pe)
+
+	// binary int8 parameter of prepared insert
+	conn.send('P', pgBuffer{}.cstring("ins").cstring("INSERT INTO foo VALUES ($1, $2)").int16(0))
+	conn.send('D', pgBuffer{}.byte('S').cstring("ins"))
+	conn.send('S', nil)
+	res := conn.result()
+	require.Empty(t, res.errors)
+	assert.Equal(t, []byte{'1', 't', 'n', 'Z'}, res.types)
+	assert.Equal(t, []uint32{_pgInt8, _pgNumeric}, res.oids)
+
+	for i := int64(0); i < 5; i++ {
+		id := binary.BigEndian.AppendUint64(nil, uint64(i))
+		bind := pgBuffer{}.cstring("").cstring("ins").
+			int16(2).int16(_pgFormatBinary).int16(_pgFormatText).
+			int16(2).int32(8)
+		bind = append(bind, id...)
+		bind = bind.int32(4)
+		bind = append(bind, "10.5"...)
+		conn.send('B', bind.int16(0))
+		conn.send('E', pgBuffer{}.cstring("").int32(0))
+	}
+	conn.send('S', nil)
+	res = conn.result()
+	require.Empty(t, res.errors)
+	assert.Len(t, res.tags, 5)
+	assert.Equal(t, "INSERT 0 1", res.tags[0])
+
+	// select with row limit and binary results
+	conn.send('P', pgBuffer{}.cstring("").cstring("SELECT id, price FROM foo WHERE id >= $1").int16(0))
+	bind := pgBuffer{}.cstring("p").cstring("").int16(0).int16(1).int32(1)
+	bind = append(bind, '2')
+	conn.send('B', bind.int16(1).int16(_pgFormatBinary))
+	conn.send('D', pgBuffer{}.byte('P').cstring("p"))
+	conn.send('E', pgBuffer{}.cstring("p").int32(2))
+	conn.send('E', pgBuffer{}.cstring("p").int32(2))
+	conn.send('S', nil)
+	res = conn.result()
+	require.Empty(t, res.errors)
+	assert.Equal(t, []byte{'1', '2', 'T', 'D', 'D', 's', 'D', 'C', 'Z'}, res.types)
+	require.Len(t, res.rows, 3)
+	assert.Equal(t, binary.BigEndian.AppendUint64(nil, 2), res.rows[0][0])
+	// 10.5 is 0010 . 5000 in base 10000 with weight 0 and scale 1
+	assert.Equal(t, []byte{0, 2, 0, 0, 0, 0, 0, 1, 0, 10, 0x13, 0x88}, res.rows[0][1])
+	assert.Equal(t, []string{"SELECT 1"}, res.tags)
+
+	// messages after error are skipped until Sync
+	conn.send('P', pgBuffer{}.cstring("").cstring("SELECT * FROM missing").int16(0))
+	conn.send('D', pgBuffer{}.byte('S').cstring(""))
+	conn.send('B', pgBuffer{}.cstring("").cstring("").int16(0).int16(0).int16(0))
+	conn.send('E', pgBuffer{}.cstring("").int32(0))
+	conn.send('S', nil)
+	res = conn.result()
+	assert.Equal(t, []byte{'1', 'E', 'Z'}, res.types)
+	assert.Equal(t, "42P01", res.errors[0].code)
+}
+
+func TestPGWireAuth(t *testing.T) {
+	_, addr := newTestPG(t, withAuth(t, map[string]string{"admin-token": "admin"}, "admin"))
+
+	_, pe := pgConnect(t, addr, "wrong")
+	require.NotNil(t, pe)
+	assert.Equal(t, "28P01", pe.code)
+
+	conn, pe := pgConnect(t, addr, "admin-token")
+	require.Nil(t, pe)
+	res := conn.query("SELECT * FROM _acl")
+	assert.Empty(t, res.errors)
+}
+
+func TestEncodePGNumeric(t *testing.T) {
+	for _, tc := range []struct {
+		raw    string
+		digits []int16
+		weight int16
+		sign   uint16
+		scale  uint16
+	}{
+		{"0", nil, 0, 0, 0},
+		{"12345.678", []int16{1, 2345, 6780}, 1, 0, 3},
+		{"-0.0001", []int16{1}, -1, 0x4000, 4},
+		{"1e4", []int16{1}, 1, 0, 0},
+		{"1.50", []int16{1, 5000}, 0, 0, 1},
+	} {
+		raw, err := encodePGNumeric(tc.raw)
+		require.NoError(t, err, tc.raw)
+		r := &pgReader{buf: raw}
+		n := r.int16()
+		assert.Equal(t, tc.weight, r.int16(), tc.raw)
+		assert.Equal(t, tc.sign, uint16(r.int16()), tc.raw)
+		assert.Equal(t, tc.scale, uint16(r.int16()), tc.raw)
+		var digits []int16
+		for ; n > 0; n-- {
+			digits = append(digits, r.int16())
+		}
+		assert.Equal(t, tc.digits, digits, tc.raw)
+	}
+	_, err := encodePGNumeric("1/3")
+	assert.Error(t, err)
+}
+
+func TestPGWireShutdown(t *testing.T) {
+	c := newTestServer(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := newPGServer(c.server, nil)
+	go srv.Serve(lis)
+
+	conn, pe := pgConnect(t, lis.Addr().String(), "")
+	require.Nil(t, pe)
+	res := conn.query("BEGIN")
+	require.Empty(t, res.errors)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	_, err = conn.r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	// open transaction is left to the shutdown policy of the txManager
+	c.server.txs.mu.Lock()
+	assert.Len(t, c.server.txs.txs, 1)
+	c.server.txs.mu.Unlock()
+}
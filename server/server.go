@@ -6,13 +6,26 @@ import (
 	"flag"
 	"fmt"
 	protos2 "github.com/deltalake/protos"
+	"io"
 	"log"
 	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
+	"github.com/apache/arrow-go/v18/arrow/flight"
 	"github.com/deltalake"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Server struct {
@@ -22,91 +35,309 @@ type Server struct {
 	delta      deltalake.DeltaStorage
 	objStorage deltalake.ObjectStorage
 
-	txs map[int64]*deltalake.Transaction
+	txs *txManager
+
+	auth Authenticator // nil when authentication is disabled
+	acl  *aclStore
 }
 
 var _ protos2.WriterServiceServer = (*Server)(nil)
 var _ protos2.ReaderServiceServer = (*Server)(nil)
 
-func (s *Server) Scan(in *protos2.GetRequest, response grpc.ServerStreamingServer[protos2.DataResponse]) (err error) {
+func (s *Server) Scan(in *protos2.GetRequest, response grpc.ServerStreamingServer[protos2.DataResponse]) error {
 	log.Printf("Received request to scan table: %s", in.Table)
+	return s.scan(response.Context(), in, func(v []any) error {
+		row, err := toProtoRow(v)
+		if err != nil {
+			return err
+		}
+		return response.Send(&protos2.DataResponse{
+			Row: row,
+		})
+	})
+}
+
+// scan sends rows of the table matching in.Where, the condition is the WHERE
+// clause of the library queries. At most in.Limit rows are sent when it is
+// positive.
+func (s *Server) scan(ctx context.Context, in *protos2.GetRequest, send func(row []any) error) error {
 	table := in.Table
+	if err := s.authorize(ctx, table, permRead); err != nil {
+		return err
+	}
 
-	tx, _ := s.getTx(in.TxId)
-	it, err := tx.Iter(table)
+	h, err := s.openTx(ctx, in.TxId)
+	if err != nil {
+		return err
+	}
+	defer h.rollback()
+	it, err := h.tx.QueryWhere(ctx, table, in.Where)
 	if err != nil {
 		return err
 	}
+	sent := int64(0)
+	for v, err := range deltalake.All(it) {
+		if err != nil {
+			return err
+		}
+		slog.Debug("got following values", slog.Any("data", v))
+		if err = send(v); err != nil {
+			return err
+		}
+		// rows after the limit are not read
+		if sent++; in.Limit > 0 && sent == in.Limit {
+			return nil
+		}
+	}
+	return nil
+}
 
-	// todo: ugly architecture
-	mut := func(xs []any) []string {
-		slog.Debug("got following values", slog.Any("data", xs))
-		res := make([]string, len(xs))
-		for i, v := range xs {
-			res[i] = fmt.Sprintf("%v", v)
+func (s *Server) DescribeTable(ctx context.Context, in *protos2.DescribeTableRequest) (*protos2.TableSchema, error) {
+	if err := s.authorize(ctx, in.Table, permRead); err != nil {
+		return nil, err
+	}
+	h, err := s.openTx(ctx, in.TxId)
+	if err != nil {
+		return nil, err
+	}
+	defer h.rollback()
+	schema, err := h.tx.Schema(in.Table)
+	if err != nil {
+		return nil, err
+	}
+	return toProtoSchema(in.Table, schema), nil
+}
+
+func (s *Server) History(ctx context.Context, in *protos2.HistoryRequest) (*protos2.HistoryResponse, error) {
+	if err := s.authorize(ctx, in.Table, permRead); err != nil {
+		return nil, err
+	}
+	history, err := s.delta.History(in.Table, int(in.Limit))
+	if err != nil {
+		return nil, err
+	}
+	resp := &protos2.HistoryResponse{Commits: make([]*protos2.CommitInfo, len(history))}
+	for i, c := range history {
+		info := &protos2.CommitInfo{
+			Version:             c.Version,
+			Operation:           c.Operation,
+			OperationParameters: c.OperationParameters,
+			ClientId:            c.ClientId,
+			Metrics:             c.Metrics,
 		}
-		return res
+		if !c.Timestamp.IsZero() {
+			info.Timestamp = timestamppb.New(c.Timestamp)
+		}
+		resp.Commits[i] = info
 	}
-	var (
-		v []any
-	)
-	for v, err = it.First(); err == nil; v, err = it.Next() {
-		if err = response.Send(&protos2.DataResponse{
-			Data: mut(v),
-		}); err != nil {
+	return resp, nil
+}
+
+// _subscribeChunkBytes limits encoded rows of a single TableVersion message,
+// gRPC clients reject messages over 4 MB by default
+const _subscribeChunkBytes = 1 << 20
+
+// Subscribe streams versions changing rows of the table until the client
+// cancels the stream
+func (s *Server) Subscribe(in *protos2.SubscribeRequest, stream grpc.ServerStreamingServer[protos2.TableVersion]) error {
+	ctx := stream.Context()
+	if err := s.authorize(ctx, in.Table, permRead); err != nil {
+		return err
+	}
+	for tv, err := range s.delta.Watch(ctx, in.Table, in.FromVersion) {
+		if err != nil {
+			return err
+		}
+		if err := sendTableVersion(stream, tv); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *Server) Set(ctx context.Context, in *protos2.SetRequest) (*protos2.Error, error) {
-	// ugly
-	table, values := in.Table, in.Values
-	tx, has := s.getTx(in.TxId)
-	input := func() []any {
-		res := make([]any, len(values))
-		for i, val := range values {
-			res[i] = any(val)
-		}
-		return res
-	}()
-	if err := tx.Put(table, input); err != nil {
-		return &protos2.Error{
-			Status:  500,
-			Message: err.Error(),
-		}, err
+// sendTableVersion sends rows of the version in messages of at most
+// _subscribeChunkBytes, removed rows first
+func sendTableVersion(stream grpc.ServerStreamingServer[protos2.TableVersion], tv *deltalake.TableVersion) error {
+	var ts *timestamppb.Timestamp
+	if !tv.Timestamp.IsZero() {
+		ts = timestamppb.New(tv.Timestamp)
 	}
-	if !has {
-		if err := tx.Commit(); err != nil {
-			return &protos2.Error{
-				Status:  500,
-				Message: err.Error(),
-			}, err
+	resp := &protos2.TableVersion{Version: tv.Version, Timestamp: ts}
+	size := 0
+	for i, v := range slices.Concat(tv.Removed, tv.Added) {
+		row, err := toProtoRow(v)
+		if err != nil {
+			return err
+		}
+		rowSize := proto.Size(row)
+		if size > 0 && size+rowSize > _subscribeChunkBytes {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			offset := resp.Offset + int64(len(resp.Removed)+len(resp.Added))
+			resp = &protos2.TableVersion{Version: tv.Version, Timestamp: ts, Offset: offset}
+			size = 0
 		}
+		if i < len(tv.Removed) {
+			resp.Removed = append(resp.Removed, row)
+		} else {
+			resp.Added = append(resp.Added, row)
+		}
+		size += rowSize
+	}
+	resp.Last = true
+	return stream.Send(resp)
+}
+
+func (s *Server) Set(ctx context.Context, in *protos2.SetRequest) (*protos2.Error, error) {
+	table := in.Table
+	if err := s.authorize(ctx, table, permWrite); err != nil {
+		return nil, err
+	}
+	input, err := fromProtoRow(in.Row)
+	if err != nil {
+		return nil, err
+	}
+	h, err := s.openTx(ctx, in.TxId)
+	if err != nil {
+		return nil, err
+	}
+	if setAppTransaction(h, in.AppTransaction) {
+		h.rollback()
+		return &protos2.Error{Status: 200, Message: "duplicate app transaction"}, nil
+	}
+	if err := h.tx.PutContext(ctx, table, input); err != nil {
+		h.rollback()
+		return nil, err
 	}
+	h.touch(table)
+	if _, _, err := h.commit(); err != nil {
+		return nil, err
+	}
+	s.tableChanged(table)
 	return &protos2.Error{
 		Status: 200,
 	}, nil
 }
 
+func (s *Server) BulkInsert(stream grpc.ClientStreamingServer[protos2.SetRequest, protos2.InsertSummary]) error {
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return stream.SendAndClose(&protos2.InsertSummary{TableRows: make(map[string]int64)})
+	}
+	if err != nil {
+		return err
+	}
+	summary, err := s.insert(stream.Context(), first.TxId, first.AppTransaction, func() (string, []any, error) {
+		in := first
+		if in != nil {
+			first = nil
+		} else if in, err = stream.Recv(); err != nil {
+			return "", nil, err
+		}
+		row, err := fromProtoRow(in.Row)
+		return in.Table, row, err
+	})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(summary)
+}
+
+// insert puts rows returned by next in a single transaction, next returns
+// io.EOF after the last row. Rows of app transaction already committed are
+// read but not written.
+func (s *Server) insert(ctx context.Context, txId *int64, app *protos2.AppTransaction, next func() (table string, row []any, err error)) (*protos2.InsertSummary, error) {
+	summary := &protos2.InsertSummary{TableRows: make(map[string]int64)}
+	h, err := s.openTx(ctx, txId)
+	if err != nil {
+		return nil, err
+	}
+	summary.Duplicate = setAppTransaction(h, app)
+
+	var (
+		table string
+		input []any
+	)
+	for {
+		if table, input, err = next(); err != nil {
+			break
+		}
+		if err = s.authorize(ctx, table, permWrite); err != nil {
+			break
+		}
+		if summary.Duplicate {
+			continue
+		}
+		// buffered rows are flushed by the transaction once the buffer is full
+		if err = h.tx.PutContext(ctx, table, input); err != nil {
+			break
+		}
+		h.touch(table)
+		summary.Rows++
+		summary.TableRows[table]++
+	}
+	if !errors.Is(err, io.EOF) {
+		h.rollback()
+		return nil, err
+	}
+	if summary.Duplicate {
+		h.rollback()
+		return summary, nil
+	}
+
+	summary.Committed, summary.Version, err = h.commit()
+	if err != nil {
+		return nil, err
+	}
+	if summary.Committed {
+		for table := range summary.TableRows {
+			s.tableChanged(table)
+		}
+	}
+	return summary, nil
+}
+
+// setAppTransaction declares the app transaction of the request in the
+// transaction, true is returned when its version was already committed
+func setAppTransaction(h *txHandle, app *protos2.AppTransaction) bool {
+	if app == nil {
+		return false
+	}
+	if v, ok := h.tx.AppTransactionVersion(app.AppId); ok && v >= app.Version {
+		return true
+	}
+	h.tx.SetAppTransaction(app.AppId, app.Version)
+	return false
+}
+
 func (s *Server) Create(ctx context.Context, in *protos2.CreateRequest) (*protos2.Error, error) {
-	tx, has := s.getTx(in.TxId)
 	table := in.Table
-	if err := tx.Create(table, in.Columns); err != nil {
-		return &protos2.Error{
-			Status:  500,
-			Message: err.Error(),
-		}, err
+	if err := s.authorize(ctx, table, permAdmin); err != nil {
+		return nil, err
 	}
-
-	if !has {
-		if err := tx.Commit(); err != nil {
-			return &protos2.Error{
-				Status:  500,
-				Message: err.Error(),
-			}, err
+	h, err := s.openTx(ctx, in.TxId)
+	if err != nil {
+		return nil, err
+	}
+	create := func() error {
+		if len(in.Schema) > 0 {
+			schema, err := fromProtoSchema(in.Schema)
+			if err != nil {
+				return err
+			}
+			return h.tx.CreateWithSchema(table, schema)
 		}
+		return h.tx.Create(table, in.Columns)
+	}
+	if err := create(); err != nil {
+		h.rollback()
+		return nil, err
+	}
+	h.touch(table)
+
+	if _, _, err := h.commit(); err != nil {
+		return nil, err
 	}
 
 	return &protos2.Error{
@@ -114,70 +345,256 @@ func (s *Server) Create(ctx context.Context, in *protos2.CreateRequest) (*protos
 	}, nil
 }
 
-func (s *Server) NewTransaction(context.Context, *protos2.Empty) (*protos2.Transaction, error) {
-	tx := s.delta.NewTransaction()
-	s.txs[tx.GetId()] = tx
-	return &protos2.Transaction{TxId: tx.GetId()}, nil
+func (s *Server) NewTransaction(ctx context.Context, _ *protos2.Empty) (*protos2.Transaction, error) {
+	principal, _ := principalFromContext(ctx)
+	id, _ := s.txs.begin(principal)
+	return &protos2.Transaction{TxId: id}, nil
 }
 
 func (s *Server) Commit(ctx context.Context, in *protos2.Transaction) (*protos2.Error, error) {
-	tx, ok := s.txs[in.TxId]
-	if !ok {
-		return &protos2.Error{Status: 500, Message: "invalid transaction id"}, errors.New("invalid transaction id")
+	var tables []string
+	err := s.txs.commit(in.TxId, func(e *txEntry) error {
+		if err := s.checkOwner(ctx, e); err != nil {
+			return err
+		}
+		for table := range e.tables {
+			if err := s.authorize(ctx, table, permWrite); err != nil {
+				return err
+			}
+			tables = append(tables, table)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	for _, table := range tables {
+		s.tableChanged(table)
+	}
+	return &protos2.Error{Status: 200}, nil
+}
 
-	err := tx.Commit()
+func (s *Server) Rollback(ctx context.Context, in *protos2.Transaction) (*protos2.Error, error) {
+	err := s.txs.rollback(in.TxId, func(e *txEntry) error {
+		return s.checkOwner(ctx, e)
+	})
 	if err != nil {
-		return &protos2.Error{Status: 500, Message: err.Error()}, err
+		return nil, err
 	}
-	delete(s.txs, in.TxId)
 	return &protos2.Error{Status: 200}, nil
 }
 
-func main() {
-	storageType := flag.Int("storage", 0, "storage type: 0 - local")
-	storageDst := flag.String("storageDst", "", "where storage should be kept")
-	flag.Parse()
+func (s *Server) KeepAlive(ctx context.Context, in *protos2.Transaction) (*protos2.Lease, error) {
+	expiresAt, err := s.txs.keepAlive(in.TxId, func(e *txEntry) error {
+		return s.checkOwner(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &protos2.Lease{TxId: in.TxId, ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
 
-	if storageType == nil || *storageType != 0 {
-		panic("invalid storage type")
+// openTx returns transaction for the request, registered transactions can be
+// used only by the principal which started them
+func (s *Server) openTx(ctx context.Context, id *int64) (*txHandle, error) {
+	h, err := s.txs.open(id)
+	if err != nil {
+		return nil, err
 	}
+	if principal, ok := principalFromContext(ctx); ok && h.entry == nil && principal != "" {
+		h.tx.SetClientId(principal)
+	}
+	if h.entry != nil {
+		if err := s.checkOwner(ctx, h.entry); err != nil {
+			h.rollback()
+			return nil, err
+		}
+	}
+	return h, nil
+}
 
-	if storageDst == nil {
-		panic("no storage destination provided")
+func (s *Server) checkOwner(ctx context.Context, e *txEntry) error {
+	if s.acl == nil {
+		return nil
+	}
+	principal, _ := principalFromContext(ctx)
+	if principal != e.owner && !s.acl.admins[principal] {
+		return status.Errorf(codes.PermissionDenied, "transaction %d belongs to another principal", e.id)
 	}
+	return nil
+}
 
-	store := deltalake.NewFileStorage(*storageDst)
-	d := deltalake.New(store, deltalake.DefaultOpts())
+// tableChanged is called after commit modifying the table
+func (s *Server) tableChanged(table string) {
+	if s.acl != nil && table == _aclTable {
+		s.acl.invalidate()
+	}
+}
 
-	log.Printf("Starting server on port 9000")
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", 9000))
+func newGRPCServer(s *Server, opts ...grpc.ServerOption) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{errorUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{errorStreamInterceptor}
+	if s.auth != nil {
+		unary = append(unary, authUnaryInterceptor(s.auth))
+		stream = append(stream, authStreamInterceptor(s.auth))
+	}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	grpcServer := grpc.NewServer(opts...)
+	protos2.RegisterReaderServiceServer(grpcServer, s)
+	protos2.RegisterWriterServiceServer(grpcServer, s)
+	flight.RegisterFlightServiceServer(grpcServer, newFlightServer(s))
+	return grpcServer
+}
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, cfg); err != nil {
+		log.Fatalf("server failed: %v", err)
+	}
+}
+
+// run serves requests until ctx is done, then stops accepting new requests,
+// drains in-flight ones and finishes open transactions
+func run(ctx context.Context, cfg Config) error {
+	store := cfg.objectStorage()
+	d := deltalake.New(store, cfg.deltaOpts())
+
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		return err
+	}
+	auth, err := cfg.authenticator()
+	if err != nil {
+		return err
+	}
+	opts := make([]grpc.ServerOption, 0)
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	log.Printf("Starting server on %s", cfg.Listen)
+	lis, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
 	s := Server{
 		delta:      d,
 		objStorage: store,
-		txs:        make(map[int64]*deltalake.Transaction),
+		txs:        newTxManager(d, time.Duration(cfg.TxTimeout)),
+	}
+	if auth != nil {
+		s.auth = auth
+		s.acl = newACLStore(d, cfg.Auth.Admins, time.Duration(cfg.Auth.ACLRefresh))
+		if err := s.acl.ensureTable(); err != nil {
+			return fmt.Errorf("failed to create acl table: %w", err)
+		}
 	}
 
-	grpcServer := grpc.NewServer()
-	protos2.RegisterReaderServiceServer(grpcServer, &s)
-	protos2.RegisterWriterServiceServer(grpcServer, &s)
+	grpcServer := newGRPCServer(&s, opts...)
 	reflection.Register(grpcServer)
 
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %s", err)
+	serveErr := make(chan error, 3)
+	go func() {
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	var httpServer *http.Server
+	if cfg.HTTPListen != "" {
+		log.Printf("Starting HTTP gateway on %s", cfg.HTTPListen)
+		httpLis, err := net.Listen("tcp", cfg.HTTPListen)
+		if err != nil {
+			grpcServer.Stop()
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		httpServer = &http.Server{Handler: newHTTPHandler(&s), TLSConfig: tlsCfg}
+		go func() {
+			var err error
+			if tlsCfg != nil {
+				err = httpServer.ServeTLS(httpLis, "", "")
+			} else {
+				err = httpServer.Serve(httpLis)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
 	}
-}
 
-func (s *Server) getTx(id *int64) (*deltalake.Transaction, bool) {
-	if id == nil {
-		return s.delta.NewTransaction(), false
+	var pgSrv *pgServer
+	if cfg.PGListen != "" {
+		log.Printf("Starting PostgreSQL front-end on %s", cfg.PGListen)
+		pgLis, err := net.Listen("tcp", cfg.PGListen)
+		if err != nil {
+			grpcServer.Stop()
+			if httpServer != nil {
+				httpServer.Close()
+			}
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		pgSrv = newPGServer(&s, tlsCfg)
+		go func() {
+			if err := pgSrv.Serve(pgLis); !errors.Is(err, errPGServerClosed) {
+				serveErr <- err
+			}
+		}()
 	}
-	if tx, ok := s.txs[*id]; ok {
-		return tx, true
+
+	select {
+	case err := <-serveErr:
+		grpcServer.Stop()
+		if httpServer != nil {
+			httpServer.Close()
+		}
+		if pgSrv != nil {
+			pgSrv.Close()
+		}
+		s.txs.shutdown()
+		s.delta.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.Timeout))
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown timeout exceeded, closing remaining HTTP connections")
+			httpServer.Close()
+		}
 	}
-	return s.delta.NewTransaction(), false
+	if pgSrv != nil {
+		if err := pgSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown timeout exceeded, closing remaining PostgreSQL connections")
+		}
+	}
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		log.Printf("Shutdown timeout exceeded, closing remaining connections")
+		grpcServer.Stop()
+		<-stopped
+	}
+	s.txs.shutdown()
+	// commits of drained requests may have started compactions
+	s.delta.Close()
+	return nil
 }
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/flight/flightsql"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type testClient struct {
+	server *Server
+	reader protos2.ReaderServiceClient
+	writer protos2.WriterServiceClient
+	flight flight.Client
+	sql    *flightsql.Client
+}
+
+func newTestServer(t *testing.T, configure ...func(s *Server)) *testClient {
+	dir := path.Join(os.TempDir(), "deltalake_test", uuid.NewString())
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store := deltalake.NewFileStorage(dir)
+	d := deltalake.New(store, deltalake.DefaultOpts())
+	s := &Server{
+		delta:      d,
+		objStorage: store,
+		txs:        newTxManager(d, time.Minute),
+	}
+	t.Cleanup(s.txs.close)
+	for _, c := range configure {
+		c(s)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := newGRPCServer(s)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	fc := flight.NewClientFromConn(conn, nil)
+	return &testClient{
+		server: s,
+		reader: protos2.NewReaderServiceClient(conn),
+		writer: protos2.NewWriterServiceClient(conn),
+		flight: fc,
+		sql:    &flightsql.Client{Client: fc, Alloc: memory.DefaultAllocator},
+	}
+}
+
+func (c *testClient) scan(t *testing.T, table string) [][]any {
+	stream, err := c.reader.Scan(context.Background(), &protos2.GetRequest{Table: table})
+	require.NoError(t, err)
+	rows := make([][]any, 0)
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return rows
+		}
+		row, err := fromProtoRow(resp.Row)
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	_, err := c.writer.Create(ctx, &protos2.CreateRequest{
+		Table:  "foo",
+		Schema: []*protos2.ColumnSchema{{Name: "id", Type: protos2.ColumnType_INT64}},
+	})
+	require.NoError(t, err)
+
+	stream, err := c.writer.BulkInsert(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		row, err := toProtoRow([]any{int64(i)})
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&protos2.SetRequest{Table: "foo", Row: row}))
+	}
+	summary, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), summary.Rows)
+	assert.Equal(t, int64(100), summary.TableRows["foo"])
+	assert.True(t, summary.Committed)
+	assert.Equal(t, int64(1), summary.Version)
+
+	rows := c.scan(t, "foo")
+	assert.Len(t, rows, 100)
+	assert.Equal(t, []any{int64(99)}, rows[99])
+
+	scan, err := c.reader.Scan(ctx, &protos2.GetRequest{Table: "foo", Where: "id >= 50", Limit: 3})
+	require.NoError(t, err)
+	ids := make([]int64, 0)
+	for {
+		resp, err := scan.Recv()
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		ids = append(ids, resp.Row.Values[0].GetInt64Value())
+	}
+	assert.Equal(t, []int64{50, 51, 52}, ids)
+
+	// row after the limit fails with division by zero, it is never read
+	scan, err = c.reader.Scan(ctx, &protos2.GetRequest{Table: "foo", Where: "id >= 50 AND 100 / (52 - id) > 0", Limit: 2})
+	require.NoError(t, err)
+	ids = ids[:0]
+	for {
+		resp, err := scan.Recv()
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		ids = append(ids, resp.Row.Values[0].GetInt64Value())
+	}
+	assert.Equal(t, []int64{50, 51}, ids)
+
+	scan, err = c.reader.Scan(ctx, &protos2.GetRequest{Table: "foo", Where: "name = 1"})
+	require.NoError(t, err)
+	_, err = scan.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestErrorStatus(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	create := &protos2.CreateRequest{
+		Table:  "foo",
+		Schema: []*protos2.ColumnSchema{{Name: "id", Type: protos2.ColumnType_INT64}},
+	}
+	_, err := c.writer.Create(ctx, create)
+	require.NoError(t, err)
+
+	_, err = c.writer.Create(ctx, create)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	for _, tc := range []struct {
+		schema []*protos2.ColumnSchema
+		msg    string
+	}{
+		{[]*protos2.ColumnSchema{{Name: "id", Type: protos2.ColumnType(42)}}, "column id has unknown type 42"},
+		{[]*protos2.ColumnSchema{{Name: "id"}, {Type: protos2.ColumnType_INT64}}, "column 1 has no name"},
+		{[]*protos2.ColumnSchema{{Name: "id"}, {Name: "id", Type: protos2.ColumnType_STRING}}, "duplicate column id"},
+	} {
+		_, err = c.writer.Create(ctx, &protos2.CreateRequest{Table: "bar", Schema: tc.schema})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), tc.msg)
+		assert.Contains(t, status.Convert(err).Message(), tc.msg)
+	}
+
+	row, err := toProtoRow([]any{"x"})
+	require.NoError(t, err)
+	_, err = c.writer.Set(ctx, &protos2.SetRequest{Table: "foo", Row: row})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	invalid := &protos2.Row{Values: []*protos2.Value{
+		{Kind: &protos2.Value_TimestampValue{TimestampValue: &timestamppb.Timestamp{Nanos: -1}}},
+	}}
+	_, err = c.writer.Set(ctx, &protos2.SetRequest{Table: "foo", Row: invalid})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	stream, err := c.writer.BulkInsert(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&protos2.SetRequest{Table: "foo", Row: invalid}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.reader.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: "bar"})
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, "TABLE_NOT_FOUND", info.Reason)
+	assert.Equal(t, "bar", info.Metadata["table"])
+
+	// concurrent transactions commit the same version
+	tx1, err := c.writer.NewTransaction(ctx, &protos2.Empty{})
+	require.NoError(t, err)
+	tx2, err := c.writer.NewTransaction(ctx, &protos2.Empty{})
+	require.NoError(t, err)
+	_, err = c.writer.Commit(ctx, tx1)
+	require.NoError(t, err)
+	_, err = c.writer.Commit(ctx, tx2)
+	st = status.Convert(err)
+	assert.Equal(t, codes.Aborted, st.Code())
+	info = st.Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, "1", info.Metadata["version"])
+}
+
+func TestSubscribe(t *testing.T) {
+	c := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.writer.Create(ctx, &protos2.CreateRequest{
+		Table:  "foo",
+		Schema: []*protos2.ColumnSchema{{Name: "id", Type: protos2.ColumnType_INT64}},
+	})
+	require.NoError(t, err)
+
+	stream, err := c.reader.Subscribe(ctx, &protos2.SubscribeRequest{Table: "foo", FromVersion: 1})
+	require.NoError(t, err)
+	for i := 1; i <= 2; i++ {
+		row, err := toProtoRow([]any{int64(i)})
+		require.NoError(t, err)
+		_, err = c.writer.Set(ctx, &protos2.SetRequest{Table: "foo", Row: row})
+		require.NoError(t, err)
+
+		tv, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), tv.Version)
+		assert.NotNil(t, tv.Timestamp)
+		require.Len(t, tv.Added, 1)
+		assert.Equal(t, int64(i), tv.Added[0].Values[0].GetInt64Value())
+		assert.Empty(t, tv.Removed)
+	}
+
+	// resumed from the offset after the last received version
+	resumed, err := c.reader.Subscribe(ctx, &protos2.SubscribeRequest{Table: "foo", FromVersion: 2})
+	require.NoError(t, err)
+	tv, err := resumed.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), tv.Version)
+	assert.True(t, tv.Last)
+
+	// rows of large versions are split into several messages
+	tx := c.server.delta.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("bar", deltalake.Schema{{Name: "data", Type: deltalake.StringType}}))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, tx.Put("bar", []any{strings.Repeat("x", 400<<10)}))
+	}
+	require.NoError(t, tx.Commit())
+	large, err := c.reader.Subscribe(ctx, &protos2.SubscribeRequest{Table: "bar"})
+	require.NoError(t, err)
+	for _, offset := range []int64{0, 2} {
+		tv, err = large.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), tv.Version)
+		assert.Equal(t, offset, tv.Offset)
+		assert.Len(t, tv.Added, 2)
+		assert.Equal(t, offset == 2, tv.Last)
+	}
+
+	unknown, err := c.reader.Subscribe(ctx, &protos2.SubscribeRequest{Table: "missing"})
+	require.NoError(t, err)
+	_, err = unknown.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestBulkInsertAppTransaction(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	_, err := c.writer.Create(ctx, &protos2.CreateRequest{Table: "foo", Columns: []string{"id"}})
+	require.NoError(t, err)
+
+	insert := func(version int64) *protos2.InsertSummary {
+		stream, err := c.writer.BulkInsert(ctx)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			row, err := toProtoRow([]any{int64(i)})
+			require.NoError(t, err)
+			in := &protos2.SetRequest{Table: "foo", Row: row}
+			if i == 0 {
+				in.AppTransaction = &protos2.AppTransaction{AppId: "ingest", Version: version}
+			}
+			require.NoError(t, stream.Send(in))
+		}
+		summary, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		return summary
+	}
+	summary := insert(1)
+	assert.True(t, summary.Committed)
+	assert.False(t, summary.Duplicate)
+
+	// retried stream is not written again
+	summary = insert(1)
+	assert.False(t, summary.Committed)
+	assert.True(t, summary.Duplicate)
+	assert.Zero(t, summary.Rows)
+	assert.Len(t, c.scan(t, "foo"), 3)
+
+	row, err := toProtoRow([]any{int64(3)})
+	require.NoError(t, err)
+	resp, err := c.writer.Set(ctx, &protos2.SetRequest{Table: "foo", Row: row,
+		AppTransaction: &protos2.AppTransaction{AppId: "ingest", Version: 1}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Message)
+	assert.Len(t, c.scan(t, "foo"), 3)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/deltalake"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	_defaultTxTimeout = 5 * time.Minute
+)
+
+type txEntry struct {
+	id    int64
+	owner string     // principal which started the transaction
+	mu    sync.Mutex // serializes requests using the transaction
+	tx    *deltalake.Transaction
+
+	tables map[string]bool // tables modified in the transaction, guarded by mu
+
+	expiresAt time.Time // guarded by txManager.mu
+}
+
+// txManager keeps transactions opened with NewTransaction. Every transaction
+// holds a lease extended by each request, transactions whose lease expired are
+// rolled back.
+type txManager struct {
+	delta   deltalake.DeltaStorage
+	timeout time.Duration
+
+	mu     sync.Mutex
+	nextId int64
+	txs    map[int64]*txEntry
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newTxManager(d deltalake.DeltaStorage, timeout time.Duration) *txManager {
+	if timeout <= 0 {
+		timeout = _defaultTxTimeout
+	}
+	m := &txManager{
+		delta:   d,
+		timeout: timeout,
+		txs:     make(map[int64]*txEntry),
+		stop:    make(chan struct{}),
+	}
+	m.wg.Add(1)
+	go m.reapLoop()
+	return m
+}
+
+func errTxNotFound(id int64) error {
+	return status.Errorf(codes.NotFound, "transaction %d not found", id)
+}
+
+// begin registers a new transaction, ids are assigned by the manager since
+// concurrent transactions share the version they are going to commit
+func (m *txManager) begin(owner string) (int64, time.Time) {
+	tx := m.delta.NewTransaction()
+	if owner != "" {
+		// commits are attributed to the principal
+		tx.SetClientId(owner)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	e := &txEntry{
+		id:        m.nextId,
+		owner:     owner,
+		tx:        tx,
+		tables:    make(map[string]bool),
+		expiresAt: time.Now().Add(m.timeout),
+	}
+	m.txs[e.id] = e
+	return e.id, e.expiresAt
+}
+
+// acquire locks the registered transaction and extends its lease
+func (m *txManager) acquire(id int64) (*txEntry, error) {
+	m.mu.Lock()
+	e, ok := m.txs[id]
+	if ok {
+		e.expiresAt = time.Now().Add(m.timeout)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil, errTxNotFound(id)
+	}
+	e.mu.Lock()
+	// transaction could be finished while waiting for the lock
+	m.mu.Lock()
+	_, ok = m.txs[id]
+	m.mu.Unlock()
+	if !ok {
+		e.mu.Unlock()
+		return nil, errTxNotFound(id)
+	}
+	return e, nil
+}
+
+func (m *txManager) release(e *txEntry) {
+	m.mu.Lock()
+	e.expiresAt = time.Now().Add(m.timeout)
+	m.mu.Unlock()
+	e.mu.Unlock()
+}
+
+// remove unregisters the transaction if check passes, returned entry is locked
+func (m *txManager) remove(id int64, check func(e *txEntry) error) (*txEntry, error) {
+	e, err := m.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(e); err != nil {
+			m.release(e)
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	delete(m.txs, id)
+	m.mu.Unlock()
+	return e, nil
+}
+
+func (m *txManager) keepAlive(id int64, check func(e *txEntry) error) (time.Time, error) {
+	e, err := m.acquire(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if check != nil {
+		if err := check(e); err != nil {
+			m.release(e)
+			return time.Time{}, err
+		}
+	}
+	// lease is extended on release
+	m.release(e)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return e.expiresAt, nil
+}
+
+// commit commits the transaction if check passes, check is called with the
+// transaction locked
+func (m *txManager) commit(id int64, check func(e *txEntry) error) error {
+	e, err := m.remove(id, check)
+	if err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	if err := e.tx.Commit(); err != nil {
+		// failed transaction stays open
+		e.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+func (m *txManager) rollback(id int64, check func(e *txEntry) error) error {
+	e, err := m.remove(id, check)
+	if err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+	return e.tx.Rollback()
+}
+
+func (m *txManager) reapLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.reap(time.Now())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// reap rolls back expired transactions not used by any request
+func (m *txManager) reap(now time.Time) {
+	m.mu.Lock()
+	expired := make([]*txEntry, 0)
+	for id, e := range m.txs {
+		if now.Before(e.expiresAt) || !e.mu.TryLock() {
+			continue
+		}
+		delete(m.txs, id)
+		expired = append(expired, e)
+	}
+	m.mu.Unlock()
+
+	for _, e := range expired {
+		slog.Info("transaction lease expired, rolling back", slog.Int64("id", e.id))
+		if err := e.tx.Rollback(); err != nil {
+			slog.Error("error while rolling back expired transaction", slog.Int64("id", e.id), slog.Any("error", err))
+		}
+		e.mu.Unlock()
+	}
+}
+
+func (m *txManager) close() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// shutdown stops the manager and rolls back all open transactions. They are
+// not committed: transactions opened on the same version conflict, only the
+// first commit would succeed.
+func (m *txManager) shutdown() {
+	m.close()
+
+	m.mu.Lock()
+	ids := slices.Sorted(maps.Keys(m.txs))
+	m.mu.Unlock()
+
+	for _, id := range ids {
+		if err := m.rollback(id, nil); err != nil {
+			slog.Error("error while rolling back transaction on shutdown", slog.Int64("id", id), slog.Any("error", err))
+		}
+	}
+}
+
+// txHandle is a transaction used by a single request. Requests without
+// transaction id get a transaction used only by them.
+type txHandle struct {
+	tx    *deltalake.Transaction
+	entry *txEntry
+	m     *txManager
+}
+
+func (m *txManager) open(id *int64) (*txHandle, error) {
+	if id == nil {
+		return &txHandle{tx: m.delta.NewTransaction(), m: m}, nil
+	}
+	e, err := m.acquire(*id)
+	if err != nil {
+		return nil, err
+	}
+	return &txHandle{tx: e.tx, entry: e, m: m}, nil
+}
+
+// touch records table modified by the request
+func (h *txHandle) touch(table string) {
+	if h.entry != nil {
+		h.entry.tables[table] = true
+	}
+}
+
+// commit commits single-use transaction, registered transactions are only
+// released and committed with Commit RPC
+func (h *txHandle) commit() (committed bool, version int64, err error) {
+	if h.entry != nil {
+		h.m.release(h.entry)
+		return false, 0, nil
+	}
+	version, err = h.tx.CommitVersion()
+	if err != nil {
+		h.tx.Rollback()
+		return false, 0, err
+	}
+	return true, version, nil
+}
+
+// rollback discards single-use transaction, registered transactions are only
+// released
+func (h *txHandle) rollback() error {
+	if h.entry != nil {
+		h.m.release(h.entry)
+		return nil
+	}
+	return h.tx.Rollback()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTxManagerExpiry(t *testing.T) {
+	c := newTestServer(t)
+	m := c.server.txs
+
+	id, expiresAt := m.begin("")
+	other, _ := m.begin("")
+	assert.NotEqual(t, id, other)
+
+	// transaction in use is not rolled back
+	e, err := m.acquire(other)
+	require.NoError(t, err)
+	m.reap(expiresAt.Add(time.Second))
+	m.release(e)
+
+	_, err = m.keepAlive(id, nil)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = m.keepAlive(other, nil)
+	assert.NoError(t, err)
+}
+
+func TestTransactionRPCs(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := c.writer.Commit(ctx, &protos2.Transaction{TxId: 42})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	unknown := int64(42)
+	_, err = c.writer.Create(ctx, &protos2.CreateRequest{TxId: &unknown, Table: "foo", Columns: []string{"a"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	tx, err := c.writer.NewTransaction(ctx, &protos2.Empty{})
+	require.NoError(t, err)
+	_, err = c.writer.Create(ctx, &protos2.CreateRequest{TxId: &tx.TxId, Table: "foo", Columns: []string{"a"}})
+	require.NoError(t, err)
+	lease, err := c.writer.KeepAlive(ctx, tx)
+	require.NoError(t, err)
+	assert.True(t, lease.ExpiresAt.AsTime().After(time.Now()))
+	_, err = c.writer.Rollback(ctx, tx)
+	require.NoError(t, err)
+	_, err = c.writer.Commit(ctx, tx)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.reader.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: "foo"})
+	assert.Error(t, err)
+
+	tx, err = c.writer.NewTransaction(ctx, &protos2.Empty{})
+	require.NoError(t, err)
+	_, err = c.writer.Create(ctx, &protos2.CreateRequest{TxId: &tx.TxId, Table: "foo", Columns: []string{"a"}})
+	require.NoError(t, err)
+	row, err := toProtoRow([]any{"x"})
+	require.NoError(t, err)
+	_, err = c.writer.Set(ctx, &protos2.SetRequest{TxId: &tx.TxId, Table: "foo", Row: row})
+	require.NoError(t, err)
+	_, err = c.writer.Commit(ctx, tx)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"x"}}, c.scan(t, "foo"))
+}
+
+func TestTxManagerShutdown(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	m := newTxManager(c.server.delta, time.Minute)
+
+	for _, table := range []string{"foo", "bar"} {
+		id, _ := m.begin("")
+		e, err := m.acquire(id)
+		require.NoError(t, err)
+		require.NoError(t, e.tx.Create(table, []string{"a"}))
+		m.release(e)
+	}
+	m.shutdown()
+
+	// open transactions are rolled back
+	for _, table := range []string{"foo", "bar"} {
+		_, err := c.reader.DescribeTable(ctx, &protos2.DescribeTableRequest{Table: table})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	assert.Empty(t, m.txs)
+}
+
+func TestCommitVersionAfterCompaction(t *testing.T) {
+	c := newTestServer(t, func(s *Server) {
+		opts := deltalake.DefaultOpts()
+		opts.AutoCompactMinFiles = 1
+		s.delta = deltalake.New(s.objStorage, opts)
+		s.txs = newTxManager(s.delta, time.Minute)
+	})
+	d := c.server.delta
+	tx := d.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", deltalake.Schema{{Name: "id", Type: deltalake.Int64Type}}))
+	require.NoError(t, tx.SetTableProperty("foo", deltalake.PropertyAutoCompact, "true"))
+	require.NoError(t, tx.Commit())
+	lastOperation := func() string {
+		history, err := d.History("foo", 1)
+		require.NoError(t, err)
+		return history[0].Operation
+	}
+
+	raced := false
+	for i := 0; i < 5; i++ {
+		// the second small data object starts compaction in the background
+		for j := 0; j < 2; j++ {
+			tx := d.NewTransaction()
+			require.NoError(t, tx.Put("foo", []any{int64(j)}))
+			require.NoError(t, tx.Commit())
+		}
+		h, err := c.server.txs.open(nil)
+		require.NoError(t, err)
+		snapshot := h.tx.GetId()
+		require.NoError(t, h.tx.Put("foo", []any{int64(i)}))
+		require.Eventually(t, func() bool { return lastOperation() == "OPTIMIZE" }, time.Second, time.Millisecond)
+
+		committed, version, err := h.commit()
+		require.NoError(t, err)
+		assert.True(t, committed)
+		history, err := d.History("foo", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "WRITE", history[0].Operation)
+		assert.Equal(t, history[0].Version, version)
+		raced = raced || version > snapshot
+	}
+	// the transaction was committed after the compaction at least once
+	assert.True(t, raced)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deltalake"
+	protos2 "github.com/deltalake/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// values are converted to plain go types, conversion to the column types is
+// done by the transaction using the table schema
+
+func toProtoValue(v any) (*protos2.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return &protos2.Value{Kind: &protos2.Value_NullValue{}}, nil
+	case bool:
+		return &protos2.Value{Kind: &protos2.Value_BoolValue{BoolValue: v}}, nil
+	case int:
+		return &protos2.Value{Kind: &protos2.Value_Int64Value{Int64Value: int64(v)}}, nil
+	case int64:
+		return &protos2.Value{Kind: &protos2.Value_Int64Value{Int64Value: v}}, nil
+	case float64:
+		return &protos2.Value{Kind: &protos2.Value_DoubleValue{DoubleValue: v}}, nil
+	case string:
+		return &protos2.Value{Kind: &protos2.Value_StringValue{StringValue: v}}, nil
+	case []byte:
+		return &protos2.Value{Kind: &protos2.Value_BytesValue{BytesValue: v}}, nil
+	case time.Time:
+		return &protos2.Value{Kind: &protos2.Value_TimestampValue{TimestampValue: timestamppb.New(v)}}, nil
+	case deltalake.Decimal:
+		return &protos2.Value{Kind: &protos2.Value_DecimalValue{DecimalValue: &protos2.Decimal{Value: string(v)}}}, nil
+	case []any:
+		values := make([]*protos2.Value, len(v))
+		for i, e := range v {
+			pv, err := toProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = pv
+		}
+		return &protos2.Value{Kind: &protos2.Value_ListValue{ListValue: &protos2.ListValue{Values: values}}}, nil
+	case map[string]any:
+		fields := make(map[string]*protos2.Value, len(v))
+		for k, e := range v {
+			pv, err := toProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = pv
+		}
+		return &protos2.Value{Kind: &protos2.Value_StructValue{StructValue: &protos2.StructValue{Fields: fields}}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func fromProtoValue(v *protos2.Value) (any, error) {
+	switch k := v.GetKind().(type) {
+	case nil, *protos2.Value_NullValue:
+		return nil, nil
+	case *protos2.Value_BoolValue:
+		return k.BoolValue, nil
+	case *protos2.Value_Int64Value:
+		return k.Int64Value, nil
+	case *protos2.Value_DoubleValue:
+		return k.DoubleValue, nil
+	case *protos2.Value_StringValue:
+		return k.StringValue, nil
+	case *protos2.Value_BytesValue:
+		return k.BytesValue, nil
+	case *protos2.Value_TimestampValue:
+		if err := k.TimestampValue.CheckValid(); err != nil {
+			return nil, err
+		}
+		return k.TimestampValue.AsTime(), nil
+	case *protos2.Value_DecimalValue:
+		return deltalake.Decimal(k.DecimalValue.GetValue()), nil
+	case *protos2.Value_ListValue:
+		res := make([]any, len(k.ListValue.GetValues()))
+		for i, e := range k.ListValue.GetValues() {
+			val, err := fromProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+		return res, nil
+	case *protos2.Value_StructValue:
+		res := make(map[string]any, len(k.StructValue.GetFields()))
+		for name, e := range k.StructValue.GetFields() {
+			val, err := fromProtoValue(e)
+			if err != nil {
+				return nil, err
+			}
+			res[name] = val
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported value kind %T", k)
+	}
+}
+
+func toProtoRow(values []any) (*protos2.Row, error) {
+	row := &protos2.Row{Values: make([]*protos2.Value, len(values))}
+	for i, v := range values {
+		pv, err := toProtoValue(v)
+		if err != nil {
+			return nil, err
+		}
+		row.Values[i] = pv
+	}
+	return row, nil
+}
+
+func toProtoRows(rows [][]any) ([]*protos2.Row, error) {
+	res := make([]*protos2.Row, len(rows))
+	for i, v := range rows {
+		row, err := toProtoRow(v)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = row
+	}
+	return res, nil
+}
+
+// fromProtoRow converts row of a request, invalid values are reported as
+// InvalidArgument like the values not matching the table schema
+func fromProtoRow(row *protos2.Row) ([]any, error) {
+	res := make([]any, len(row.GetValues()))
+	for i, v := range row.GetValues() {
+		val, err := fromProtoValue(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid row: value %d: %v", i, err)
+		}
+		res[i] = val
+	}
+	return res, nil
+}
+
+// column types share numbering between deltalake and protos
+func toProtoSchema(table string, schema deltalake.Schema) *protos2.TableSchema {
+	res := &protos2.TableSchema{
+		Table:   table,
+		Columns: make([]*protos2.ColumnSchema, len(schema)),
+	}
+	for i, c := range schema {
+		res.Columns[i] = &protos2.ColumnSchema{
+			Name: c.Name,
+			Type: protos2.ColumnType(c.Type),
+		}
+	}
+	return res
+}
+
+// fromProtoSchema converts schema of a request, unknown types and empty or
+// duplicate column names are reported as InvalidArgument
+func fromProtoSchema(columns []*protos2.ColumnSchema) (deltalake.Schema, error) {
+	res := make(deltalake.Schema, len(columns))
+	seen := make(map[string]bool, len(columns))
+	for i, c := range columns {
+		name := c.GetName()
+		switch {
+		case name == "":
+			return nil, status.Errorf(codes.InvalidArgument, "invalid schema: column %d has no name", i)
+		case seen[name]:
+			return nil, status.Errorf(codes.InvalidArgument, "invalid schema: duplicate column %s", name)
+		}
+		if _, ok := protos2.ColumnType_name[int32(c.GetType())]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid schema: column %s has unknown type %d", name, c.GetType())
+		}
+		seen[name] = true
+		res[i] = deltalake.Column{
+			Name: name,
+			Type: deltalake.ColumnType(c.GetType()),
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deltalake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtoRowRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 10, 1, 12, 30, 0, 0, time.UTC)
+	values := []any{
+		nil, true, int64(1), 1.5, "foo", []byte("bar"), ts, deltalake.Decimal("10.01"),
+		[]any{int64(1), "a"},
+		map[string]any{"k": []any{nil}},
+	}
+	row, err := toProtoRow(values)
+	assert.NoError(t, err)
+	got, err := fromProtoRow(row)
+	assert.NoError(t, err)
+	assert.Equal(t, values, got)
+
+	_, err = toProtoRow([]any{struct{}{}})
+	assert.Error(t, err)
+}
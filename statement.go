@@ -0,0 +1,405 @@
+package deltalake
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StatementKind is the kind of statement returned by ParseStatements
+type StatementKind int
+
+const (
+	EmptyStatement StatementKind = iota
+	SelectStatement
+	InsertStatement
+	BeginStatement
+	CommitStatement
+	RollbackStatement
+	// SetStatement is accepted and ignored, drivers set session parameters
+	// on connect
+	SetStatement
+)
+
+// Statement is a statement of SQL text run by front-ends speaking SQL. SELECT
+// runs with Query using the statement Text, values of INSERT are returned by
+// InsertRows.
+type Statement struct {
+	Kind   StatementKind
+	Text   string // without the terminating semicolon
+	Table  string // table of INSERT
+	Params int    // highest placeholder number, $n parameters are 1-based
+
+	query   *selectQuery
+	columns []string // inserted columns, nil when values are given for all
+	rows    [][]expr
+}
+
+// ParseStatements parses statements separated with semicolons:
+//
+//	SELECT ... (see Query)
+//	INSERT INTO table [(col [, col...])] VALUES (expr [, expr...]) [, (...)]
+//	BEGIN | START TRANSACTION, COMMIT | END, ROLLBACK | ABORT, SET ...
+//
+// Empty statements between semicolons are skipped.
+func ParseStatements(text string) ([]*Statement, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	stmts := make([]*Statement, 0)
+	start := 0
+	for i, t := range tokens {
+		if !t.is(";") && t.kind != _sqlEOF {
+			continue
+		}
+		if i > start {
+			segment := append(slices.Clip(tokens[start:i]), sqlToken{kind: _sqlEOF, pos: t.pos})
+			st, err := parseStatement(segment)
+			if err != nil {
+				return nil, err
+			}
+			st.Text = strings.TrimSpace(string(runes[tokens[start].pos:t.pos]))
+			stmts = append(stmts, st)
+		}
+		start = i + 1
+	}
+	return stmts, nil
+}
+
+func parseStatement(tokens []sqlToken) (*Statement, error) {
+	p := &queryParser{tokens: tokens}
+	st := &Statement{}
+	var err error
+	first := p.peek()
+	switch {
+	case first.is("SELECT"):
+		st.Kind = SelectStatement
+		st.query, err = p.parseSelect()
+	case first.is("INSERT"):
+		st.Kind = InsertStatement
+		p.advance()
+		err = p.parseInsert(st)
+	case first.is("BEGIN"):
+		st.Kind = BeginStatement
+		p.advance()
+		p.accept("TRANSACTION")
+		p.accept("WORK")
+	case first.is("START"):
+		st.Kind = BeginStatement
+		p.advance()
+		err = p.expect("TRANSACTION")
+	case first.is("COMMIT"), first.is("END"):
+		st.Kind = CommitStatement
+		p.advance()
+		p.accept("TRANSACTION")
+		p.accept("WORK")
+	case first.is("ROLLBACK"), first.is("ABORT"):
+		st.Kind = RollbackStatement
+		p.advance()
+		p.accept("TRANSACTION")
+		p.accept("WORK")
+	case first.is("SET"):
+		st.Kind = SetStatement
+		p.pos = len(p.tokens) - 1
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedStatement, first)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != _sqlEOF {
+		return nil, syntaxError(t.pos, "unexpected %s", t)
+	}
+	st.Params = st.countParams()
+	return st, nil
+}
+
+func (p *queryParser) parseInsert(st *Statement) error {
+	if err := p.expect("INTO"); err != nil {
+		return err
+	}
+	var err error
+	if st.Table, err = p.parseIdent(); err != nil {
+		return err
+	}
+	if p.accept("(") {
+		for {
+			col, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			st.columns = append(st.columns, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("VALUES"); err != nil {
+		return err
+	}
+	for {
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		row := make([]expr, 0)
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return err
+			}
+			row = append(row, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return err
+		}
+		st.rows = append(st.rows, row)
+		if !p.accept(",") {
+			return nil
+		}
+	}
+}
+
+// exprs returns the expressions of the statement
+func (st *Statement) exprs() []expr {
+	res := make([]expr, 0)
+	for _, row := range st.rows {
+		res = append(res, row...)
+	}
+	if q := st.query; q != nil {
+		for _, item := range q.items {
+			res = append(res, item.expr)
+		}
+		for _, j := range q.joins {
+			res = append(res, j.on)
+		}
+		res = append(res, q.where, q.having)
+		res = append(res, q.groupBy...)
+		for _, o := range q.orderBy {
+			res = append(res, o.expr)
+		}
+	}
+	return res
+}
+
+func (st *Statement) countParams() int {
+	n := 0
+	for _, e := range st.exprs() {
+		walk(e, func(e expr) {
+			if p, ok := e.(*paramExpr); ok {
+				n = max(n, p.n)
+			}
+		})
+	}
+	return n
+}
+
+// ParamTypes returns types of the statement parameters inferred from the
+// columns they are compared with or inserted into, other parameters are
+// AnyType
+func (tx *Transaction) ParamTypes(st *Statement) ([]ColumnType, error) {
+	types := make([]ColumnType, st.Params)
+	for i := range types {
+		types[i] = AnyType
+	}
+	switch st.Kind {
+	case SelectStatement:
+		sc := make(scope, 0)
+		refs := make([]tableRef, 0)
+		if st.query.from != nil {
+			refs = append(refs, *st.query.from)
+		}
+		for _, j := range st.query.joins {
+			refs = append(refs, j.table)
+		}
+		for _, ref := range refs {
+			t, ok := tx.tables[ref.name]
+			if !ok {
+				return nil, tableError(ref.name, ErrTableNotFound)
+			}
+			for _, c := range t.schema {
+				sc = append(sc, scopeColumn{table: ref.alias, name: c.Name, typ: c.Type})
+			}
+		}
+		for _, e := range st.exprs() {
+			walk(e, func(e expr) {
+				b, ok := e.(*binaryExpr)
+				if !ok {
+					return
+				}
+				c, p, ok := paramComparison(b)
+				if !ok {
+					return
+				}
+				// unknown columns are reported by the query
+				if idx, err := sc.resolve(c); err == nil {
+					types[p.n-1] = sc[idx].typ
+				}
+			})
+		}
+	case InsertStatement:
+		t, cols, err := tx.insertColumns(st)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range st.rows {
+			for i, e := range row {
+				if p, ok := e.(*paramExpr); ok && i < len(cols) {
+					types[p.n-1] = t.schema[cols[i]].Type
+				}
+			}
+		}
+	}
+	return types, nil
+}
+
+// paramComparison matches column compared with a placeholder
+func paramComparison(e *binaryExpr) (*columnExpr, *paramExpr, bool) {
+	switch e.op {
+	case "=", "<>", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, nil, false
+	}
+	if c, ok := e.left.(*columnExpr); ok {
+		if p, ok := e.right.(*paramExpr); ok {
+			return c, p, true
+		}
+	}
+	if c, ok := e.right.(*columnExpr); ok {
+		if p, ok := e.left.(*paramExpr); ok {
+			return c, p, true
+		}
+	}
+	return nil, nil, false
+}
+
+// insertColumns returns positions of the inserted columns in the table
+func (tx *Transaction) insertColumns(st *Statement) (*table, []int, error) {
+	t, ok := tx.tables[st.Table]
+	if !ok {
+		return nil, nil, tableError(st.Table, ErrTableNotFound)
+	}
+	if st.columns == nil {
+		cols := make([]int, len(t.schema))
+		for i := range cols {
+			cols[i] = i
+		}
+		return t, cols, nil
+	}
+	cols := make([]int, len(st.columns))
+	for i, name := range st.columns {
+		cols[i] = slices.IndexFunc(t.schema, func(c Column) bool { return c.Name == name })
+		if cols[i] < 0 {
+			return nil, nil, tableError(st.Table, fmt.Errorf("%w %s", ErrUnknownColumn, name))
+		}
+	}
+	return t, cols, nil
+}
+
+// InsertRows evaluates values of INSERT statement with placeholders replaced
+// by args and converts them to the column types, missing columns are null.
+// Text is converted the way SQL literals are written, see sqlValue.
+func (tx *Transaction) InsertRows(st *Statement, args ...any) ([][]any, error) {
+	if st.Kind != InsertStatement {
+		return nil, fmt.Errorf("%w: not an INSERT statement", ErrInvalidQuery)
+	}
+	t, cols, err := tx.insertColumns(st)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]any, len(st.rows))
+	for i, values := range st.rows {
+		if len(values) > len(cols) {
+			return nil, fmt.Errorf("%w: INSERT has more expressions than target columns", ErrSyntax)
+		}
+		row := make([]any, len(t.schema))
+		for j, e := range values {
+			if e, err = bindExpr(e, args); err != nil {
+				return nil, err
+			}
+			eval, err := (&compiler{}).compile(e)
+			if err != nil {
+				return nil, err
+			}
+			v, err := eval(nil)
+			if err != nil {
+				return nil, err
+			}
+			col := t.schema[cols[j]]
+			if row[cols[j]], err = sqlValue(col.Type, v); err != nil {
+				return nil, tableError(st.Table, fmt.Errorf("%w: column %s: %v", ErrSchemaMismatch, col.Name, err))
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// sqlValue converts value of SQL expression to the column type. Text is
+// parsed for other types: bytes as \x hex or raw text, timestamps with space
+// separator, lists and structs as json. Numbers can be assigned to string
+// columns. Untyped columns keep the value.
+func sqlValue(t ColumnType, v any) (any, error) {
+	if v == nil || t == AnyType {
+		return v, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		// numbers are assigned to decimal and string columns as their text
+		switch n := v.(type) {
+		case int64:
+			s = strconv.FormatInt(n, 10)
+		case float64:
+			s = strconv.FormatFloat(n, 'f', -1, 64)
+		case Decimal:
+			s = string(n)
+		default:
+			return coerceValue(t, v)
+		}
+		if t != DecimalType && t != StringType {
+			return coerceValue(t, v)
+		}
+	}
+	switch t {
+	case BoolType:
+		return strconv.ParseBool(s)
+	case Int64Type:
+		return strconv.ParseInt(s, 10, 64)
+	case DoubleType:
+		return strconv.ParseFloat(s, 64)
+	case BytesType:
+		if raw, ok := strings.CutPrefix(s, `\x`); ok {
+			return hex.DecodeString(raw)
+		}
+		return []byte(s), nil
+	case TimestampType:
+		ts, err := parseTimestamp(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return ts.UTC(), nil
+	case DecimalType:
+		if _, ok := new(big.Rat).SetString(s); !ok {
+			return nil, fmt.Errorf("invalid decimal %q", s)
+		}
+		return Decimal(s), nil
+	case ListType, StructType:
+		var res any
+		if err := json.Unmarshal([]byte(s), &res); err != nil {
+			return nil, err
+		}
+		return coerceValue(t, res)
+	}
+	return coerceValue(t, s)
+}
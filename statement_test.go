@@ -0,0 +1,90 @@
+package deltalake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatements(t *testing.T) {
+	stmts, err := ParseStatements("begin; SELECT * FROM foo WHERE id = $2;; insert into foo (id) values ($1, -2), (3); SET x = 1; commit work")
+	require.NoError(t, err)
+	kinds := make([]StatementKind, len(stmts))
+	for i, st := range stmts {
+		kinds[i] = st.Kind
+	}
+	assert.Equal(t, []StatementKind{BeginStatement, SelectStatement, InsertStatement, SetStatement, CommitStatement}, kinds)
+	assert.Equal(t, "SELECT * FROM foo WHERE id = $2", stmts[1].Text)
+	assert.Equal(t, 2, stmts[1].Params)
+	assert.Equal(t, "foo", stmts[2].Table)
+	assert.Equal(t, 1, stmts[2].Params)
+
+	stmts, err = ParseStatements(" ; ")
+	require.NoError(t, err)
+	assert.Empty(t, stmts)
+
+	for text, want := range map[string]error{
+		"UPDATE foo SET id = 1":       ErrUnsupportedStatement,
+		"SELECT * FROM foo WHERE":     ErrSyntax,
+		"INSERT INTO foo VALUES (1":   ErrSyntax,
+		"START foo":                   ErrSyntax,
+		"SELECT 1; SELECT 'x":         ErrSyntax,
+		"INSERT INTO foo (id) VALUES": ErrSyntax,
+	} {
+		_, err := ParseStatements(text)
+		assert.ErrorIs(t, err, want, text)
+	}
+}
+
+func TestInsertStatement(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{
+		{Name: "id", Type: Int64Type},
+		{Name: "price", Type: DecimalType},
+		{Name: "at", Type: TimestampType},
+		{Name: "data", Type: BytesType},
+		{Name: "tags", Type: ListType},
+		{Name: "x", Type: AnyType},
+	}))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+
+	stmts, err := ParseStatements(`INSERT INTO foo VALUES ($1, 1.5, '2024-01-02 03:04:05', '\x0102', '["a"]', $2), (-1, $3, NULL, 'ab', NULL, 2 * 3)`)
+	require.NoError(t, err)
+	st := stmts[0]
+	types, err := tx.ParamTypes(st)
+	require.NoError(t, err)
+	assert.Equal(t, []ColumnType{Int64Type, AnyType, DecimalType}, types)
+	rows, err := tx.InsertRows(st, "7", "x", Decimal("-2"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{
+		{int64(7), Decimal("1.5"), time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []byte{1, 2}, []any{"a"}, "x"},
+		{int64(-1), Decimal("-2"), nil, []byte("ab"), nil, int64(6)},
+	}, rows)
+
+	stmts, err = ParseStatements("SELECT * FROM foo f WHERE $1 < f.id AND price = $2 OR x = $3")
+	require.NoError(t, err)
+	types, err = tx.ParamTypes(stmts[0])
+	require.NoError(t, err)
+	assert.Equal(t, []ColumnType{Int64Type, DecimalType, AnyType}, types)
+
+	for text, want := range map[string]error{
+		"INSERT INTO foo (id) VALUES ('x')":   ErrSchemaMismatch,
+		"INSERT INTO foo (id) VALUES (1, 2)":  ErrSyntax,
+		"INSERT INTO foo (bar) VALUES (1)":    ErrUnknownColumn,
+		"INSERT INTO missing VALUES (1)":      ErrTableNotFound,
+		"INSERT INTO foo (id) VALUES ($1)":    ErrInvalidQuery,
+		"INSERT INTO foo (id) VALUES (1 / 0)": ErrInvalidQuery,
+	} {
+		stmts, err := ParseStatements(text)
+		require.NoError(t, err, text)
+		_, err = tx.InsertRows(stmts[0])
+		assert.ErrorIs(t, err, want, text)
+	}
+}
@@ -0,0 +1,179 @@
+package deltalake
+
+import (
+	"math"
+	"time"
+)
+
+// fileStats summarize values of a data object so scans can skip files which
+// can't contain matching rows
+type fileStats struct {
+	NumRecords int64
+	Size       int64                   `json:",omitempty"` // bytes of the persisted object
+	Columns    map[string]*columnStats `json:",omitempty"` // missing column has no stats
+}
+
+// columnStats are bounds of non-null values of the column, both are nil when
+// all values are null
+type columnStats struct {
+	Min       any `json:",omitempty"`
+	Max       any `json:",omitempty"`
+	NullCount int64
+}
+
+// collectStats computes bounds of the columns, columns with values which
+// can't be ordered or kept in json are left out
+func collectStats(schema Schema, rows [][]any) *fileStats {
+	fs := &fileStats{
+		NumRecords: int64(len(rows)),
+		Columns:    make(map[string]*columnStats, len(schema)),
+	}
+	for i, c := range schema {
+		cs := &columnStats{}
+		ok := true
+		for _, row := range rows {
+			if i >= len(row) || row[i] == nil {
+				cs.NullCount++
+				continue
+			}
+			v, exact := statValue(c.Type, row[i])
+			if !exact {
+				ok = false
+				break
+			}
+			if cs.Min == nil {
+				cs.Min, cs.Max = v, v
+				continue
+			}
+			lo, err := compareValues(v, cs.Min)
+			if err != nil {
+				ok = false
+				break
+			}
+			hi, _ := compareValues(v, cs.Max)
+			if lo < 0 {
+				cs.Min = v
+			}
+			if hi > 0 {
+				cs.Max = v
+			}
+		}
+		if ok {
+			fs.Columns[c.Name] = cs
+		}
+	}
+	return fs
+}
+
+// statValue returns the value kept in stats, values of untyped columns are
+// read back as decoded from json so only json types are ordered the same way
+// as the rows
+func statValue(t ColumnType, v any) (any, bool) {
+	v = normalizeValue(v)
+	if t == AnyType {
+		switch v.(type) {
+		case Decimal, time.Time:
+			return nil, false
+		}
+	}
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case float64:
+		return x, !math.IsInf(x, 0) && !math.IsNaN(x)
+	case string, bool, Decimal:
+		return x, true
+	case time.Time:
+		return x.UTC(), true
+	default:
+		return nil, false
+	}
+}
+
+// statsPredicate is a condition on single column compared with a constant,
+// op is a comparison operator, IS NULL or IS NOT NULL
+type statsPredicate struct {
+	column string
+	op     string
+	value  any
+}
+
+// mayMatch reports whether rows of the file can satisfy the predicate, bounds
+// decoded from json with numbers kept as json.Number are converted to the
+// column type first
+func (fs *fileStats) mayMatch(schema Schema, p statsPredicate) bool {
+	cs, ok := fs.Columns[p.column]
+	if !ok {
+		return true
+	}
+	switch p.op {
+	case "IS NULL":
+		return cs.NullCount > 0
+	case "IS NOT NULL":
+		return cs.NullCount < fs.NumRecords
+	}
+	if cs.NullCount == fs.NumRecords {
+		// comparison with null is never true
+		return false
+	}
+	if p.value == nil {
+		return false
+	}
+	typ := AnyType
+	for _, c := range schema {
+		if c.Name == p.column {
+			typ = c.Type
+		}
+	}
+	lo, errLo := coerceValue(typ, decodeNumbers(typ, cs.Min))
+	hi, errHi := coerceValue(typ, decodeNumbers(typ, cs.Max))
+	if errLo != nil || errHi != nil {
+		return true
+	}
+	cmpLo, errLo := compareValues(p.value, lo)
+	cmpHi, errHi := compareValues(p.value, hi)
+	if errLo != nil || errHi != nil {
+		return true
+	}
+	switch p.op {
+	case "=":
+		return cmpLo >= 0 && cmpHi <= 0
+	case "<>":
+		return cmpLo != 0 || cmpHi != 0
+	case "<":
+		return cmpLo > 0
+	case "<=":
+		return cmpLo >= 0
+	case ">":
+		return cmpHi < 0
+	case ">=":
+		return cmpHi <= 0
+	default:
+		return true
+	}
+}
+
+// prune returns the table reading only files which may contain rows matching
+// all predicates, files without stats are always read
+func (t *table) prune(preds []statsPredicate) *table {
+	if len(preds) == 0 {
+		return t
+	}
+	files := make([]string, 0, len(t.files))
+	for _, f := range t.files {
+		fs, ok := t.stats[f]
+		match := true
+		for _, p := range preds {
+			if ok && !fs.mayMatch(t.schema, p) {
+				match = false
+				break
+			}
+		}
+		if match {
+			files = append(files, f)
+		}
+	}
+	pruned := *t
+	pruned.files = files
+	return &pruned
+}
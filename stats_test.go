@@ -0,0 +1,106 @@
+package deltalake
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectStats(t *testing.T) {
+	schema := Schema{
+		{Name: "id", Type: Int64Type},
+		{Name: "ts", Type: TimestampType},
+		{Name: "any", Type: AnyType},
+		{Name: "big", Type: Int64Type},
+		{Name: "list", Type: ListType},
+	}
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs := collectStats(schema, [][]any{
+		{int64(3), ts, "b", int64(1), []any{1}},
+		{int64(-2), nil, "a", int64(1 << 60), nil},
+		{nil, ts.Add(time.Hour), nil, int64(2), nil},
+	})
+	assert.EqualValues(t, 3, fs.NumRecords)
+	assert.Equal(t, &columnStats{Min: int64(-2), Max: int64(3), NullCount: 1}, fs.Columns["id"])
+	assert.Equal(t, &columnStats{Min: ts, Max: ts.Add(time.Hour), NullCount: 1}, fs.Columns["ts"])
+	assert.Equal(t, &columnStats{Min: "a", Max: "b", NullCount: 1}, fs.Columns["any"])
+	assert.Equal(t, &columnStats{Min: int64(1), Max: int64(1 << 60), NullCount: 0}, fs.Columns["big"])
+	assert.NotContains(t, fs.Columns, "list")
+
+	// bounds are converted back to the column type after reading the log
+	raw, err := json.Marshal(fs)
+	require.NoError(t, err)
+	decoded := &fileStats{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(decoded))
+	for _, tc := range []struct {
+		p        statsPredicate
+		expected bool
+	}{
+		{statsPredicate{column: "id", op: "=", value: int64(3)}, true},
+		{statsPredicate{column: "id", op: "=", value: int64(4)}, false},
+		{statsPredicate{column: "id", op: ">", value: 2.5}, true},
+		{statsPredicate{column: "id", op: ">=", value: int64(4)}, false},
+		{statsPredicate{column: "id", op: "<", value: int64(-2)}, false},
+		{statsPredicate{column: "id", op: "<=", value: int64(-2)}, true},
+		{statsPredicate{column: "ts", op: "<", value: "2024-01-01"}, false},
+		{statsPredicate{column: "ts", op: ">", value: ts}, true},
+		{statsPredicate{column: "any", op: "<>", value: "a"}, true},
+		{statsPredicate{column: "any", op: "=", value: int64(1)}, true}, // not comparable, file is read
+		{statsPredicate{column: "id", op: "IS NULL"}, true},
+		{statsPredicate{column: "big", op: "=", value: int64(0)}, false},
+		{statsPredicate{column: "big", op: "=", value: int64(1<<60 + 1)}, false},
+		{statsPredicate{column: "big", op: "=", value: int64(1 << 60)}, true},
+		{statsPredicate{column: "id", op: "=", value: nil}, false},
+	} {
+		assert.Equal(t, tc.expected, decoded.mayMatch(schema, tc.p), "%+v", tc.p)
+	}
+
+	allNull := collectStats(schema, [][]any{{nil, nil, nil, nil, nil}})
+	assert.False(t, allNull.mayMatch(schema, statsPredicate{column: "id", op: "<>", value: int64(1)}))
+	assert.False(t, allNull.mayMatch(schema, statsPredicate{column: "id", op: "IS NOT NULL"}))
+	assert.True(t, allNull.mayMatch(schema, statsPredicate{column: "id", op: "IS NULL"}))
+}
+
+func TestQueryPushdown(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+	prepareScanTable(t, cl, 5, 10)
+
+	tx := cl.NewTransaction()
+	foo := tx.tables["foo"]
+	// empty data object flushed when the table was created is skipped too
+	require.Len(t, foo.stats, len(foo.files))
+	assert.Len(t, foo.prune([]statsPredicate{{column: "file", op: ">=", value: int64(3)}}).files, 2)
+	assert.Len(t, foo.prune([]statsPredicate{{column: "file", op: "=", value: 2.0}}).files, 1)
+	assert.Len(t, foo.prune([]statsPredicate{{column: "row", op: "<", value: int64(5)}}).files, 5)
+
+	// files without stats are always read
+	delete(foo.stats, foo.files[len(foo.files)-1])
+	assert.Len(t, foo.prune([]statsPredicate{{column: "file", op: "<", value: int64(1)}}).files, 2)
+
+	preds, err := pushdown(mustParse(t, "SELECT * FROM foo a LEFT JOIN foo b ON a.row = b.row WHERE a.file > 3 AND 1 >= b.file AND b.row IS NULL AND a.row + 1 = 2"),
+		scope{{table: "a", name: "file"}, {table: "a", name: "row"}, {table: "b", name: "file"}, {table: "b", name: "row"}},
+		[]scope{{{table: "a", name: "file"}, {table: "a", name: "row"}}, {{table: "b", name: "file"}, {table: "b", name: "row"}}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]statsPredicate{
+		{{column: "file", op: ">", value: int64(3)}},
+		{{column: "file", op: "<=", value: int64(1)}},
+	}, preds)
+
+	_, rows := queryRows(t, tx, "SELECT file, count(*) FROM foo WHERE file >= 3 GROUP BY file ORDER BY file")
+	assert.Equal(t, [][]any{{float64(3), int64(10)}, {float64(4), int64(10)}}, rows)
+	require.NoError(t, tx.Commit())
+}
+
+func mustParse(t *testing.T, query string) *selectQuery {
+	q, err := parseQuery(query)
+	require.NoError(t, err)
+	return q
+}
@@ -1,13 +1,14 @@
 package deltalake
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"io"
 	"log/slog"
-)
+	"slices"
 
-// todo: add lazy files - open only when accessed
+	"go.uber.org/multierr"
+)
 
 const (
 	_initActionCap = 50
@@ -18,20 +19,28 @@ var (
 )
 
 type table struct {
-	name    string
-	columns []string
+	name   string
+	schema Schema
 
 	files   []string // underlying table files
 	actions []action
+	stats   map[string]*fileStats // stats of the files, when recorded
+	// deletion vectors of the files with deleted rows
+	deletionVectors map[string]*deletionVector
+
+	properties map[string]string
 
 	dirty           bool // if any data was changed in the Transaction
 	externalStorage ObjectStorage
+	rows            *rowCache
 }
 
-func newTable(name string, storage ObjectStorage) *table {
+func newTable(name string, schema Schema, storage ObjectStorage, rows *rowCache) *table {
 	return &table{
 		name:            name,
+		schema:          schema,
 		externalStorage: storage,
+		rows:            rows,
 	}
 }
 
@@ -43,20 +52,28 @@ func (t *table) write(buf io.Writer) error {
 // stored in underlying files
 type tableBuilder struct {
 	name    string
-	columns []string
+	schema  Schema
 	files   []string
 	actions []action
+	stats   map[string]*fileStats
+	dvs     map[string]*deletionVector
+
+	properties map[string]string
 
 	storage ObjectStorage
+	rows    *rowCache
 }
 
-func newTableBuilder(name string, storage ObjectStorage) *tableBuilder {
+func newTableBuilder(name string, storage ObjectStorage, rows *rowCache) *tableBuilder {
 	return &tableBuilder{
 		name:    name,
-		columns: make([]string, 0),
+		schema:  make(Schema, 0),
 		files:   make([]string, 0),
 		actions: make([]action, 0),
+		stats:   make(map[string]*fileStats),
+		dvs:     make(map[string]*deletionVector),
 		storage: storage,
+		rows:    rows,
 	}
 }
 
@@ -64,11 +81,27 @@ func (tb *tableBuilder) add(a action) *tableBuilder {
 	// todo: // refactor actions
 	switch a := a.(type) {
 	case *changeMetadata:
-		tb.columns = a.Columns
+		tb.schema = a.schema()
+		tb.properties = a.Properties
+		return tb
+	case *changeDataAction:
+		// changed rows are read from the log by TableChanges
 		return tb
 	case *dataObjectAction:
 		tb.actions = append(tb.actions, a)
+		if a.Action == _remove {
+			tb.files = slices.DeleteFunc(tb.files, func(f string) bool { return f == a.File })
+			delete(tb.stats, a.File)
+			delete(tb.dvs, a.File)
+			return tb
+		}
 		tb.files = append(tb.files, a.File)
+		if a.Stats != nil {
+			tb.stats[a.File] = a.Stats
+		}
+		if a.DeletionVector != nil {
+			tb.dvs[a.File] = a.DeletionVector
+		}
 		return tb
 	default:
 		slog.Error("unsuported action")
@@ -79,58 +112,67 @@ func (tb *tableBuilder) add(a action) *tableBuilder {
 func (tb *tableBuilder) build() *table {
 	return &table{
 		name:            tb.name,
-		columns:         tb.columns,
+		schema:          tb.schema,
 		files:           tb.files,
 		actions:         tb.actions,
+		stats:           tb.stats,
+		deletionVectors: tb.dvs,
+		properties:      tb.properties,
 		externalStorage: tb.storage,
+		rows:            tb.rows,
 	}
 }
 
-func (t *table) scan() *tableIt {
+func (t *table) scan(ctx context.Context) *tableIt {
 	tt := &tableIt{
-		table:        t,
-		tablePointer: 0,
-		filePointer:  0,
+		ctx:         ctx,
+		table:       t,
+		filePointer: 0,
 	}
 	return tt
 }
 
 // todo: add logging
 
+// tableIt reads data objects lazily, only the row being returned and the
+// decoder buffer of the current file are kept in memory.
 type tableIt struct {
-	table        *table
-	tablePointer int
-	filePointer  int
+	ctx         context.Context
+	table       *table
+	filePointer int
 
-	buf [][]any
+	rd rowReader // reader of the current file
 }
 
 func (tt *tableIt) First() ([]any, error) {
 	tt.filePointer = 0
-	tt.tablePointer = 0
-
-	err := tt.moveFile()
-	if err != nil {
+	if err := tt.closeFile(); err != nil {
 		return nil, err
 	}
 	return tt.Next()
 }
 
 func (tt *tableIt) Next() ([]any, error) {
-	if tt.tablePointer == len(tt.buf) {
-		err := tt.moveFile()
-		if err != nil {
+	if err := tt.ctx.Err(); err != nil {
+		return nil, err
+	}
+	for {
+		if tt.rd == nil {
+			if err := tt.moveFile(); err != nil {
+				return nil, err
+			}
+		}
+		row, err := tt.rd.next()
+		if err == nil {
+			return row, nil
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if err := tt.closeFile(); err != nil {
 			return nil, err
 		}
-		tt.tablePointer = 0
-	}
-	if len(tt.buf) < tt.tablePointer {
-		return nil, errors.New("empty table buffer")
 	}
-	defer func() {
-		tt.tablePointer++
-	}()
-	return tt.buf[tt.tablePointer], nil
 }
 
 func (tt *tableIt) moveFile() error {
@@ -146,22 +188,59 @@ func (tt *tableIt) moveFile() error {
 }
 
 func (tt *tableIt) loadFile(file string) error {
-	rd, err := tt.table.externalStorage.Read(file)
+	rd, err := tt.table.openFile(file)
 	if err != nil {
 		return err
 	}
-	raw, err := io.ReadAll(rd)
+	tt.rd = rd
+	return nil
+}
+
+func (tt *tableIt) Close() error {
+	return tt.closeFile()
+}
+
+func (tt *tableIt) closeFile() error {
+	if tt.rd == nil {
+		return nil
+	}
+	err := tt.rd.close()
+	tt.rd = nil
+	return err
+}
+
+// openFile returns reader of the data object rows, served from the row cache
+// when possible
+func (t *table) openFile(file string) (rowReader, error) {
+	rd, err := t.openRawFile(file)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if dv, ok := t.deletionVectors[file]; ok {
+		deleted, err := t.loadDeletionVector(dv)
+		if err != nil {
+			return nil, multierr.Append(err, rd.close())
+		}
+		rd = &maskedRowReader{rowReader: rd, deleted: deleted}
+	}
+	return &typedRowReader{rowReader: rd, schema: t.schema}, nil
+}
+
+// openRawFile returns rows as decoded from json, numbers are json.Number
+func (t *table) openRawFile(file string) (rowReader, error) {
+	if rows, ok := t.rows.get(file); ok {
+		return newSliceRowReader(rows), nil
 	}
-	var do dataObject
-	err = json.Unmarshal(raw, &do)
+	rc, err := t.externalStorage.Read(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if do.Table != tt.table.name {
-		return errors.New("wrong data object read")
+	rd, err := newDataObjectReader(rc, t.name)
+	if err != nil {
+		return nil, multierr.Append(err, rc.Close())
 	}
-	tt.buf = do.Data
-	return nil
+	if t.rows == nil {
+		return rd, nil
+	}
+	return newCachingRowReader(rd, t.rows, file), nil
 }
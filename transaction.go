@@ -1,25 +1,19 @@
 package deltalake
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"io"
+	"iter"
 	"log/slog"
-	"strconv"
-	"strings"
-	"sync"
+	"maps"
+	"slices"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/multierr"
 )
 
-var transactionPool = sync.Pool{
-	New: func() any {
-		return new(Transaction)
-	},
-}
-
 type Transaction struct {
 	id int64
 
@@ -31,65 +25,53 @@ type Transaction struct {
 
 	actions []action // actions performed in the current Transaction, not comitted yet
 
-	buffer   map[string][][]any // todo: buffer manager  mapping table->rows
+	buffer   map[string]*tableBuffer // rows not flushed yet, accounted in d.buffers
+	flushes  []*pendingFlush         // data objects written in the background
 	commited atomic.Bool
+
+	clientId string
+	// operation recorded in commit info, derived from the actions when empty
+	operation           string
+	operationParameters map[string]string
+	metrics             map[string]int64 // operation metrics added to commit info
+
+	appTxn      *txnAction       // application transaction committed by the transaction
+	appVersions map[string]int64 // last committed versions of application transactions
 }
 
 func newTransaction(d *delta) *Transaction {
-	tx := transactionPool.Get().(*Transaction)
+	tx := new(Transaction)
 	tx.init(d)
 	return tx
 }
 
 func (tx *Transaction) init(d *delta) {
 	tx.d = d
+	tx.id = 0
 	tx.commited.Store(false)
 	tx.tables = make(map[string]*table)
 	tx.actions = make([]action, 0)
-	tx.buffer = make(map[string][][]any)
-
-	getTxId := func(name string) int64 {
-		raw, found := strings.CutPrefix(name, "_log_")
-		if !found {
-			return 0
-		}
-		id, err := strconv.ParseInt(raw, 10, 64)
-		if err != nil {
-			return 0
-		}
-		return id
-	}
+	tx.buffer = make(map[string]*tableBuffer)
+	tx.flushes = nil
+	tx.clientId = d.opts.ClientId
+	tx.operation, tx.operationParameters, tx.metrics = "", nil, nil
+	tx.appTxn = nil
+	tx.appVersions = make(map[string]int64)
 
 	previousLogs := func() []action {
-		all, err := tx.d.internalStorage.List("", logPrefix)
+		versions, err := tx.d.log.Versions()
 		if err != nil {
 			slog.Error("error while searching for logs", slog.Any("error", err))
 			return nil
 		}
 
-		l := newLogs()
 		actions := make([]action, 0)
-		for _, a := range all {
-			tx.id = getTxId(a) + 1
-			slog.Debug("processing previous log", slog.String("id", a))
-			reader, err := tx.d.internalStorage.Read(a)
-			if err != nil {
-				slog.Error("error while getting log file", slog.String("id", a), slog.Any("error", err))
-				return nil
-			}
-			raw, err := io.ReadAll(reader)
-			if err != nil {
-				slog.Error("error while reading log file", slog.String("id", a), slog.Any("error", err))
-				return nil
-			}
-			l, err := l.deserialize(raw)
-			if err != nil {
-				slog.Error("error while deserializing log", slog.String("id", a), slog.Any("error", err))
-				return nil
-			}
-			acs, err := l.actions()
+		for _, v := range versions {
+			tx.id = v + 1
+			slog.Debug("processing previous log", slog.Int64("version", v))
+			acs, err := tx.d.readActions(v)
 			if err != nil {
-				slog.Error("error while deserializing actions", slog.String("id", a), slog.Any("error", err))
+				slog.Error("error while reading log", slog.Int64("version", v), slog.Any("error", err))
 				return nil
 			}
 			actions = append(actions, acs...)
@@ -101,10 +83,17 @@ func (tx *Transaction) init(d *delta) {
 
 	builders := make(map[string]*tableBuilder)
 	for _, a := range previousLogs {
+		switch a := a.(type) {
+		case *commitInfo:
+			continue
+		case *txnAction:
+			tx.appVersions[a.AppId] = a.Version
+			continue
+		}
 		t := a.getTable()
 		tb, ok := builders[t]
 		if !ok {
-			builders[t] = newTableBuilder(t, tx.d.internalStorage)
+			builders[t] = newTableBuilder(t, tx.d.internalStorage, tx.d.rows)
 			tb = builders[t]
 		}
 		tb.add(a)
@@ -115,89 +104,258 @@ func (tx *Transaction) init(d *delta) {
 	}
 }
 
+// Create creates table whose columns accept values of any type
 func (tx *Transaction) Create(table string, columns []string) error {
+	return tx.CreateWithSchema(table, untypedSchema(columns))
+}
+
+// CreateWithSchema creates table with typed columns, values written to the
+// table are validated and converted to the column types
+func (tx *Transaction) CreateWithSchema(table string, schema Schema) error {
 	if _, ok := tx.tables[table]; ok {
-		return errors.New("table exists")
+		return tableError(table, ErrTableExists)
 	}
-	tx.buffer[table] = make([][]any, 0)
-	tx.tables[table] = newTable(table, tx.d.internalStorage)
+	tx.buffer[table] = &tableBuffer{}
+	tx.tables[table] = newTable(table, schema, tx.d.internalStorage, tx.d.rows)
 
-	cm := newChangeMetadaAction(table, columns)
+	cm := newChangeMetadaAction(table, schema)
 	tx.actions = append(tx.actions, cm)
 
 	return nil
 }
 
 func (tx *Transaction) Put(table string, values []any) error {
-	// validate schema
-	if _, ok := tx.tables[table]; !ok {
-		return errors.New("table not found")
-	}
+	return tx.PutContext(context.Background(), table, values)
+}
 
-	if tx.buffer[table] == nil {
-		tx.buffer[table] = make([][]any, 0)
+// PutContext buffers the row in the transaction. Once buffers of all
+// transactions exhaust the memory budget it waits for them to be flushed
+// until ctx is done or MemoryWaitTimeout elapses.
+func (tx *Transaction) PutContext(ctx context.Context, table string, values []any) error {
+	if tx.commited.Load() {
+		return ErrTransactionClosed
+	}
+	t, ok := tx.tables[table]
+	if !ok {
+		return tableError(table, ErrTableNotFound)
+	}
+	values, err := t.schema.coerce(values)
+	if err != nil {
+		return tableError(table, err)
 	}
 
-	if len(tx.buffer[table]) == tx.d.opts.MaxMemoryBufferSz {
-		// todo: make async
+	fileBytes := encodedSize(values)
+	if buf, ok := tx.buffer[table]; ok && tx.d.opts.objectFull(len(buf.rows), buf.fileBytes+fileBytes, t.optimizeWrite()) {
 		if err := tx.flushTable(table); err != nil {
 			return err
 		}
 	}
 
-	tx.buffer[table] = append(tx.buffer[table], values)
+	// waits while buffers of all transactions exceed the memory budget,
+	// buffers of this transaction are flushed first so it doesn't wait for
+	// itself
+	size := rowSize(values)
+	if err := tx.d.buffers.reserve(ctx, size, tx.d.opts.MemoryWaitTimeout, tx.flushTables); err != nil {
+		return tableError(table, err)
+	}
+
+	buf, ok := tx.buffer[table]
+	if !ok {
+		buf = &tableBuffer{}
+		tx.buffer[table] = buf
+	}
+	buf.rows = append(buf.rows, values)
+	buf.bytes += size
+	buf.fileBytes += fileBytes
 	return nil
 }
 
+// Commit writes the transaction to the log. Transaction which failed to
+// commit stays open and has to be rolled back.
 func (tx *Transaction) Commit() error {
-	defer transactionPool.Put(tx)
+	_, err := tx.CommitVersion()
+	return err
+}
 
+// CommitVersion commits the transaction same as Commit and returns version
+// of the log it was written as. The version follows auto compactions
+// committed concurrently, so it can be past GetId. Version is -1 when the app
+// transaction was already committed and nothing was written.
+func (tx *Transaction) CommitVersion() (int64, error) {
+	if tx.commited.Load() {
+		return 0, ErrTransactionClosed
+	}
 	if tx.d == nil {
-		return errors.New("no delta conn")
+		return 0, errors.New("no delta conn")
 	}
 
-	if tx.commited.Load() {
-		return errors.New("Transaction already commited")
+	version, err := tx.commit()
+	tx.discardBuffers()
+	if err != nil {
+		return 0, err
 	}
+	tx.autoOptimize()
+	tx.close()
+	return version, nil
+}
 
-	if len(tx.buffer) > 0 {
-		// flush in-memory buffer to delta lake file and append add action
-		err := tx.flushTables()
-		if err != nil {
-			return err
+func (tx *Transaction) commit() (int64, error) {
+	if tx.appTxn != nil {
+		if v, ok := tx.appVersions[tx.appTxn.AppId]; ok && v >= tx.appTxn.Version {
+			// written by previous attempt, data objects already flushed by
+			// Put are left for removal same as on rollback
+			tx.actions = nil
+			return -1, nil
 		}
+		tx.appTxn.LastUpdated = time.Now().UTC()
 	}
 
+	// flush in-memory buffer to delta lake file and append add action
+	if err := multierr.Append(tx.flushTables(), tx.awaitFlushes()); err != nil {
+		return 0, err
+	}
 	if err := tx.logAndApply(); err != nil {
-		return err
+		return 0, err
 	}
+	return tx.id, nil
+}
 
-	tx.commited.Store(true)
+// Rollback discards the transaction. Data objects already flushed by Put are
+// not referenced by the log and are left for removal.
+func (tx *Transaction) Rollback() error {
+	if tx.commited.Load() {
+		return ErrTransactionClosed
+	}
+
+	tx.discardBuffers()
+	tx.actions = nil
+	tx.close()
 	return nil
 }
 
+// close marks the transaction closed, it can't be used afterwards
+func (tx *Transaction) close() {
+	tx.commited.Store(true)
+}
+
+// flushTable writes buffered rows of the table as data object, in the
+// background when flush workers are configured. Memory of the rows is
+// released once the object is written.
 func (tx *Transaction) flushTable(name string) error {
-	data, ok := tx.buffer[name]
+	buf, ok := tx.buffer[name]
 	if !ok {
 		return errors.New("table not found in memory")
 	}
+	delete(tx.buffer, name)
+	t, ok := tx.tables[name]
+	if !ok {
+		tx.d.buffers.release(buf.bytes)
+		return tableError(name, ErrTableNotFound)
+	}
+	// the table can't be used by the background flush, it is changed by the
+	// transaction
+	schema, cdf := t.schema, t.changeDataFeed()
+
+	if tx.d.buffers.workers == nil {
+		defer tx.d.buffers.release(buf.bytes)
+		actions, err := tx.d.flushRows(name, schema, cdf, buf.rows)
+		tx.actions = append(tx.actions, actions...)
+		return err
+	}
+	pf := &pendingFlush{table: name, done: make(chan struct{})}
+	tx.flushes = append(tx.flushes, pf)
+	d := tx.d
+	go func() {
+		defer close(pf.done)
+		d.buffers.workers <- struct{}{}
+		defer func() { <-d.buffers.workers }()
+		defer d.buffers.release(buf.bytes)
+		pf.actions, pf.err = d.flushRows(name, schema, cdf, buf.rows)
+	}()
+	return nil
+}
 
+// flushRows persists the rows as data object and change data file when the
+// change data feed is enabled
+func (d *delta) flushRows(name string, schema Schema, cdf bool, data [][]any) ([]action, error) {
 	// todo: add table to Transaction cache
+	ao, err := d.persistDataObject(name, schema, data)
+	if err != nil {
+		return nil, err
+	}
+	if !cdf || len(data) == 0 {
+		return []action{ao}, nil
+	}
+	changes := make([][]any, len(data))
+	for i, row := range data {
+		changes[i] = withChangeType(row, ChangeInsert)
+	}
+	ca, err := d.persistChanges(name, changes)
+	if err != nil {
+		return []action{ao}, err
+	}
+	return []action{ao, ca}, nil
+}
+
+// awaitFlushes waits for background flushes and adds their actions to the
+// transaction
+func (tx *Transaction) awaitFlushes() error {
+	var err error
+	for _, pf := range tx.flushes {
+		<-pf.done
+		tx.actions = append(tx.actions, pf.actions...)
+		err = multierr.Append(err, pf.err)
+	}
+	tx.flushes = nil
+	return err
+}
+
+// discardBuffers releases memory of rows which were not flushed, background
+// flushes release their memory when they finish
+func (tx *Transaction) discardBuffers() {
+	if tx.d == nil {
+		return
+	}
+	for _, buf := range tx.buffer {
+		tx.d.buffers.release(buf.bytes)
+	}
+	// transaction which failed to commit can still be used
+	tx.buffer = make(map[string]*tableBuffer)
+	tx.flushes = nil
+}
+
+// writeDataObject persists the rows as a new data object of the table added
+// by the transaction
+func (tx *Transaction) writeDataObject(name string, data [][]any) (*dataObjectAction, error) {
+	var schema Schema
+	if t, ok := tx.tables[name]; ok {
+		schema = t.schema
+	}
+	ao, err := tx.d.persistDataObject(name, schema, data)
+	if err != nil {
+		return nil, err
+	}
+	tx.actions = append(tx.actions, ao)
+	return ao, nil
+}
+
+// persistDataObject writes the rows as a new data object of the table
+func (d *delta) persistDataObject(name string, schema Schema, data [][]any) (*dataObjectAction, error) {
 	do := &dataObject{
 		Id:    uuid.NewString(),
 		Table: name,
 		Data:  data,
 		Size:  len(data),
 	}
-	err := do.persist(tx.d.internalStorage)
+	size, err := do.persist(d.internalStorage)
 	if err != nil {
 		slog.Error("error while saving data object on disk", slog.String("table", name))
-		return err
+		return nil, err
 	}
 	ao := newDataObjAction(do.Table, do.fileName, _add)
-	tx.actions = append(tx.actions, ao)
-	tx.buffer[name] = tx.buffer[name][:0]
-	return nil
+	ao.Stats = collectStats(schema, data)
+	ao.Stats.Size = size
+	return ao, nil
 }
 
 func (tx *Transaction) flushTables() error {
@@ -210,29 +368,169 @@ func (tx *Transaction) flushTables() error {
 	return err
 }
 
+// buffered reports whether rows put to the table are not committed yet
+func (tx *Transaction) buffered(table string) bool {
+	if buf, ok := tx.buffer[table]; ok && len(buf.rows) > 0 {
+		return true
+	}
+	return slices.ContainsFunc(tx.flushes, func(pf *pendingFlush) bool { return pf.table == table })
+}
+
+// SetAppTransaction declares the transaction as the version of the
+// application writer identified by appId. Commit records the version and
+// does nothing when the same or a later version of appId was already
+// committed, so retried writes are applied exactly once.
+func (tx *Transaction) SetAppTransaction(appId string, version int64) {
+	tx.appTxn = &txnAction{AppId: appId, Version: version}
+}
+
+// AppTransactionVersion returns the last version committed by the application
+// writer in the snapshot of the transaction
+func (tx *Transaction) AppTransactionVersion(appId string) (int64, bool) {
+	v, ok := tx.appVersions[appId]
+	return v, ok
+}
+
+// SetClientId sets client recorded in the commit info, it overrides
+// Opts.ClientId
+func (tx *Transaction) SetClientId(id string) {
+	tx.clientId = id
+}
+
+func (tx *Transaction) setOperation(op string, params map[string]string) {
+	tx.operation, tx.operationParameters = op, params
+}
+
+func (tx *Transaction) addMetric(name string, n int64) {
+	if tx.metrics == nil {
+		tx.metrics = make(map[string]int64)
+	}
+	tx.metrics[name] += n
+}
+
+// commitInfo describes the actions of the transaction
+func (tx *Transaction) commitInfo() *commitInfo {
+	ci := &commitInfo{
+		Timestamp:           time.Now().UTC(),
+		Operation:           tx.operation,
+		OperationParameters: tx.operationParameters,
+		ClientId:            tx.clientId,
+		Metrics:             map[string]int64{"numFiles": 0, "numOutputRows": 0},
+	}
+	created := false
+	tables := make(map[string]bool)
+	for _, a := range tx.actions {
+		tables[a.getTable()] = true
+		switch a := a.(type) {
+		case *changeMetadata:
+			created = true
+		case *dataObjectAction:
+			if a.Action == _remove {
+				ci.Metrics["numRemovedFiles"]++
+				continue
+			}
+			ci.Metrics["numFiles"]++
+			if a.Stats != nil {
+				ci.Metrics["numOutputRows"] += a.Stats.NumRecords
+			}
+			if a.DeletionVector != nil {
+				ci.Metrics["numOutputRows"] -= a.DeletionVector.Cardinality
+			}
+		}
+	}
+	for name, n := range tx.metrics {
+		ci.Metrics[name] += n
+	}
+	for t := range tables {
+		ci.Tables = append(ci.Tables, t)
+	}
+	slices.Sort(ci.Tables)
+	if ci.Operation == "" {
+		ci.Operation = "WRITE"
+		ci.OperationParameters = map[string]string{"mode": "Append"}
+		if created {
+			ci.Operation, ci.OperationParameters = "CREATE TABLE", nil
+		}
+	}
+	return ci
+}
+
 func (tx *Transaction) logAndApply() error {
 	l := newLogs()
-	for _, a := range tx.actions {
+	actions := []action{tx.commitInfo()}
+	if tx.appTxn != nil {
+		actions = append(actions, tx.appTxn)
+	}
+	for _, a := range append(actions, tx.actions...) {
 		le, err := newLogEntry(a)
 		if err != nil {
 			return err
 		}
 		l = l.append(le)
 	}
-	filname := fmt.Sprintf("%s_%d", logPrefix, tx.id)
 	rawLogs, err := l.serialize()
 	if err != nil {
 		return err
 	}
-	return tx.d.internalStorage.Write(filname, rawLogs)
+	for {
+		err = tx.d.log.Write(tx.id, rawLogs)
+		if !errors.Is(err, ErrVersionExists) {
+			return err
+		}
+		// auto compaction committed in the background doesn't fail the
+		// transaction unless they removed the same data objects
+		ok, rerr := tx.followsCompaction(tx.id)
+		if rerr != nil || !ok {
+			return &ConflictError{Version: tx.id, Err: multierr.Append(err, rerr)}
+		}
+		tx.id++
+	}
 }
 
 func (tx *Transaction) Iter(name string) (Iterator, error) {
+	return tx.IterContext(context.Background(), name, DefaultScanOptions())
+}
+
+// IterWithOptions returns iterator over the table reading data objects as
+// configured in opts
+func (tx *Transaction) IterWithOptions(name string, opts ScanOptions) (Iterator, error) {
+	return tx.IterContext(context.Background(), name, opts)
+}
+
+// IterContext returns iterator which fails with the context error once ctx
+// is done
+func (tx *Transaction) IterContext(ctx context.Context, name string, opts ScanOptions) (Iterator, error) {
+	table, ok := tx.tables[name]
+	if !ok {
+		return nil, tableError(name, ErrTableNotFound)
+	}
+	return table.scanWithOptions(ctx, opts), nil
+}
+
+// Rows returns all rows of the table as a range-over-func sequence. Iteration
+// stops after the first error, underlying iterator is closed when the loop ends.
+func (tx *Transaction) Rows(ctx context.Context, name string) iter.Seq2[[]any, error] {
+	it, err := tx.IterContext(ctx, name, DefaultScanOptions())
+	if err != nil {
+		return func(yield func([]any, error) bool) {
+			yield(nil, err)
+		}
+	}
+	return All(it)
+}
+
+// Tables returns names of the tables of the transaction in sorted order
+func (tx *Transaction) Tables() []string {
+	return slices.Sorted(maps.Keys(tx.tables))
+}
+
+// Schema returns columns of the table
+func (tx *Transaction) Schema(name string) (Schema, error) {
 	table, ok := tx.tables[name]
 	if !ok {
-		return nil, errors.New("table does not exist")
+		return nil, tableError(name, ErrTableNotFound)
 	}
-	return table.scan(), nil
+	return table.schema, nil
 }
 
 func (tx *Transaction) GetId() int64 {
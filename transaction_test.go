@@ -88,3 +88,82 @@ func TestTransactionReadCommited(t *testing.T) {
 
 	cleanup(testdir)
 }
+
+func TestTransactionErrors(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "a", Type: Int64Type}}))
+	var tableErr *TableError
+	err := tx.Create("foo", []string{"a"})
+	assert.ErrorIs(t, err, ErrTableExists)
+	assert.ErrorAs(t, err, &tableErr)
+	assert.Equal(t, "foo", tableErr.Table)
+	assert.ErrorIs(t, tx.Put("bar", []any{1}), ErrTableNotFound)
+	assert.ErrorIs(t, tx.Put("foo", []any{"x"}), ErrSchemaMismatch)
+	_, err = tx.Iter("bar")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	conflicting := cl.NewTransaction()
+	assert.NoError(t, tx.Commit())
+	assert.ErrorIs(t, tx.Commit(), ErrTransactionClosed)
+
+	assert.NoError(t, conflicting.Create("bar", []string{"a"}))
+	err = conflicting.Commit()
+	var conflictErr *ConflictError
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, int64(0), conflictErr.Version)
+
+	// failed transaction stays open until it is rolled back
+	assert.NoError(t, conflicting.Put("bar", []any{1}))
+	assert.NoError(t, conflicting.Rollback())
+	assert.ErrorIs(t, conflicting.Put("bar", []any{1}), ErrTransactionClosed)
+	assert.ErrorIs(t, conflicting.Rollback(), ErrTransactionClosed)
+	assert.ErrorIs(t, conflicting.Commit(), ErrTransactionClosed)
+
+	// finished transaction stays closed when other transactions begin
+	tx = cl.NewTransaction()
+	assert.NoError(t, tx.Commit())
+	other := cl.NewTransaction()
+	assert.ErrorIs(t, tx.Commit(), ErrTransactionClosed)
+	assert.ErrorIs(t, tx.Put("foo", []any{1}), ErrTransactionClosed)
+	assert.NoError(t, other.Rollback())
+}
+
+func TestAppTransaction(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	assert.NoError(t, tx.Create("foo", []string{"id"}))
+	assert.NoError(t, tx.Commit())
+
+	write := func(version int64, id int) *Transaction {
+		tx := cl.NewTransaction()
+		tx.SetAppTransaction("ingest", version)
+		assert.NoError(t, tx.Put("foo", []any{id}))
+		return tx
+	}
+	first, retried := write(1, 1), write(1, 1)
+	assert.NoError(t, first.Commit())
+	assert.ErrorIs(t, retried.Commit(), ErrConflict)
+	// retry on the new snapshot finds the version already committed
+	assert.NoError(t, write(1, 1).Commit())
+	assert.NoError(t, write(0, 0).Commit())
+	assert.NoError(t, write(2, 2).Commit())
+
+	tx = cl.NewTransaction()
+	defer tx.Rollback()
+	rows := collectRows(t, mustIter(t, tx, "foo"))
+	assert.Equal(t, [][]any{{1.0}, {2.0}}, rows)
+	v, ok := tx.AppTransactionVersion("ingest")
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, v)
+	_, ok = tx.AppTransactionVersion("other")
+	assert.False(t, ok)
+	assert.Equal(t, int64(3), tx.GetId())
+}
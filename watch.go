@@ -0,0 +1,180 @@
+package deltalake
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+)
+
+// backoff of polling the log for new versions, it is reset once a version
+// is found
+const (
+	_watchMinBackoff = 50 * time.Millisecond
+	_watchMaxBackoff = 2 * time.Second
+)
+
+// TableVersion holds rows of the data objects added to and removed from the
+// table by the version. Rewritten data objects appear with all their rows
+// in both Removed and Added.
+type TableVersion struct {
+	Version   int64
+	Timestamp time.Time
+	Added     [][]any
+	Removed   [][]any
+}
+
+func (d *delta) Watch(ctx context.Context, table string, fromVersion int64) iter.Seq2[*TableVersion, error] {
+	return func(yield func(*TableVersion, error) bool) {
+		versions, err := d.log.Versions()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		next := max(fromVersion, 0) // first version not read yet
+		meta, err := d.tableMetadata(table, versions, next)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		backoff := _watchMinBackoff
+		for {
+			found := false
+			for _, v := range versions {
+				if v < next {
+					continue
+				}
+				found = true
+				next = v + 1
+				tv, err := d.readTableVersion(table, &meta, v)
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				if tv != nil && !yield(tv, nil) {
+					return
+				}
+			}
+			if meta == nil {
+				yield(nil, tableError(table, ErrTableNotFound))
+				return
+			}
+			if found {
+				backoff = _watchMinBackoff
+			} else {
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, _watchMaxBackoff)
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if versions, err = d.log.Versions(); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// tableMetadata returns the last metadata of the table committed before the
+// version, the log is read backwards until it is found. Nil is returned when
+// the table doesn't exist yet.
+func (d *delta) tableMetadata(table string, versions []int64, before int64) (*changeMetadata, error) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] >= before {
+			continue
+		}
+		actions, err := d.readActions(versions[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := len(actions) - 1; j >= 0; j-- {
+			if cm, ok := actions[j].(*changeMetadata); ok && cm.Table == table {
+				return cm, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// readTableVersion returns rows of the data objects of the table changed by
+// the version, metadata changed by the version replaces meta. Nil is
+// returned when the version added or removed no data object of the table or
+// didn't change its rows.
+func (d *delta) readTableVersion(name string, meta **changeMetadata, version int64) (*TableVersion, error) {
+	actions, err := d.readActions(version)
+	if err != nil {
+		return nil, err
+	}
+	tv := &TableVersion{Version: version}
+	objects := make([]*dataObjectAction, 0)
+	for _, a := range actions {
+		switch a := a.(type) {
+		case *commitInfo:
+			if !a.dataChange() {
+				return nil, nil
+			}
+			tv.Timestamp = a.Timestamp
+		case *changeMetadata:
+			if a.Table == name {
+				*meta = a
+			}
+		case *dataObjectAction:
+			if a.Table == name {
+				objects = append(objects, a)
+			}
+		}
+	}
+	if len(objects) == 0 || *meta == nil {
+		return nil, nil
+	}
+	t := &table{
+		name:            name,
+		schema:          (*meta).schema(),
+		externalStorage: d.internalStorage,
+		rows:            d.rows,
+	}
+	for _, da := range objects {
+		// rows are read with the deletion vector of the action, the one of
+		// the removed object is recorded in its remove action
+		t.deletionVectors = make(map[string]*deletionVector)
+		if da.DeletionVector != nil {
+			t.deletionVectors[da.File] = da.DeletionVector
+		}
+		rows, err := t.readRows(da.File)
+		if err != nil {
+			return nil, err
+		}
+		if da.Action == _remove {
+			tv.Removed = append(tv.Removed, rows...)
+		} else {
+			tv.Added = append(tv.Added, rows...)
+		}
+	}
+	return tv, nil
+}
+
+// readRows returns all rows of the data object
+func (t *table) readRows(file string) ([][]any, error) {
+	rd, err := t.openFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.close()
+	rows := make([][]any, 0)
+	for {
+		row, err := rd.next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
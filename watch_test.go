@@ -0,0 +1,97 @@
+package deltalake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	testdir := getTestDir()
+	defer cleanup(testdir)
+	cl := New(NewFileStorage(testdir), DefaultOpts())
+
+	tx := cl.NewTransaction()
+	require.NoError(t, tx.CreateWithSchema("foo", Schema{{Name: "id", Type: Int64Type}}))
+	require.NoError(t, tx.Create("bar", []string{"id"}))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Put("foo", []any{1}))
+	require.NoError(t, tx.Put("foo", []any{2}))
+	require.NoError(t, tx.Commit())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		tx := cl.NewTransaction()
+		assert.NoError(t, tx.Put("bar", []any{1}))
+		assert.NoError(t, tx.Commit())
+		tx = cl.NewTransaction()
+		_, err := tx.Delete("foo", "id = 1")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+	}()
+
+	versions := make([]*TableVersion, 0)
+	for tv, err := range cl.Watch(ctx, "foo", 1) {
+		require.NoError(t, err)
+		versions = append(versions, tv)
+		if len(versions) == 2 {
+			break
+		}
+	}
+	require.Len(t, versions, 2)
+	assert.EqualValues(t, 1, versions[0].Version)
+	assert.False(t, versions[0].Timestamp.IsZero())
+	assert.Equal(t, [][]any{{int64(1)}, {int64(2)}}, versions[0].Added)
+	assert.Empty(t, versions[0].Removed)
+	// version 2 changed only bar, the delete rewrote the data object
+	assert.EqualValues(t, 3, versions[1].Version)
+	assert.Equal(t, [][]any{{int64(1)}, {int64(2)}}, versions[1].Removed)
+	assert.Equal(t, [][]any{{int64(2)}}, versions[1].Added)
+
+	// resumed watch skips older versions and fails once ctx is done
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var err error
+	versions = versions[:0]
+	for tv, watchErr := range cl.Watch(ctx, "foo", 2) {
+		if watchErr != nil {
+			err = watchErr
+			break
+		}
+		versions = append(versions, tv)
+	}
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, versions, 1)
+	assert.EqualValues(t, 3, versions[0].Version)
+
+	// optimization doesn't change rows and is skipped
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Put("foo", []any{3}))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Optimize("foo"))
+	require.NoError(t, tx.Commit())
+	tx = cl.NewTransaction()
+	require.NoError(t, tx.Put("foo", []any{4}))
+	require.NoError(t, tx.Commit())
+	history, err := cl.History("foo", 2)
+	require.NoError(t, err)
+	require.Equal(t, "OPTIMIZE", history[1].Operation)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for tv, err := range cl.Watch(ctx, "foo", 5) {
+		require.NoError(t, err)
+		assert.EqualValues(t, 6, tv.Version)
+		assert.Equal(t, [][]any{{int64(4)}}, tv.Added)
+		break
+	}
+
+	for _, err := range cl.Watch(ctx, "missing", 0) {
+		assert.ErrorIs(t, err, ErrTableNotFound)
+	}
+}